@@ -3,14 +3,18 @@ package main
 import (
 	"bufio"
 	"context"
-	"crypto/rand"
 	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
+	"mime"
 	"os"
+	"path/filepath"
+	"project-crypto/internal/generator"
+	"project-crypto/internal/importer"
 	"project-crypto/internal/storage"
 	"project-crypto/internal/vault"
+	"strings"
 	"time"
 )
 
@@ -26,7 +30,10 @@ func main() {
 	addVaultPath := addCmd.String("vault", "./main.vlt", "path to vault file")
 	site := addCmd.String("site", "", "site name")
 	user := addCmd.String("user", "", "username")
-	pass := addCmd.String("pass", "", "password or gen:N to generate N chars")
+	pass := addCmd.String("pass", "", "password, or a gen: spec such as gen:20, gen:16:lower,digits or gen:words:6")
+	addFolder := addCmd.String("folder", "", "folder id")
+	addTags := addCmd.String("tags", "", "comma-separated tags")
+	addFavorite := addCmd.Bool("favorite", false, "mark as favorite")
 	addMongoURI := addCmd.String("mongo", "", "MongoDB URI (optional)")
 	addDB := addCmd.String("db", "vaultdb", "Mongo database name")
 	addColl := addCmd.String("coll", "blobs", "Mongo collection name")
@@ -41,6 +48,10 @@ func main() {
 	listCmd := flag.NewFlagSet("list", flag.ExitOnError)
 	listVaultPath := listCmd.String("vault", "./main.vlt", "path to vault file")
 	listType := listCmd.String("type", "", "filter by type (e.g. login)")
+	listFolder := listCmd.String("folder", "", "filter by folder id")
+	listSub := listCmd.Bool("subfolders", false, "include items in subfolders of --folder")
+	listTag := listCmd.String("tag", "", "filter by tag (comma-separated, all must match)")
+	listFavorite := listCmd.Bool("favorite", false, "only favorites")
 	listMongoURI := listCmd.String("mongo", "", "MongoDB URI (optional)")
 	listDB := listCmd.String("db", "vaultdb", "Mongo DB")
 	listColl := listCmd.String("coll", "blobs", "Mongo collection")
@@ -48,7 +59,7 @@ func main() {
 	setCmd := flag.NewFlagSet("setpass", flag.ExitOnError)
 	setVaultPath := setCmd.String("vault", "./main.vlt", "path to vault file")
 	setID := setCmd.String("id", "", "item id")
-	setPass := setCmd.String("pass", "", "new password or gen:N")
+	setPass := setCmd.String("pass", "", "new password, or a gen: spec such as gen:20 or gen:words:6")
 	setMongoURI := setCmd.String("mongo", "", "MongoDB URI (optional)")
 	setDB := setCmd.String("db", "vaultdb", "Mongo DB")
 	setColl := setCmd.String("coll", "blobs", "Mongo collection")
@@ -56,10 +67,119 @@ func main() {
 	delCmd := flag.NewFlagSet("delete", flag.ExitOnError)
 	delVaultPath := delCmd.String("vault", "./main.vlt", "path to vault file")
 	delID := delCmd.String("id", "", "item id")
+	delPermanent := delCmd.Bool("permanent", false, "purge immediately instead of moving to trash")
 	delMongoURI := delCmd.String("mongo", "", "MongoDB URI (optional)")
 	delDB := delCmd.String("db", "vaultdb", "Mongo DB")
 	delColl := delCmd.String("coll", "blobs", "Mongo collection")
 
+	histCmd := flag.NewFlagSet("history", flag.ExitOnError)
+	histVaultPath := histCmd.String("vault", "./main.vlt", "path to vault file")
+	histID := histCmd.String("id", "", "item id")
+	histShow := histCmd.Int("show", 0, "print the item as of this version")
+	histDiff := histCmd.Int("diff", 0, "diff this version against the current one")
+	histRestore := histCmd.Int("restore", 0, "restore this version as a new version")
+	histMongoURI := histCmd.String("mongo", "", "MongoDB URI (optional)")
+	histDB := histCmd.String("db", "vaultdb", "Mongo DB")
+	histColl := histCmd.String("coll", "blobs", "Mongo collection")
+
+	trashCmd := flag.NewFlagSet("trash", flag.ExitOnError)
+	trashVaultPath := trashCmd.String("vault", "./main.vlt", "path to vault file")
+	trashRestore := trashCmd.String("restore", "", "restore this item id from the trash")
+	trashPurge := trashCmd.String("purge", "", "permanently delete this item id")
+	trashEmpty := trashCmd.Bool("empty", false, "permanently delete everything in the trash")
+	trashMongoURI := trashCmd.String("mongo", "", "MongoDB URI (optional)")
+	trashDB := trashCmd.String("db", "vaultdb", "Mongo DB")
+	trashColl := trashCmd.String("coll", "blobs", "Mongo collection")
+
+	rekeyCmd := flag.NewFlagSet("rekey", flag.ExitOnError)
+	rekeyVaultPath := rekeyCmd.String("vault", "./main.vlt", "path to vault file")
+	rekeyMongoURI := rekeyCmd.String("mongo", "", "MongoDB URI (optional)")
+	rekeyDB := rekeyCmd.String("db", "vaultdb", "Mongo DB")
+	rekeyColl := rekeyCmd.String("coll", "blobs", "Mongo collection")
+
+	attachCmd := flag.NewFlagSet("attach", flag.ExitOnError)
+	attachVaultPath := attachCmd.String("vault", "./main.vlt", "path to vault file")
+	attachID := attachCmd.String("id", "", "item id")
+	attachFile := attachCmd.String("file", "", "file to attach; without it the attachments are listed")
+	attachName := attachCmd.String("name", "", "attachment name (defaults to the file name)")
+	attachGet := attachCmd.String("get", "", "attachment id to save instead of attaching")
+	attachOut := attachCmd.String("out", "", "output path for --get")
+	attachMongoURI := attachCmd.String("mongo", "", "MongoDB URI (optional)")
+	attachDB := attachCmd.String("db", "vaultdb", "Mongo DB")
+	attachColl := attachCmd.String("coll", "blobs", "Mongo collection")
+
+	detachCmd := flag.NewFlagSet("detach", flag.ExitOnError)
+	detachVaultPath := detachCmd.String("vault", "./main.vlt", "path to vault file")
+	detachID := detachCmd.String("id", "", "item id")
+	detachAtt := detachCmd.String("att", "", "attachment id")
+	detachMongoURI := detachCmd.String("mongo", "", "MongoDB URI (optional)")
+	detachDB := detachCmd.String("db", "vaultdb", "Mongo DB")
+	detachColl := detachCmd.String("coll", "blobs", "Mongo collection")
+
+	folderCmd := flag.NewFlagSet("folder", flag.ExitOnError)
+	folderVaultPath := folderCmd.String("vault", "./main.vlt", "path to vault file")
+	folderCreate := folderCmd.String("create", "", "create a folder with this name")
+	folderID := folderCmd.String("id", "", "folder id to rename, move or delete")
+	folderName := folderCmd.String("name", "", "new name for --id")
+	folderParent := folderCmd.String("parent", "", "parent folder id for --create, or new parent for --id (\"/\" for top level)")
+	folderDelete := folderCmd.Bool("delete", false, "delete --id; its items and subfolders move to its parent")
+	folderMongoURI := folderCmd.String("mongo", "", "MongoDB URI (optional)")
+	folderDB := folderCmd.String("db", "vaultdb", "Mongo DB")
+	folderColl := folderCmd.String("coll", "blobs", "Mongo collection")
+
+	orgCmd := flag.NewFlagSet("organize", flag.ExitOnError)
+	orgVaultPath := orgCmd.String("vault", "./main.vlt", "path to vault file")
+	orgID := orgCmd.String("id", "", "item id")
+	orgFolder := orgCmd.String("folder", "", "folder id (\"/\" for none)")
+	orgTags := orgCmd.String("tags", "", "comma-separated tags, replacing the current ones")
+	orgFavorite := orgCmd.Bool("favorite", false, "mark or (with =false) unmark as favorite")
+	orgMongoURI := orgCmd.String("mongo", "", "MongoDB URI (optional)")
+	orgDB := orgCmd.String("db", "vaultdb", "Mongo DB")
+	orgColl := orgCmd.String("coll", "blobs", "Mongo collection")
+
+	totpCmd := flag.NewFlagSet("totp", flag.ExitOnError)
+	totpVaultPath := totpCmd.String("vault", "./main.vlt", "path to vault file")
+	totpID := totpCmd.String("id", "", "item id")
+	totpField := totpCmd.String("field", "", "field holding the seed (defaults to totp, then the first custom totp field)")
+	totpMongoURI := totpCmd.String("mongo", "", "MongoDB URI (optional)")
+	totpDB := totpCmd.String("db", "vaultdb", "Mongo DB")
+	totpColl := totpCmd.String("coll", "blobs", "Mongo collection")
+
+	healthCmd := flag.NewFlagSet("health", flag.ExitOnError)
+	healthVaultPath := healthCmd.String("vault", "./main.vlt", "path to vault file")
+	healthMongoURI := healthCmd.String("mongo", "", "MongoDB URI (optional)")
+	healthDB := healthCmd.String("db", "vaultdb", "Mongo DB")
+	healthColl := healthCmd.String("coll", "blobs", "Mongo collection")
+
+	backupCmd := flag.NewFlagSet("backup", flag.ExitOnError)
+	backupVaultPath := backupCmd.String("vault", "./main.vlt", "path to vault file")
+	backupOut := backupCmd.String("out", "", "archive to write")
+	backupSeparate := backupCmd.Bool("separate", false, "seal the archive under a separate passphrase instead of the master password")
+	backupMongoURI := backupCmd.String("mongo", "", "MongoDB URI (optional)")
+	backupDB := backupCmd.String("db", "vaultdb", "Mongo DB")
+	backupColl := backupCmd.String("coll", "blobs", "Mongo collection")
+
+	restoreCmd := flag.NewFlagSet("restore", flag.ExitOnError)
+	restoreVaultPath := restoreCmd.String("vault", "./main.vlt", "path of the vault file to restore")
+	restoreIn := restoreCmd.String("in", "", "archive to restore")
+	restoreForce := restoreCmd.Bool("force", false, "replace an existing vault file")
+	restoreMongoURI := restoreCmd.String("mongo", "", "MongoDB URI (optional)")
+	restoreDB := restoreCmd.String("db", "vaultdb", "Mongo DB")
+	restoreColl := restoreCmd.String("coll", "blobs", "Mongo collection")
+
+	importCmd := flag.NewFlagSet("import", flag.ExitOnError)
+	importVaultPath := importCmd.String("vault", "./main.vlt", "path to vault file")
+	importFile := importCmd.String("file", "", "export to import")
+	importFormat := importCmd.String("format", "", "bitwarden, kdbx, 1pux, chrome-csv or firefox-csv (detected when empty)")
+	importDryRun := importCmd.Bool("dry-run", false, "only report what would be imported")
+	importDuplicates := importCmd.String("duplicates", "skip", "skip or keep items already in the vault")
+	importMongoURI := importCmd.String("mongo", "", "MongoDB URI (optional)")
+	importDB := importCmd.String("db", "vaultdb", "Mongo DB")
+	importColl := importCmd.String("coll", "blobs", "Mongo collection")
+
+	inspectCmd := flag.NewFlagSet("inspect", flag.ExitOnError)
+	inspectVaultPath := inspectCmd.String("vault", "./main.vlt", "path to vault file")
+
 	if len(os.Args) < 2 {
 		usage()
 		return
@@ -76,7 +196,14 @@ func main() {
 		_ = addCmd.Parse(os.Args[2:])
 		blobStore, metaStore, err := buildStore(*addVaultPath, *addMongoURI, *addDB, *addColl)
 		dieIf(err)
-		dieIf(addItemWithStore(*addVaultPath, *site, *user, *pass, blobStore, metaStore))
+		org := vault.Organization{Tags: splitList(*addTags)}
+		if *addFolder != "" {
+			org.Folder = addFolder
+		}
+		if *addFavorite {
+			org.Favorite = addFavorite
+		}
+		dieIf(addItemWithStore(*addVaultPath, *site, *user, *pass, org, blobStore, metaStore))
 
 	case "get":
 		_ = getCmd.Parse(os.Args[2:])
@@ -88,7 +215,14 @@ func main() {
 		_ = listCmd.Parse(os.Args[2:])
 		blobStore, metaStore, err := buildStore(*listVaultPath, *listMongoURI, *listDB, *listColl)
 		dieIf(err)
-		dieIf(cmdList(*listVaultPath, *listType, blobStore, metaStore))
+		q := vault.Query{
+			Type:       *listType,
+			Folder:     *listFolder,
+			Subfolders: *listSub,
+			Tags:       splitList(*listTag),
+			Favorite:   *listFavorite,
+		}
+		dieIf(cmdList(*listVaultPath, q, blobStore, metaStore))
 
 	case "setpass":
 		_ = setCmd.Parse(os.Args[2:])
@@ -100,7 +234,99 @@ func main() {
 		_ = delCmd.Parse(os.Args[2:])
 		blobStore, metaStore, err := buildStore(*delVaultPath, *delMongoURI, *delDB, *delColl)
 		dieIf(err)
-		dieIf(cmdDelete(*delVaultPath, *delID, blobStore, metaStore))
+		dieIf(cmdDelete(*delVaultPath, *delID, *delPermanent, blobStore, metaStore))
+
+	case "history":
+		_ = histCmd.Parse(os.Args[2:])
+		blobStore, metaStore, err := buildStore(*histVaultPath, *histMongoURI, *histDB, *histColl)
+		dieIf(err)
+		dieIf(cmdHistory(*histVaultPath, *histID, *histShow, *histDiff, *histRestore, blobStore, metaStore))
+
+	case "trash":
+		_ = trashCmd.Parse(os.Args[2:])
+		blobStore, metaStore, err := buildStore(*trashVaultPath, *trashMongoURI, *trashDB, *trashColl)
+		dieIf(err)
+		dieIf(cmdTrash(*trashVaultPath, *trashRestore, *trashPurge, *trashEmpty, blobStore, metaStore))
+
+	case "rekey":
+		_ = rekeyCmd.Parse(os.Args[2:])
+		blobStore, metaStore, err := buildStore(*rekeyVaultPath, *rekeyMongoURI, *rekeyDB, *rekeyColl)
+		dieIf(err)
+		dieIf(cmdRekey(*rekeyVaultPath, blobStore, metaStore))
+
+	case "attach":
+		_ = attachCmd.Parse(os.Args[2:])
+		blobStore, metaStore, err := buildStore(*attachVaultPath, *attachMongoURI, *attachDB, *attachColl)
+		dieIf(err)
+		dieIf(cmdAttach(*attachVaultPath, *attachID, *attachFile, *attachName, *attachGet, *attachOut, blobStore, metaStore))
+
+	case "detach":
+		_ = detachCmd.Parse(os.Args[2:])
+		blobStore, metaStore, err := buildStore(*detachVaultPath, *detachMongoURI, *detachDB, *detachColl)
+		dieIf(err)
+		dieIf(cmdDetach(*detachVaultPath, *detachID, *detachAtt, blobStore, metaStore))
+
+	case "folder":
+		_ = folderCmd.Parse(os.Args[2:])
+		blobStore, metaStore, err := buildStore(*folderVaultPath, *folderMongoURI, *folderDB, *folderColl)
+		dieIf(err)
+		var parent *string
+		if isSet(folderCmd, "parent") {
+			p := strings.TrimPrefix(*folderParent, "/")
+			parent = &p
+		}
+		dieIf(cmdFolder(*folderVaultPath, *folderCreate, *folderID, *folderName, parent, *folderDelete, blobStore, metaStore))
+
+	case "organize":
+		_ = orgCmd.Parse(os.Args[2:])
+		blobStore, metaStore, err := buildStore(*orgVaultPath, *orgMongoURI, *orgDB, *orgColl)
+		dieIf(err)
+		var org vault.Organization
+		if isSet(orgCmd, "folder") {
+			f := strings.TrimPrefix(*orgFolder, "/")
+			org.Folder = &f
+		}
+		if isSet(orgCmd, "tags") {
+			org.Tags = append([]string{}, splitList(*orgTags)...)
+		}
+		if isSet(orgCmd, "favorite") {
+			org.Favorite = orgFavorite
+		}
+		dieIf(cmdOrganize(*orgVaultPath, *orgID, org, blobStore, metaStore))
+
+	case "totp":
+		_ = totpCmd.Parse(os.Args[2:])
+		blobStore, metaStore, err := buildStore(*totpVaultPath, *totpMongoURI, *totpDB, *totpColl)
+		dieIf(err)
+		dieIf(cmdTOTP(*totpVaultPath, *totpID, *totpField, blobStore, metaStore))
+
+	case "health":
+		_ = healthCmd.Parse(os.Args[2:])
+		blobStore, metaStore, err := buildStore(*healthVaultPath, *healthMongoURI, *healthDB, *healthColl)
+		dieIf(err)
+		dieIf(cmdHealth(*healthVaultPath, blobStore, metaStore))
+
+	case "backup":
+		_ = backupCmd.Parse(os.Args[2:])
+		blobStore, metaStore, err := buildStore(*backupVaultPath, *backupMongoURI, *backupDB, *backupColl)
+		dieIf(err)
+		dieIf(cmdBackup(*backupVaultPath, *backupOut, *backupSeparate, blobStore, metaStore))
+
+	case "restore":
+		_ = restoreCmd.Parse(os.Args[2:])
+		blobStore, metaStore, err := buildStore(*restoreVaultPath, *restoreMongoURI, *restoreDB, *restoreColl)
+		dieIf(err)
+		dieIf(cmdRestore(*restoreVaultPath, *restoreIn, *restoreForce, blobStore, metaStore))
+
+	case "import":
+		_ = importCmd.Parse(os.Args[2:])
+		blobStore, metaStore, err := buildStore(*importVaultPath, *importMongoURI, *importDB, *importColl)
+		dieIf(err)
+		dieIf(cmdImport(*importVaultPath, *importFile, *importFormat, *importDryRun, *importDuplicates, blobStore, metaStore))
+
+	case "inspect":
+		_ = inspectCmd.Parse(os.Args[2:])
+		dieIf(cmdInspect(*inspectVaultPath))
 
 	default:
 		usage()
@@ -111,16 +337,34 @@ func usage() {
 	fmt.Print(`vaultctl commands:
 
   create  --vault path [--mongo URI --db vaultdb --coll blobs]
-  add     --vault path --site example.com --user alice --pass gen:20 [--mongo URI --db vaultdb --coll blobs]
+  add     --vault path --site example.com --user alice --pass gen:20 [--folder <FOLDER_ID>] [--tags a,b] [--favorite] [--mongo URI --db vaultdb --coll blobs]
   get     --vault path --id <ITEM_ID> [--mongo URI --db vaultdb --coll blobs]
-  list    --vault path [--type login] [--mongo URI --db vaultdb --coll blobs]
-  setpass --vault path --id <ITEM_ID> --pass <new|gen:N> [--mongo URI --db vaultdb --coll blobs]
-  delete  --vault path --id <ITEM_ID> [--mongo URI --db vaultdb --coll blobs]
+  list    --vault path [--type login] [--folder <FOLDER_ID> [--subfolders]] [--tag a,b] [--favorite] [--mongo URI --db vaultdb --coll blobs]
+  setpass --vault path --id <ITEM_ID> --pass <new|gen:SPEC> [--mongo URI --db vaultdb --coll blobs]
+  delete  --vault path --id <ITEM_ID> [--permanent] [--mongo URI --db vaultdb --coll blobs]
+  history --vault path --id <ITEM_ID> [--show N | --diff N | --restore N] [--mongo URI --db vaultdb --coll blobs]
+  rekey   --vault path [--mongo URI --db vaultdb --coll blobs]
+  attach  --vault path --id <ITEM_ID> [--file path [--name n] | --get <ATT_ID> --out path] [--mongo URI --db vaultdb --coll blobs]
+  detach  --vault path --id <ITEM_ID> --att <ATT_ID> [--mongo URI --db vaultdb --coll blobs]
+  folder  --vault path [--create name [--parent <FOLDER_ID>] | --id <FOLDER_ID> [--name n] [--parent <FOLDER_ID>|/] [--delete]] [--mongo URI --db vaultdb --coll blobs]
+  organize --vault path --id <ITEM_ID> [--folder <FOLDER_ID>|/] [--tags a,b] [--favorite[=false]] [--mongo URI --db vaultdb --coll blobs]
+  totp    --vault path --id <ITEM_ID> [--field name] [--mongo URI --db vaultdb --coll blobs]
+  health  --vault path [--mongo URI --db vaultdb --coll blobs]
+  backup  --vault path --out file.vltb [--separate] [--mongo URI --db vaultdb --coll blobs]
+  restore --vault path --in file.vltb [--force] [--mongo URI --db vaultdb --coll blobs]
+  import  --vault path --file export [--format bitwarden|kdbx|1pux|chrome-csv|firefox-csv] [--dry-run] [--duplicates skip|keep] [--mongo URI --db vaultdb --coll blobs]
+  inspect --vault path
+  trash   --vault path [--restore <ITEM_ID> | --purge <ITEM_ID> | --empty] [--mongo URI --db vaultdb --coll blobs]
 
 Examples:
   vaultctl create --vault ./main.vlt
   vaultctl add --vault ./main.vlt --site example.com --user ahmad --pass gen:16
+  vaultctl setpass --vault ./main.vlt --id 1761753230653491299 --pass gen:words:5:sep=.,caps,number
   vaultctl get --vault ./main.vlt --id 1761753230653491299
+
+gen: specs:
+  gen:N[:lower,upper,digits,symbols,noambiguous][,exclude=CHARS]   N random characters
+  gen:words:N[:sep=X,caps,number]                                  N words from the built-in wordlist
 `)
 }
 
@@ -162,10 +406,14 @@ func createVaultWithStore(path string, blobs storage.BlobStore, meta storage.Met
 	return nil
 }
 
-func addItemWithStore(path, site, user, pass string, blobs storage.BlobStore, meta storage.MetaStore) error {
+func addItemWithStore(path, site, user, pass string, org vault.Organization, blobs storage.BlobStore, meta storage.MetaStore) error {
 	if site == "" || user == "" || pass == "" {
 		return errors.New("site/user/pass required")
 	}
+	pass, err := resolvePass(pass)
+	if err != nil {
+		return err
+	}
 	master, err := promptSecret("Master password: ")
 	if err != nil {
 		return err
@@ -174,20 +422,11 @@ func addItemWithStore(path, site, user, pass string, blobs storage.BlobStore, me
 
 	vlt := vault.NewWithStores(path, blobs, meta)
 	ctx := context.Background()
-	if err := vlt.Unlock(ctx, master); err != nil {
+	if err := unlock(ctx, vlt, master); err != nil {
 		return err
 	}
 	defer vlt.Lock()
 
-	if len(pass) > 4 && pass[:4] == "gen:" {
-		var n int
-		_, _ = fmt.Sscanf(pass, "gen:%d", &n)
-		if n <= 0 {
-			n = 20
-		}
-		pass = genPassword(n)
-	}
-
 	item := vault.Item{
 		Type: "login",
 		Fields: map[string]string{
@@ -197,10 +436,11 @@ func addItemWithStore(path, site, user, pass string, blobs storage.BlobStore, me
 		},
 	}
 
-	id, err := vlt.AddItem(ctx, item)
+	ids, err := vlt.AddItems(ctx, []vault.NewItem{{Item: item, Organization: org}})
 	if err != nil {
 		return err
 	}
+	id := ids[0]
 	fmt.Println("Added item id:", id)
 
 	items, _ := vlt.List(ctx, vault.Query{})
@@ -221,7 +461,7 @@ func cmdGet(path, id string, blobs storage.BlobStore, meta storage.MetaStore) er
 
 	vlt := vault.NewWithStores(path, blobs, meta)
 	ctx := context.Background()
-	if err := vlt.Unlock(ctx, master); err != nil {
+	if err := unlock(ctx, vlt, master); err != nil {
 		return err
 	}
 	defer vlt.Lock()
@@ -235,7 +475,7 @@ func cmdGet(path, id string, blobs storage.BlobStore, meta storage.MetaStore) er
 	return nil
 }
 
-func cmdList(path, typ string, blobs storage.BlobStore, meta storage.MetaStore) error {
+func cmdList(path string, q vault.Query, blobs storage.BlobStore, meta storage.MetaStore) error {
 	master, err := promptSecret("Master password: ")
 	if err != nil {
 		return err
@@ -244,12 +484,12 @@ func cmdList(path, typ string, blobs storage.BlobStore, meta storage.MetaStore)
 
 	vlt := vault.NewWithStores(path, blobs, meta)
 	ctx := context.Background()
-	if err := vlt.Unlock(ctx, master); err != nil {
+	if err := unlock(ctx, vlt, master); err != nil {
 		return err
 	}
 	defer vlt.Lock()
 
-	metas, err := vlt.List(ctx, vault.Query{Type: typ})
+	metas, err := vlt.List(ctx, q)
 	if err != nil {
 		return err
 	}
@@ -258,6 +498,21 @@ func cmdList(path, typ string, blobs storage.BlobStore, meta storage.MetaStore)
 	return nil
 }
 
+func unlock(ctx context.Context, vlt vault.Vault, master []byte) error {
+	if err := vlt.Unlock(ctx, master); err != nil {
+		return err
+	}
+	rep := vlt.LastUnlock()
+	if rep.KDFUpgraded {
+		fmt.Fprintf(os.Stderr, "note: key derivation upgraded to argon2id m=%d t=%d p=%d\n",
+			rep.NewKDF.M, rep.NewKDF.T, rep.NewKDF.P)
+	}
+	for _, id := range rep.SkippedItems {
+		fmt.Fprintf(os.Stderr, "warning: item %s could not be migrated and keeps its old id\n", id)
+	}
+	return nil
+}
+
 func promptSecret(prompt string) ([]byte, error) {
 	fmt.Print(prompt)
 	br := bufio.NewReader(os.Stdin)
@@ -271,18 +526,18 @@ func promptSecret(prompt string) ([]byte, error) {
 	return master, nil
 }
 
-func genPassword(n int) string {
-	const alphabet = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789!@#$%^&*()-_=+[]{}"
-	buf := make([]byte, n)
-	if _, err := rand.Read(buf); err != nil {
-		for i := range buf {
-			buf[i] = alphabet[i%len(alphabet)]
-		}
+// resolvePass expands a gen: spec (see generator.FromSpec) and returns
+// any other value unchanged.
+func resolvePass(pass string) (string, error) {
+	if !strings.HasPrefix(pass, "gen:") {
+		return pass, nil
 	}
-	for i := range buf {
-		buf[i] = alphabet[int(buf[i])%len(alphabet)]
+	res, err := generator.FromSpec(pass)
+	if err != nil {
+		return "", err
 	}
-	return string(buf)
+	fmt.Fprintf(os.Stderr, "Generated secret with %.0f bits of entropy\n", res.Entropy)
+	return res.Value, nil
 }
 
 func zero(b []byte) {
@@ -324,6 +579,10 @@ func cmdSetPass(path, id, pass string, blobs storage.BlobStore, meta storage.Met
 	if pass == "" {
 		return errors.New("--pass required (or gen:N)")
 	}
+	pass, err := resolvePass(pass)
+	if err != nil {
+		return err
+	}
 
 	master, err := promptSecret("Master password: ")
 	if err != nil {
@@ -333,7 +592,7 @@ func cmdSetPass(path, id, pass string, blobs storage.BlobStore, meta storage.Met
 
 	vlt := vault.NewWithStores(path, blobs, meta)
 	ctx := context.Background()
-	if err := vlt.Unlock(ctx, master); err != nil {
+	if err := unlock(ctx, vlt, master); err != nil {
 		return err
 	}
 	defer vlt.Lock()
@@ -343,21 +602,12 @@ func cmdSetPass(path, id, pass string, blobs storage.BlobStore, meta storage.Met
 		return err
 	}
 
-	if len(pass) > 4 && pass[:4] == "gen:" {
-		var n int
-		_, _ = fmt.Sscanf(pass, "gen:%d", &n)
-		if n <= 0 {
-			n = 20
-		}
-		pass = genPassword(n)
-	}
-
 	if curr.Fields == nil {
 		curr.Fields = map[string]string{}
 	}
 	curr.Fields["password"] = pass
 
-	upd := vault.Item{Type: curr.Type, Fields: curr.Fields}
+	upd := vault.Item{Type: curr.Type, Fields: curr.Fields, Version: curr.Version}
 	if err := vlt.UpdateItem(ctx, id, upd); err != nil {
 		return err
 	}
@@ -366,7 +616,7 @@ func cmdSetPass(path, id, pass string, blobs storage.BlobStore, meta storage.Met
 	return nil
 }
 
-func cmdDelete(path, id string, blobs storage.BlobStore, meta storage.MetaStore) error {
+func cmdDelete(path, id string, permanent bool, blobs storage.BlobStore, meta storage.MetaStore) error {
 	if id == "" {
 		return errors.New("--id required")
 	}
@@ -379,14 +629,506 @@ func cmdDelete(path, id string, blobs storage.BlobStore, meta storage.MetaStore)
 
 	vlt := vault.NewWithStores(path, blobs, meta)
 	ctx := context.Background()
-	if err := vlt.Unlock(ctx, master); err != nil {
+	if err := unlock(ctx, vlt, master); err != nil {
+		return err
+	}
+	defer vlt.Lock()
+
+	if err := vlt.DeleteItem(ctx, id, 0); err != nil {
+		return err
+	}
+	if permanent {
+		if err := vlt.Purge(ctx, id); err != nil {
+			return err
+		}
+		fmt.Println("Purged item id:", id)
+		return nil
+	}
+	fmt.Println("Moved to trash, item id:", id)
+	return nil
+}
+
+func cmdTrash(path, restore, purge string, empty bool, blobs storage.BlobStore, meta storage.MetaStore) error {
+	master, err := promptSecret("Master password: ")
+	if err != nil {
+		return err
+	}
+	defer zero(master)
+
+	vlt := vault.NewWithStores(path, blobs, meta)
+	ctx := context.Background()
+	if err := unlock(ctx, vlt, master); err != nil {
+		return err
+	}
+	defer vlt.Lock()
+
+	switch {
+	case restore != "":
+		if err := vlt.Restore(ctx, restore); err != nil {
+			return err
+		}
+		fmt.Println("Restored item id:", restore)
+	case purge != "":
+		if err := vlt.Purge(ctx, purge); err != nil {
+			return err
+		}
+		fmt.Println("Purged item id:", purge)
+	case empty:
+		metas, err := vlt.ListTrash(ctx)
+		if err != nil {
+			return err
+		}
+		for _, m := range metas {
+			if err := vlt.Purge(ctx, m.ID); err != nil {
+				return err
+			}
+		}
+		fmt.Println("Purged items:", len(metas))
+	default:
+		metas, err := vlt.ListTrash(ctx)
+		if err != nil {
+			return err
+		}
+		b, _ := json.MarshalIndent(metas, "", "  ")
+		fmt.Println(string(b))
+	}
+	return nil
+}
+
+func cmdFolder(path, create, id, name string, parent *string, del bool, blobs storage.BlobStore, meta storage.MetaStore) error {
+	if create == "" && id == "" && (name != "" || parent != nil || del) {
+		return errors.New("--id required")
+	}
+	master, err := promptSecret("Master password: ")
+	if err != nil {
+		return err
+	}
+	defer zero(master)
+
+	vlt := vault.NewWithStores(path, blobs, meta)
+	ctx := context.Background()
+	if err := unlock(ctx, vlt, master); err != nil {
+		return err
+	}
+	defer vlt.Lock()
+
+	switch {
+	case create != "":
+		var p string
+		if parent != nil {
+			p = *parent
+		}
+		f, err := vlt.CreateFolder(ctx, create, p)
+		if err != nil {
+			return err
+		}
+		fmt.Println("Created folder id:", f.ID)
+	case del:
+		if err := vlt.DeleteFolder(ctx, id); err != nil {
+			return err
+		}
+		fmt.Println("Deleted folder id:", id)
+	case id != "":
+		f, err := vlt.UpdateFolder(ctx, id, name, parent)
+		if err != nil {
+			return err
+		}
+		b, _ := json.MarshalIndent(f, "", "  ")
+		fmt.Println(string(b))
+	default:
+		folders, err := vlt.ListFolders(ctx)
+		if err != nil {
+			return err
+		}
+		b, _ := json.MarshalIndent(folders, "", "  ")
+		fmt.Println(string(b))
+	}
+	return nil
+}
+
+func cmdOrganize(path, id string, org vault.Organization, blobs storage.BlobStore, meta storage.MetaStore) error {
+	if id == "" {
+		return errors.New("--id required")
+	}
+	master, err := promptSecret("Master password: ")
+	if err != nil {
+		return err
+	}
+	defer zero(master)
+
+	vlt := vault.NewWithStores(path, blobs, meta)
+	ctx := context.Background()
+	if err := unlock(ctx, vlt, master); err != nil {
+		return err
+	}
+	defer vlt.Lock()
+
+	if err := vlt.Organize(ctx, id, org, 0); err != nil {
+		return err
+	}
+	fmt.Println("Organized item id:", id)
+	return nil
+}
+
+// splitList splits a comma-separated flag value, returning nil if empty.
+func splitList(s string) []string {
+	var out []string
+	for _, part := range strings.Split(s, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			out = append(out, part)
+		}
+	}
+	return out
+}
+
+// isSet reports whether name was passed explicitly on the command line.
+func isSet(fs *flag.FlagSet, name string) bool {
+	set := false
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
+
+func cmdHealth(path string, blobs storage.BlobStore, meta storage.MetaStore) error {
+	master, err := promptSecret("Master password: ")
+	if err != nil {
+		return err
+	}
+	defer zero(master)
+
+	vlt := vault.NewWithStores(path, blobs, meta)
+	ctx := context.Background()
+	if err := unlock(ctx, vlt, master); err != nil {
+		return err
+	}
+	defer vlt.Lock()
+
+	report, err := vlt.Health(ctx)
+	if err != nil {
+		return err
+	}
+	b, _ := json.MarshalIndent(report, "", "  ")
+	fmt.Println(string(b))
+	return nil
+}
+
+func cmdBackup(path, out string, separate bool, blobs storage.BlobStore, meta storage.MetaStore) error {
+	if out == "" {
+		return errors.New("--out required")
+	}
+	master, err := promptSecret("Master password: ")
+	if err != nil {
+		return err
+	}
+	defer zero(master)
+
+	vlt := vault.NewWithStores(path, blobs, meta)
+	ctx := context.Background()
+	if err := unlock(ctx, vlt, master); err != nil {
 		return err
 	}
 	defer vlt.Lock()
 
-	if err := vlt.DeleteItem(ctx, id); err != nil {
+	pass := master
+	if separate {
+		if pass, err = promptSecret("Backup passphrase: "); err != nil {
+			return err
+		}
+		defer zero(pass)
+		if len(pass) == 0 {
+			return errors.New("empty backup passphrase")
+		}
+	}
+
+	f, err := os.OpenFile(out, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return err
+	}
+	man, err := vlt.Backup(ctx, f, pass)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		_ = os.Remove(out)
+		return err
+	}
+	fmt.Printf("Backed up %d items (%d blobs) to %s\n", man.Items, man.Blobs, out)
+	return nil
+}
+
+func cmdRestore(path, in string, force bool, blobs storage.BlobStore, meta storage.MetaStore) error {
+	if in == "" {
+		return errors.New("--in required")
+	}
+	pass, err := promptSecret("Backup passphrase (the master password unless --separate was used): ")
+	if err != nil {
+		return err
+	}
+	defer zero(pass)
+
+	f, err := os.Open(in)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	man, err := vault.Restore(context.Background(), f, pass, path, blobs, meta, force)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Restored %d items (%d blobs) from a backup taken %s to %s\n",
+		man.Items, man.Blobs, time.Unix(man.Created, 0).Format(time.RFC3339), path)
+	return nil
+}
+
+func cmdImport(path, file, format string, dryRun bool, duplicates string, blobs storage.BlobStore, meta storage.MetaStore) error {
+	if file == "" {
+		return errors.New("--file required")
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	defer zero(data)
+	ctx := context.Background()
+	var f importer.Format
+	if format == "" {
+		f, err = importer.Detect(file, data)
+	} else {
+		f, err = importer.ParseFormat(format)
+	}
+	if err != nil {
+		return err
+	}
+	recs, err := importer.Parse(ctx, f, data, nil)
+	if errors.Is(err, importer.ErrPasswordRequired) {
+		pass, perr := promptSecret("Export password: ")
+		if perr != nil {
+			return perr
+		}
+		recs, err = importer.Parse(ctx, f, data, pass)
+		zero(pass)
+	}
+	if err != nil {
+		return err
+	}
+
+	master, err := promptSecret("Master password: ")
+	if err != nil {
+		return err
+	}
+	defer zero(master)
+
+	vlt := vault.NewWithStores(path, blobs, meta)
+	if err := unlock(ctx, vlt, master); err != nil {
+		return err
+	}
+	defer vlt.Lock()
+
+	report, err := importer.Import(ctx, vlt, recs, importer.Options{DryRun: dryRun, Duplicates: importer.Duplicates(duplicates)})
+	b, _ := json.MarshalIndent(report, "", "  ")
+	fmt.Println(string(b))
+	return err
+}
+
+func cmdTOTP(path, id, field string, blobs storage.BlobStore, meta storage.MetaStore) error {
+	if id == "" {
+		return errors.New("--id required")
+	}
+	master, err := promptSecret("Master password: ")
+	if err != nil {
+		return err
+	}
+	defer zero(master)
+
+	vlt := vault.NewWithStores(path, blobs, meta)
+	ctx := context.Background()
+	if err := unlock(ctx, vlt, master); err != nil {
+		return err
+	}
+	defer vlt.Lock()
+
+	code, err := vlt.OTP(ctx, id, field, true)
+	if err != nil {
+		return err
+	}
+	if code.Remaining > 0 {
+		fmt.Printf("%s (%ds remaining)\n", code.Code, code.Remaining)
+	} else {
+		fmt.Printf("%s (counter %d)\n", code.Code, code.Counter)
+	}
+	return nil
+}
+
+func cmdRekey(path string, blobs storage.BlobStore, meta storage.MetaStore) error {
+	master, err := promptSecret("Master password: ")
+	if err != nil {
+		return err
+	}
+	defer zero(master)
+
+	vlt := vault.NewWithStores(path, blobs, meta)
+	ctx := context.Background()
+	if err := unlock(ctx, vlt, master); err != nil {
 		return err
 	}
-	fmt.Println("Deleted item id:", id)
+	defer vlt.Lock()
+
+	if err := vlt.Rekey(ctx); err != nil {
+		return err
+	}
+	fmt.Println("Vault re-keyed:", path)
+	return nil
+}
+
+func cmdAttach(path, id, file, name, get, out string, blobs storage.BlobStore, meta storage.MetaStore) error {
+	if id == "" {
+		return errors.New("--id required")
+	}
+	if get != "" && out == "" {
+		return errors.New("--out required with --get")
+	}
+
+	master, err := promptSecret("Master password: ")
+	if err != nil {
+		return err
+	}
+	defer zero(master)
+
+	vlt := vault.NewWithStores(path, blobs, meta)
+	ctx := context.Background()
+	if err := unlock(ctx, vlt, master); err != nil {
+		return err
+	}
+	defer vlt.Lock()
+
+	switch {
+	case get != "":
+		f, err := os.OpenFile(out, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if err != nil {
+			return err
+		}
+		if _, err := vlt.ReadAttachment(ctx, id, get, f); err != nil {
+			f.Close()
+			_ = os.Remove(out)
+			return err
+		}
+		if err := f.Close(); err != nil {
+			return err
+		}
+		fmt.Println("Saved attachment to", out)
+
+	case file != "":
+		f, err := os.Open(file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		if name == "" {
+			name = filepath.Base(file)
+		}
+		ctype := mime.TypeByExtension(filepath.Ext(name))
+		if ctype == "" {
+			ctype = "application/octet-stream"
+		}
+		att, err := vlt.AddAttachment(ctx, id, name, ctype, f)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Attached %s (%d bytes) as %s\n", att.Name, att.Size, att.ID)
+
+	default:
+		atts, err := vlt.ListAttachments(ctx, id)
+		if err != nil {
+			return err
+		}
+		b, _ := json.MarshalIndent(atts, "", "  ")
+		fmt.Println(string(b))
+	}
+	return nil
+}
+
+func cmdDetach(path, id, attID string, blobs storage.BlobStore, meta storage.MetaStore) error {
+	if id == "" || attID == "" {
+		return errors.New("--id and --att required")
+	}
+
+	master, err := promptSecret("Master password: ")
+	if err != nil {
+		return err
+	}
+	defer zero(master)
+
+	vlt := vault.NewWithStores(path, blobs, meta)
+	ctx := context.Background()
+	if err := unlock(ctx, vlt, master); err != nil {
+		return err
+	}
+	defer vlt.Lock()
+
+	if err := vlt.DeleteAttachment(ctx, id, attID); err != nil {
+		return err
+	}
+	fmt.Println("Removed attachment:", attID)
+	return nil
+}
+
+func cmdInspect(path string) error {
+	info, err := vault.Inspect(path)
+	if err != nil {
+		return err
+	}
+	b, _ := json.MarshalIndent(info, "", "  ")
+	fmt.Println(string(b))
+	return nil
+}
+
+func cmdHistory(path, id string, show, diff, restore int, blobs storage.BlobStore, meta storage.MetaStore) error {
+	if id == "" {
+		return errors.New("--id required")
+	}
+
+	master, err := promptSecret("Master password: ")
+	if err != nil {
+		return err
+	}
+	defer zero(master)
+
+	vlt := vault.NewWithStores(path, blobs, meta)
+	ctx := context.Background()
+	if err := unlock(ctx, vlt, master); err != nil {
+		return err
+	}
+	defer vlt.Lock()
+
+	var out any
+	switch {
+	case show > 0:
+		out, err = vlt.GetRevision(ctx, id, show)
+	case diff > 0:
+		var from, to vault.Item
+		if from, err = vlt.GetRevision(ctx, id, diff); err != nil {
+			return err
+		}
+		if to, err = vlt.GetItem(ctx, id); err != nil {
+			return err
+		}
+		out = vault.Diff(from, to)
+	case restore > 0:
+		if err := vlt.RestoreRevision(ctx, id, restore); err != nil {
+			return err
+		}
+		fmt.Printf("Restored version %d of id: %s\n", restore, id)
+		return nil
+	default:
+		out, err = vlt.History(ctx, id)
+	}
+	if err != nil {
+		return err
+	}
+	b, _ := json.MarshalIndent(out, "", "  ")
+	fmt.Println(string(b))
 	return nil
 }
@@ -29,6 +29,7 @@ func main() {
 	vaultDir := flag.String("vaultdir", "./vaults", "Directory for user vault files")
 	jwtIssuer := flag.String("issuer", getenvDefault("JWT_ISSUER", "vaultcraft-backend"), "JWT issuer")
 	totpIssuer := flag.String("totp-issuer", getenvDefault("TOTP_ISSUER", "VaultCraft"), "TOTP issuer (for authenticator apps)")
+	breachRange := flag.String("breach", os.Getenv("BREACH_RANGE"), "breached-password range file, directory or local range server URL (optional)")
 	flag.Parse()
 
 	if *mongoURI == "" {
@@ -47,6 +48,7 @@ func main() {
 		JWTIssuer:       *jwtIssuer,
 		TokenTTL:        15 * time.Minute,
 		TOTPIssuer:      *totpIssuer,
+		BreachRange:     strings.TrimSpace(*breachRange),
 		SMTP: srv.SMTPConfig{
 			Host:     strings.TrimSpace(os.Getenv("SMTP_HOST")),
 			Port:     firstNonEmpty(os.Getenv("SMTP_PORT"), "587"),
@@ -0,0 +1,128 @@
+// Package breach checks passwords against a Have I Been Pwned style
+// corpus of SHA-1 hashes without the password leaving the process.
+//
+// Lookups use the k-anonymity range model: only the first five hex
+// characters of the hash select a range, and the remaining suffix is
+// compared locally against every entry in it. The ranges come from a
+// Source, which is a local dataset or a range server on the local network;
+// nothing here talks to the public API unless it is configured to.
+package breach
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// PrefixLen is the number of hex characters of the SHA-1 hash that select
+// a range.
+const PrefixLen = 5
+
+var ErrBadPrefix = errors.New("breach: prefix must be 5 hex characters")
+
+// Source returns the range for a prefix: one "SUFFIX:COUNT" line per hash
+// that starts with it, where SUFFIX is the other 35 hex characters. Entries
+// with a count of zero are padding and never match.
+type Source interface {
+	Range(ctx context.Context, prefix string) (io.ReadCloser, error)
+}
+
+// Hash returns the upper-case hex SHA-1 of pw split into its range prefix
+// and suffix.
+func Hash(pw string) (prefix, suffix string) {
+	sum := sha1.Sum([]byte(pw))
+	h := strings.ToUpper(hex.EncodeToString(sum[:]))
+	return h[:PrefixLen], h[PrefixLen:]
+}
+
+func validPrefix(p string) bool {
+	if len(p) != PrefixLen {
+		return false
+	}
+	_, err := hex.DecodeString(p + "0")
+	return err == nil
+}
+
+// maxCachedRanges bounds the ranges a Checker keeps. Listing a vault looks
+// up every password, and the same few ranges are hit again on refresh.
+const maxCachedRanges = 1024
+
+// Checker looks passwords up in a Source.
+type Checker struct {
+	src Source
+
+	mu    sync.Mutex
+	cache map[string]map[string]int
+}
+
+func New(src Source) *Checker {
+	return &Checker{src: src, cache: map[string]map[string]int{}}
+}
+
+// Count returns how many times pw appears in the corpus, or 0 if it does
+// not.
+func (c *Checker) Count(ctx context.Context, pw string) (int, error) {
+	prefix, suffix := Hash(pw)
+	entries, err := c.lookup(ctx, prefix)
+	if err != nil {
+		return 0, err
+	}
+	return entries[suffix], nil
+}
+
+func (c *Checker) lookup(ctx context.Context, prefix string) (map[string]int, error) {
+	c.mu.Lock()
+	entries, ok := c.cache[prefix]
+	c.mu.Unlock()
+	if ok {
+		return entries, nil
+	}
+
+	rc, err := c.src.Range(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	entries, err = parseRange(rc)
+	if err != nil {
+		return nil, fmt.Errorf("breach: range %s: %w", prefix, err)
+	}
+
+	c.mu.Lock()
+	if len(c.cache) >= maxCachedRanges {
+		c.cache = map[string]map[string]int{}
+	}
+	c.cache[prefix] = entries
+	c.mu.Unlock()
+	return entries, nil
+}
+
+func parseRange(r io.Reader) (map[string]int, error) {
+	out := map[string]int{}
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" {
+			continue
+		}
+		suffix, count, ok := strings.Cut(line, ":")
+		if !ok || len(suffix) != 40-PrefixLen {
+			return nil, fmt.Errorf("bad line %q", line)
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(count))
+		if err != nil {
+			return nil, fmt.Errorf("bad count in %q", line)
+		}
+		if n > 0 {
+			out[strings.ToUpper(suffix)] = n
+		}
+	}
+	return out, sc.Err()
+}
@@ -0,0 +1,114 @@
+package breach
+
+import (
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+var corpus = map[string]int{
+	"password":      9545824,
+	"123456":        37359195,
+	"correcthorse":  2,
+	"hunter2":       30,
+	"letmein":       1000,
+	"trustno1":      500,
+	"iloveyou":      700,
+	"qwertyuiop123": 0, // padding entry, never a match
+}
+
+func sortedFile(t *testing.T) string {
+	t.Helper()
+	var lines []string
+	for pw, n := range corpus {
+		p, s := Hash(pw)
+		lines = append(lines, fmt.Sprintf("%s%s:%d", p, s, n))
+	}
+	// Neighbours sharing a prefix with a real entry exercise range scans.
+	p, _ := Hash("hunter2")
+	lines = append(lines, p+strings.Repeat("0", 35)+":3", p+strings.Repeat("F", 35)+":4")
+	sort.Strings(lines)
+	path := filepath.Join(t.TempDir(), "pwned.txt")
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "\r\n")+"\r\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func dirSource(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	ranges := map[string][]string{}
+	for pw, n := range corpus {
+		p, s := Hash(pw)
+		ranges[p] = append(ranges[p], fmt.Sprintf("%s:%d", s, n))
+	}
+	for p, lines := range ranges {
+		if err := os.WriteFile(filepath.Join(dir, p+".txt"), []byte(strings.Join(lines, "\n")), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func checkCorpus(t *testing.T, c *Checker) {
+	t.Helper()
+	ctx := context.Background()
+	for pw, want := range corpus {
+		got, err := c.Count(ctx, pw)
+		if err != nil {
+			t.Fatalf("Count(%q): %v", pw, err)
+		}
+		if got != want {
+			t.Errorf("Count(%q) = %d, want %d", pw, got, want)
+		}
+	}
+	for _, pw := range []string{"xK9#mQ2$vL7@nR4p", "", "Password"} {
+		if got, err := c.Count(ctx, pw); err != nil || got != 0 {
+			t.Errorf("Count(%q) = %d, %v; want 0", pw, got, err)
+		}
+	}
+}
+
+func TestSources(t *testing.T) {
+	file, dir := sortedFile(t), dirSource(t)
+	for _, path := range []string{file, dir} {
+		src, err := Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkCorpus(t, New(src))
+	}
+
+	srv := httptest.NewServer(Handler(FileSource(file)))
+	defer srv.Close()
+	src, err := Open(srv.URL + "/range/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkCorpus(t, New(src))
+}
+
+func TestFileSourceRange(t *testing.T) {
+	p, s := Hash("hunter2")
+	rc, err := FileSource(sortedFile(t)).Range(context.Background(), strings.ToLower(p))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+	entries, err := parseRange(rc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 3 || entries[s] != 30 {
+		t.Fatalf("range %s = %v", p, entries)
+	}
+	if _, err := FileSource("x").Range(context.Background(), "ZZZZZ"); err != ErrBadPrefix {
+		t.Fatalf("bad prefix: %v", err)
+	}
+}
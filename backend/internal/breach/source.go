@@ -0,0 +1,197 @@
+package breach
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Open returns the Source described by spec: an http:// or https:// URL
+// of a range server, a directory of per-prefix range files, or a single
+// file of full hashes sorted by hash.
+func Open(spec string) (Source, error) {
+	if strings.HasPrefix(spec, "http://") || strings.HasPrefix(spec, "https://") {
+		return &HTTPSource{URL: spec}, nil
+	}
+	fi, err := os.Stat(spec)
+	if err != nil {
+		return nil, err
+	}
+	if fi.IsDir() {
+		return DirSource(spec), nil
+	}
+	return FileSource(spec), nil
+}
+
+// DirSource is a directory holding one range file per prefix, named
+// PREFIX or PREFIX.txt, as the official downloader writes them. A missing
+// file is an empty range.
+type DirSource string
+
+func (d DirSource) Range(_ context.Context, prefix string) (io.ReadCloser, error) {
+	prefix = strings.ToUpper(prefix)
+	if !validPrefix(prefix) {
+		return nil, ErrBadPrefix
+	}
+	for _, name := range []string{prefix + ".txt", prefix, strings.ToLower(prefix) + ".txt"} {
+		f, err := os.Open(filepath.Join(string(d), name))
+		if err == nil {
+			return f, nil
+		}
+		if !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+	}
+	return io.NopCloser(strings.NewReader("")), nil
+}
+
+// FileSource is one file of "HASH:COUNT" lines sorted by hash, the
+// ordered-by-hash download. Ranges are found by binary search, so the file
+// is never read whole.
+type FileSource string
+
+func (p FileSource) Range(_ context.Context, prefix string) (io.ReadCloser, error) {
+	prefix = strings.ToUpper(prefix)
+	if !validPrefix(prefix) {
+		return nil, ErrBadPrefix
+	}
+	f, err := os.Open(string(p))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	size := fi.Size()
+
+	// nextLine returns the first line start at or after off.
+	nextLine := func(off int64) (int64, error) {
+		if off == 0 {
+			return 0, nil
+		}
+		r := bufio.NewReader(io.NewSectionReader(f, off-1, size-off+1))
+		skip, err := r.ReadSlice('\n')
+		if errors.Is(err, io.EOF) {
+			return size, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+		return off - 1 + int64(len(skip)), nil
+	}
+	hashAt := func(off int64) (string, error) {
+		buf := make([]byte, PrefixLen)
+		if _, err := f.ReadAt(buf, off); err != nil && !errors.Is(err, io.EOF) {
+			return "", err
+		}
+		return strings.ToUpper(string(buf)), nil
+	}
+
+	lo, hi := int64(0), size
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+		start, err := nextLine(mid)
+		if err != nil {
+			return nil, err
+		}
+		var before bool
+		if start < size {
+			h, err := hashAt(start)
+			if err != nil {
+				return nil, err
+			}
+			before = h < prefix
+		}
+		if before {
+			lo = mid + 1
+		} else {
+			hi = mid
+		}
+	}
+	start, err := nextLine(lo)
+	if err != nil {
+		return nil, err
+	}
+
+	var out bytes.Buffer
+	sc := bufio.NewScanner(io.NewSectionReader(f, start, size-start))
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if len(line) < 40 || !strings.EqualFold(line[:PrefixLen], prefix) {
+			break
+		}
+		out.WriteString(line[PrefixLen:])
+		out.WriteByte('\n')
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return io.NopCloser(&out), nil
+}
+
+// HTTPSource fetches ranges from a server speaking the range API: GET
+// URL + PREFIX returns the range as text. URL should end in "/range/" or
+// similar.
+type HTTPSource struct {
+	URL    string
+	Client *http.Client
+}
+
+func (h *HTTPSource) Range(ctx context.Context, prefix string) (io.ReadCloser, error) {
+	prefix = strings.ToUpper(prefix)
+	if !validPrefix(prefix) {
+		return nil, ErrBadPrefix
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, h.URL+prefix, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Add-Padding", "true")
+	c := h.Client
+	if c == nil {
+		c = &http.Client{Timeout: 10 * time.Second}
+	}
+	resp, err := c.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("breach: range server: %s", resp.Status)
+	}
+	return resp.Body, nil
+}
+
+// Handler serves ranges from src under /range/PREFIX, so a local dataset
+// can stand in for the public range API.
+func Handler(src Source) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		prefix := r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]
+		rc, err := src.Range(r.Context(), prefix)
+		if errors.Is(err, ErrBadPrefix) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			http.Error(w, "range unavailable", http.StatusInternalServerError)
+			return
+		}
+		defer rc.Close()
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		_, _ = io.Copy(w, rc)
+	})
+}
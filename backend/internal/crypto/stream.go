@@ -0,0 +1,254 @@
+package crypto
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"io"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+// Streams are encrypted with the STREAM construction: the plaintext is
+// split into fixed-size chunks, each sealed with AES-GCM under a nonce of
+//
+//	nonce prefix (7) | chunk counter u32 | final flag (1)
+//
+// The wire format is
+//
+//	salt (32) | nonce prefix (7) | chunk size u32 | chunk ... | final chunk
+//
+// where every chunk but the last holds exactly chunk size bytes of
+// plaintext. The key is derived from the master key and salt with HKDF as
+// in deriveGCMKey, under its own context. Dropped, reordered or duplicated
+// chunks fail authentication, and a stream cut at a chunk boundary fails
+// because the last chunk left was not sealed as final.
+
+const (
+	streamNoncePrefixSize = 7
+	streamHeaderSize      = envelopeSaltSize + streamNoncePrefixSize + 4
+	streamChunkSize       = 64 << 10
+	streamMaxChunkSize    = 16 << 20
+)
+
+var (
+	ErrStreamTruncated = errors.New("crypto: stream truncated")
+	ErrStreamCorrupt   = errors.New("crypto: stream authentication failed")
+)
+
+func deriveStreamKey(masterKey, salt []byte) (cipher.AEAD, error) {
+	if len(masterKey) == 0 {
+		return nil, errors.New("crypto: empty master key")
+	}
+	kdf := hkdf.New(sha256.New, masterKey, salt, []byte("vault/stream/v1"))
+	key := make([]byte, 32)
+	if _, err := io.ReadFull(kdf, key); err != nil {
+		return nil, err
+	}
+	defer Zero(key)
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+type streamNonce [envelopeNonceSize]byte
+
+func (n *streamNonce) set(counter uint32, final bool) []byte {
+	binary.BigEndian.PutUint32(n[streamNoncePrefixSize:], counter)
+	n[envelopeNonceSize-1] = 0
+	if final {
+		n[envelopeNonceSize-1] = 1
+	}
+	return n[:]
+}
+
+type streamWriter struct {
+	w       io.Writer
+	aead    cipher.AEAD
+	aad     []byte
+	nonce   streamNonce
+	counter uint32
+	buf     []byte
+	out     []byte
+	size    int
+	closed  bool
+	err     error
+}
+
+// NewStreamWriter returns a writer that encrypts everything written to it
+// into w. Close must be called to seal the final chunk; it does not close
+// w.
+func NewStreamWriter(w io.Writer, masterKey, aad []byte) (io.WriteCloser, error) {
+	return newStreamWriter(w, masterKey, aad, streamChunkSize)
+}
+
+func newStreamWriter(w io.Writer, masterKey, aad []byte, chunkSize int) (*streamWriter, error) {
+	header := make([]byte, streamHeaderSize)
+	if _, err := rand.Read(header[:envelopeSaltSize+streamNoncePrefixSize]); err != nil {
+		return nil, err
+	}
+	binary.BigEndian.PutUint32(header[envelopeSaltSize+streamNoncePrefixSize:], uint32(chunkSize))
+	aead, err := deriveStreamKey(masterKey, header[:envelopeSaltSize])
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(header); err != nil {
+		return nil, err
+	}
+	sw := &streamWriter{
+		w:    w,
+		aead: aead,
+		aad:  append([]byte(nil), aad...),
+		buf:  make([]byte, 0, chunkSize),
+		out:  make([]byte, 0, chunkSize+envelopeTagSize),
+		size: chunkSize,
+	}
+	copy(sw.nonce[:], header[envelopeSaltSize:envelopeSaltSize+streamNoncePrefixSize])
+	return sw, nil
+}
+
+func (s *streamWriter) Write(p []byte) (int, error) {
+	if s.err != nil {
+		return 0, s.err
+	}
+	if s.closed {
+		return 0, errors.New("crypto: write to closed stream")
+	}
+	n := 0
+	for len(p) > 0 {
+		// A full chunk is only sealed once more data arrives, since the
+		// last chunk has to carry the final flag.
+		if len(s.buf) == s.size {
+			if s.err = s.seal(false); s.err != nil {
+				return n, s.err
+			}
+		}
+		k := copy(s.buf[len(s.buf):s.size], p)
+		s.buf = s.buf[:len(s.buf)+k]
+		p = p[k:]
+		n += k
+	}
+	return n, nil
+}
+
+func (s *streamWriter) Close() error {
+	if s.closed || s.err != nil {
+		return s.err
+	}
+	s.closed = true
+	s.err = s.seal(true)
+	Zero(s.buf[:cap(s.buf)])
+	return s.err
+}
+
+func (s *streamWriter) seal(final bool) error {
+	if !final && s.counter == ^uint32(0) {
+		return errors.New("crypto: stream too long")
+	}
+	s.out = s.aead.Seal(s.out[:0], s.nonce.set(s.counter, final), s.buf, s.aad)
+	s.counter++
+	Zero(s.buf)
+	s.buf = s.buf[:0]
+	_, err := s.w.Write(s.out)
+	return err
+}
+
+type streamReader struct {
+	r       *bufio.Reader
+	aead    cipher.AEAD
+	aad     []byte
+	nonce   streamNonce
+	counter uint32
+	chunk   []byte
+	pt      []byte
+	done    bool
+	err     error
+}
+
+// NewStreamReader returns a reader that decrypts a stream written by
+// NewStreamWriter. Plaintext is only returned after its chunk has been
+// authenticated; Read fails with ErrStreamTruncated or ErrStreamCorrupt
+// if the stream was cut short or tampered with.
+func NewStreamReader(r io.Reader, masterKey, aad []byte) (io.Reader, error) {
+	header := make([]byte, streamHeaderSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil, ErrStreamTruncated
+		}
+		return nil, err
+	}
+	size := int(binary.BigEndian.Uint32(header[envelopeSaltSize+streamNoncePrefixSize:]))
+	if size <= 0 || size > streamMaxChunkSize {
+		return nil, ErrStreamCorrupt
+	}
+	aead, err := deriveStreamKey(masterKey, header[:envelopeSaltSize])
+	if err != nil {
+		return nil, err
+	}
+	sr := &streamReader{
+		r:     bufio.NewReader(r),
+		aead:  aead,
+		aad:   append([]byte(nil), aad...),
+		chunk: make([]byte, size+envelopeTagSize),
+	}
+	copy(sr.nonce[:], header[envelopeSaltSize:envelopeSaltSize+streamNoncePrefixSize])
+	return sr, nil
+}
+
+func (s *streamReader) Read(p []byte) (int, error) {
+	for len(s.pt) == 0 {
+		if s.err != nil {
+			return 0, s.err
+		}
+		if s.done {
+			return 0, io.EOF
+		}
+		s.err = s.next()
+	}
+	n := copy(p, s.pt)
+	s.pt = s.pt[n:]
+	return n, nil
+}
+
+func (s *streamReader) next() error {
+	n, err := io.ReadFull(s.r, s.chunk)
+	final := false
+	switch {
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		final = true
+	case errors.Is(err, io.EOF):
+		return ErrStreamTruncated
+	case err != nil:
+		return err
+	default:
+		if _, err := s.r.Peek(1); errors.Is(err, io.EOF) {
+			final = true
+		} else if err != nil {
+			return err
+		}
+	}
+	if n < envelopeTagSize {
+		return ErrStreamTruncated
+	}
+	pt, err := s.aead.Open(nil, s.nonce.set(s.counter, final), s.chunk[:n], s.aad)
+	if err != nil {
+		// The last chunk present opening as a non-final one means the
+		// stream was cut at a chunk boundary.
+		if final {
+			if _, err := s.aead.Open(nil, s.nonce.set(s.counter, false), s.chunk[:n], s.aad); err == nil {
+				return ErrStreamTruncated
+			}
+		}
+		return ErrStreamCorrupt
+	}
+	s.counter++
+	s.pt = pt
+	s.done = final
+	return nil
+}
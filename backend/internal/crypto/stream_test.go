@@ -0,0 +1,114 @@
+package crypto
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+func sealStream(t *testing.T, key, pt, aad []byte, chunkSize int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w, err := newStreamWriter(&buf, key, aad, chunkSize)
+	if err != nil {
+		t.Fatalf("new writer: %v", err)
+	}
+	// Uneven writes exercise chunk boundaries that do not line up with
+	// the caller's buffers.
+	for rest := pt; len(rest) > 0; {
+		n := min(len(rest), 7)
+		if _, err := w.Write(rest[:n]); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+		rest = rest[n:]
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func openStream(key, ct, aad []byte) ([]byte, error) {
+	r, err := NewStreamReader(bytes.NewReader(ct), key, aad)
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(r)
+}
+
+func TestStreamRoundTrip(t *testing.T) {
+	key := randBytes(t, 32)
+	aad := []byte("attachment:1/a")
+	for _, n := range []int{0, 1, 63, 64, 65, 128, 1000} {
+		pt := randBytes(t, n)
+		ct := sealStream(t, key, pt, aad, 64)
+		out, err := openStream(key, ct, aad)
+		if err != nil {
+			t.Fatalf("len %d: open: %v", n, err)
+		}
+		if !bytes.Equal(out, pt) {
+			t.Fatalf("len %d: plaintext mismatch", n)
+		}
+	}
+}
+
+func TestStreamDefaultWriter(t *testing.T) {
+	key := randBytes(t, 32)
+	pt := randBytes(t, streamChunkSize*2+10)
+	var buf bytes.Buffer
+	w, err := NewStreamWriter(&buf, key, nil)
+	if err != nil {
+		t.Fatalf("new writer: %v", err)
+	}
+	if _, err := w.Write(pt); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	out, err := openStream(key, buf.Bytes(), nil)
+	if err != nil || !bytes.Equal(out, pt) {
+		t.Fatalf("open: %v", err)
+	}
+}
+
+func TestStreamDetectsTampering(t *testing.T) {
+	key := randBytes(t, 32)
+	aad := []byte("ctx")
+	const chunk = 64
+	pt := randBytes(t, chunk*3+10)
+	ct := sealStream(t, key, pt, aad, chunk)
+	body := ct[streamHeaderSize:]
+	sealed := chunk + envelopeTagSize
+
+	cases := map[string]struct {
+		ct   []byte
+		want error
+	}{
+		"cut at chunk boundary": {append(append([]byte(nil), ct[:streamHeaderSize]...), body[:2*sealed]...), ErrStreamTruncated},
+		"final chunk missing":   {ct[:streamHeaderSize+3*sealed], ErrStreamTruncated},
+		"cut mid chunk":         {ct[:len(ct)-5], ErrStreamCorrupt},
+		"header only":           {ct[:streamHeaderSize], ErrStreamTruncated},
+		"chunks swapped": {func() []byte {
+			out := append([]byte(nil), ct[:streamHeaderSize]...)
+			out = append(out, body[sealed:2*sealed]...)
+			out = append(out, body[:sealed]...)
+			return append(out, body[2*sealed:]...)
+		}(), ErrStreamCorrupt},
+		"bit flip": {func() []byte {
+			out := append([]byte(nil), ct...)
+			out[streamHeaderSize+sealed+3] ^= 1
+			return out
+		}(), ErrStreamCorrupt},
+	}
+	for name, tc := range cases {
+		if _, err := openStream(key, tc.ct, aad); !errors.Is(err, tc.want) {
+			t.Errorf("%s: got %v, want %v", name, err, tc.want)
+		}
+	}
+
+	if _, err := openStream(key, ct, []byte("other")); err == nil {
+		t.Error("expected failure with mismatched AAD")
+	}
+}
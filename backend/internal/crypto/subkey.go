@@ -0,0 +1,17 @@
+package crypto
+
+import (
+	"crypto/sha256"
+	"io"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+func DeriveSubkey(masterKey []byte, info string) ([]byte, error) {
+	stream := hkdf.New(sha256.New, masterKey, nil, []byte(info))
+	key := make([]byte, 32)
+	if _, err := io.ReadFull(stream, key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
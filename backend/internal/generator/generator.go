@@ -0,0 +1,201 @@
+// Package generator creates random passwords and passphrases.
+//
+// All sampling uses crypto/rand with rejection, so every character or word
+// is equally likely regardless of the alphabet size.
+package generator
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strings"
+
+	"project-crypto/internal/wordlist"
+)
+
+const (
+	Lower   = "abcdefghijklmnopqrstuvwxyz"
+	Upper   = "ABCDEFGHIJKLMNOPQRSTUVWXYZ"
+	Digits  = "0123456789"
+	Symbols = "!@#$%^&*()-_=+[]{}<>?/|~.,;:"
+
+	// Ambiguous characters are easily confused when read or typed.
+	Ambiguous = "0O1lI|`'\".,;:"
+
+	MinLength = 4
+	MaxLength = 256
+	MaxWords  = 32
+)
+
+var ErrInvalidOptions = errors.New("generator: invalid options")
+
+// Options describes a random password. With no class set, all four are
+// used. Every enabled class contributes at least one character.
+type Options struct {
+	Length         int    `json:"length"`
+	Lower          bool   `json:"lower"`
+	Upper          bool   `json:"upper"`
+	Digits         bool   `json:"digits"`
+	Symbols        bool   `json:"symbols"`
+	AvoidAmbiguous bool   `json:"avoid_ambiguous"`
+	Exclude        string `json:"exclude,omitempty"`
+}
+
+// PassphraseOptions describes a diceware-style passphrase drawn from the
+// embedded wordlist.
+type PassphraseOptions struct {
+	Words      int    `json:"words"`
+	Separator  string `json:"separator"`
+	Capitalize bool   `json:"capitalize"`
+	Number     bool   `json:"number"` // append a random digit to one word
+}
+
+// Result is a generated secret and its entropy in bits, assuming the
+// attacker knows the options used to make it.
+type Result struct {
+	Value   string  `json:"value"`
+	Entropy float64 `json:"entropy"`
+}
+
+func DefaultOptions() Options {
+	return Options{Length: 20, Lower: true, Upper: true, Digits: true, Symbols: true}
+}
+
+func DefaultPassphraseOptions() PassphraseOptions {
+	return PassphraseOptions{Words: 6, Separator: "-"}
+}
+
+// Password generates a password from o.
+func Password(o Options) (Result, error) {
+	if o.Length < MinLength || o.Length > MaxLength {
+		return Result{}, fmt.Errorf("%w: length must be %d to %d", ErrInvalidOptions, MinLength, MaxLength)
+	}
+	if !o.Lower && !o.Upper && !o.Digits && !o.Symbols {
+		o.Lower, o.Upper, o.Digits, o.Symbols = true, true, true, true
+	}
+	var classes []string
+	for _, c := range []struct {
+		on  bool
+		set string
+	}{{o.Lower, Lower}, {o.Upper, Upper}, {o.Digits, Digits}, {o.Symbols, Symbols}} {
+		if !c.on {
+			continue
+		}
+		set := strip(c.set, o.Exclude)
+		if o.AvoidAmbiguous {
+			set = strip(set, Ambiguous)
+		}
+		if set == "" {
+			return Result{}, fmt.Errorf("%w: exclusions remove a whole character class", ErrInvalidOptions)
+		}
+		classes = append(classes, set)
+	}
+	if len(classes) > o.Length {
+		return Result{}, fmt.Errorf("%w: length is shorter than the number of required classes", ErrInvalidOptions)
+	}
+	alphabet := strings.Join(classes, "")
+
+	out := make([]byte, 0, o.Length)
+	for _, set := range classes {
+		ch, err := pick(set)
+		if err != nil {
+			return Result{}, err
+		}
+		out = append(out, ch)
+	}
+	for len(out) < o.Length {
+		ch, err := pick(alphabet)
+		if err != nil {
+			return Result{}, err
+		}
+		out = append(out, ch)
+	}
+	if err := shuffle(out); err != nil {
+		return Result{}, err
+	}
+	return Result{Value: string(out), Entropy: round(float64(o.Length) * math.Log2(float64(len(alphabet))))}, nil
+}
+
+// Passphrase generates a passphrase from o.
+func Passphrase(o PassphraseOptions) (Result, error) {
+	if o.Words < 1 || o.Words > MaxWords {
+		return Result{}, fmt.Errorf("%w: words must be 1 to %d", ErrInvalidOptions, MaxWords)
+	}
+	words := make([]string, o.Words)
+	for i := range words {
+		n, err := uniform(len(wordlist.English))
+		if err != nil {
+			return Result{}, err
+		}
+		words[i] = wordlist.English[n]
+		if o.Capitalize {
+			words[i] = strings.ToUpper(words[i][:1]) + words[i][1:]
+		}
+	}
+	bits := float64(o.Words) * math.Log2(float64(len(wordlist.English)))
+	if o.Number {
+		w, err := uniform(len(words))
+		if err != nil {
+			return Result{}, err
+		}
+		d, err := uniform(10)
+		if err != nil {
+			return Result{}, err
+		}
+		words[w] += Digits[d : d+1]
+		bits += math.Log2(float64(10 * len(words)))
+	}
+	return Result{Value: strings.Join(words, o.Separator), Entropy: round(bits)}, nil
+}
+
+// WordlistSize is the number of words passphrases are drawn from.
+func WordlistSize() int { return len(wordlist.English) }
+
+// uniform returns a uniformly random integer in [0, n).
+func uniform(n int) (int, error) {
+	v, err := rand.Int(rand.Reader, big.NewInt(int64(n)))
+	if err != nil {
+		return 0, err
+	}
+	return int(v.Int64()), nil
+}
+
+func pick(set string) (byte, error) {
+	i, err := uniform(len(set))
+	if err != nil {
+		return 0, err
+	}
+	return set[i], nil
+}
+
+// shuffle is a Fisher-Yates shuffle, so required characters do not sit at
+// predictable positions.
+func shuffle(b []byte) error {
+	for i := len(b) - 1; i > 0; i-- {
+		j, err := uniform(i + 1)
+		if err != nil {
+			return err
+		}
+		b[i], b[j] = b[j], b[i]
+	}
+	return nil
+}
+
+func strip(set, remove string) string {
+	if remove == "" {
+		return set
+	}
+	var b strings.Builder
+	for i := 0; i < len(set); i++ {
+		if !strings.ContainsRune(remove, rune(set[i])) {
+			b.WriteByte(set[i])
+		}
+	}
+	return b.String()
+}
+
+func round(bits float64) float64 {
+	return math.Round(bits*10) / 10
+}
@@ -0,0 +1,115 @@
+package generator
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestPasswordClassesAndExclusions(t *testing.T) {
+	for i := 0; i < 200; i++ {
+		r, err := Password(Options{Length: 8, Lower: true, Digits: true, AvoidAmbiguous: true, Exclude: "xyz"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(r.Value) != 8 {
+			t.Fatalf("length %d", len(r.Value))
+		}
+		if !strings.ContainsAny(r.Value, Lower) || !strings.ContainsAny(r.Value, Digits) {
+			t.Fatalf("%q is missing a required class", r.Value)
+		}
+		if strings.ContainsAny(r.Value, Upper+Symbols+"xyz01l") {
+			t.Fatalf("%q contains an excluded character", r.Value)
+		}
+	}
+
+	r, _ := Password(DefaultOptions())
+	if r.Entropy < 120 || r.Entropy > 135 {
+		t.Fatalf("entropy for 20 chars from %d symbols = %v", len(Lower+Upper+Digits+Symbols), r.Entropy)
+	}
+
+	for _, o := range []Options{
+		{Length: 2},
+		{Length: MaxLength + 1},
+		{Length: 10, Digits: true, Exclude: Digits},
+	} {
+		if _, err := Password(o); !errors.Is(err, ErrInvalidOptions) {
+			t.Errorf("%+v: expected ErrInvalidOptions, got %v", o, err)
+		}
+	}
+}
+
+// TestPasswordIsUnbiased checks that every character of a 10 symbol
+// alphabet turns up close to equally often. A modulo-biased sampler over
+// bytes would favour the first six digits by about 4%.
+func TestPasswordIsUnbiased(t *testing.T) {
+	counts := map[rune]int{}
+	const n = 200
+	for i := 0; i < n; i++ {
+		r, err := Password(Options{Length: 100, Digits: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, c := range r.Value {
+			counts[c]++
+		}
+	}
+	for _, c := range Digits {
+		if got := counts[c]; got < 1800 || got > 2200 {
+			t.Errorf("digit %c drawn %d times, want about 2000", c, got)
+		}
+	}
+}
+
+func TestPassphrase(t *testing.T) {
+	if WordlistSize() != 2048 {
+		t.Fatalf("wordlist has %d words", WordlistSize())
+	}
+	r, err := Passphrase(PassphraseOptions{Words: 5, Separator: ".", Capitalize: true, Number: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	words := strings.Split(r.Value, ".")
+	if len(words) != 5 {
+		t.Fatalf("%q: want 5 words", r.Value)
+	}
+	for _, w := range words {
+		if w[0] < 'A' || w[0] > 'Z' {
+			t.Fatalf("%q is not capitalized", w)
+		}
+	}
+	if !strings.ContainsAny(r.Value, Digits) {
+		t.Fatalf("%q has no digit", r.Value)
+	}
+	if r.Entropy < 55 || r.Entropy > 62 {
+		t.Fatalf("entropy = %v", r.Entropy)
+	}
+}
+
+func TestFromSpec(t *testing.T) {
+	cases := []struct {
+		spec  string
+		check func(string) bool
+	}{
+		{"gen:20", func(s string) bool { return len(s) == 20 }},
+		{"gen:", func(s string) bool { return len(s) == 20 }},
+		{"gen:12:digits", func(s string) bool { return len(s) == 12 && strings.Trim(s, Digits) == "" }},
+		{"gen:30:lower,symbols,exclude=!@#,", func(s string) bool { return !strings.ContainsAny(s, "!@#,"+Upper+Digits) }},
+		{"gen:words:4", func(s string) bool { return strings.Count(s, "-") == 3 }},
+		{"gen:words:3:sep=_,caps", func(s string) bool { return strings.Count(s, "_") == 2 && s[0] >= 'A' && s[0] <= 'Z' }},
+	}
+	for _, c := range cases {
+		r, err := FromSpec(c.spec)
+		if err != nil {
+			t.Fatalf("%s: %v", c.spec, err)
+		}
+		if !c.check(r.Value) {
+			t.Errorf("%s: unexpected %q", c.spec, r.Value)
+		}
+	}
+	for _, bad := range []string{"gen:abc", "gen:10:purple", "gen:words:x", "gen:words:3:shout", "gen:words:0"} {
+		if _, err := FromSpec(bad); !errors.Is(err, ErrInvalidOptions) {
+			t.Errorf("%s: expected ErrInvalidOptions, got %v", bad, err)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package generator
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// FromSpec generates a secret from a compact spec, as accepted by
+// vaultctl's --pass flag. The "gen:" prefix is optional.
+//
+//	gen:20                          20 characters from all classes
+//	gen:16:lower,digits,noambiguous 16 characters, lowercase and digits only
+//	gen:24:exclude=<>{}             exclude takes the rest of the spec
+//	gen:words:6                     six words joined by "-"
+//	gen:words:5:sep=.,caps,number   five capitalized words with one digit
+func FromSpec(spec string) (Result, error) {
+	spec = strings.TrimPrefix(spec, "gen:")
+	head, opts, _ := strings.Cut(spec, ":")
+
+	if head == "words" {
+		o := DefaultPassphraseOptions()
+		count, rest, _ := strings.Cut(opts, ":")
+		if count != "" {
+			n, err := strconv.Atoi(count)
+			if err != nil {
+				return Result{}, fmt.Errorf("%w: bad word count %q", ErrInvalidOptions, count)
+			}
+			o.Words = n
+		}
+		for _, opt := range splitOpts(rest) {
+			switch {
+			case strings.HasPrefix(opt, "sep="):
+				o.Separator = strings.TrimPrefix(opt, "sep=")
+			case opt == "caps":
+				o.Capitalize = true
+			case opt == "number":
+				o.Number = true
+			default:
+				return Result{}, fmt.Errorf("%w: unknown passphrase option %q", ErrInvalidOptions, opt)
+			}
+		}
+		return Passphrase(o)
+	}
+
+	o := Options{Length: DefaultOptions().Length}
+	if head != "" {
+		n, err := strconv.Atoi(head)
+		if err != nil {
+			return Result{}, fmt.Errorf("%w: bad length %q", ErrInvalidOptions, head)
+		}
+		o.Length = n
+	}
+	if i := strings.Index(opts, "exclude="); i >= 0 {
+		o.Exclude = opts[i+len("exclude="):]
+		opts = opts[:i]
+	}
+	for _, opt := range splitOpts(opts) {
+		switch opt {
+		case "lower":
+			o.Lower = true
+		case "upper":
+			o.Upper = true
+		case "digits":
+			o.Digits = true
+		case "symbols":
+			o.Symbols = true
+		case "noambiguous":
+			o.AvoidAmbiguous = true
+		default:
+			return Result{}, fmt.Errorf("%w: unknown password option %q", ErrInvalidOptions, opt)
+		}
+	}
+	return Password(o)
+}
+
+func splitOpts(s string) []string {
+	var out []string
+	for _, opt := range strings.Split(s, ",") {
+		if opt = strings.TrimSpace(opt); opt != "" {
+			out = append(out, opt)
+		}
+	}
+	return out
+}
@@ -0,0 +1,225 @@
+package importer
+
+import (
+	"context"
+	"encoding/binary"
+	"hash"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+// argon2dKey derives a key with Argon2d version 0x13 (RFC 9106), the
+// default KDF of KeePass databases. golang.org/x/crypto/argon2 only exports
+// Argon2i and Argon2id, and Argon2d differs from both in using
+// data-dependent addressing throughout, so it is implemented here. It runs
+// the lanes one after another; an import is a one-off. ctx is checked
+// between slices, so a costly database can be abandoned.
+func argon2dKey(ctx context.Context, password, salt, secret, data []byte, time, memory uint32, threads uint32, keyLen uint32) ([]byte, error) {
+	const mode = 0 // Argon2d
+	h0 := argon2InitHash(password, salt, secret, data, time, memory, threads, keyLen, mode)
+	memory = memory / (argon2SyncPoints * threads) * (argon2SyncPoints * threads)
+	if memory < 2*argon2SyncPoints*threads {
+		memory = 2 * argon2SyncPoints * threads
+	}
+	B := argon2InitBlocks(&h0, memory, threads)
+
+	lanes := memory / threads
+	segments := lanes / argon2SyncPoints
+	for n := uint32(0); n < time; n++ {
+		for slice := uint32(0); slice < argon2SyncPoints; slice++ {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+			for lane := uint32(0); lane < threads; lane++ {
+				index := uint32(0)
+				if n == 0 && slice == 0 {
+					index = 2
+				}
+				offset := lane*lanes + slice*segments + index
+				for ; index < segments; index, offset = index+1, offset+1 {
+					prev := offset - 1
+					if index == 0 && slice == 0 {
+						prev += lanes
+					}
+					ref := argon2IndexAlpha(B[prev][0], lanes, segments, threads, n, slice, lane, index)
+					argon2ProcessBlock(&B[offset], &B[prev], &B[ref], n > 0)
+				}
+			}
+		}
+	}
+
+	for lane := uint32(0); lane < threads-1; lane++ {
+		for i, w := range B[lane*lanes+lanes-1] {
+			B[memory-1][i] ^= w
+		}
+	}
+	var last [1024]byte
+	for i, w := range B[memory-1] {
+		binary.LittleEndian.PutUint64(last[i*8:], w)
+	}
+	key := make([]byte, keyLen)
+	blake2bLong(key, last[:])
+	return key, nil
+}
+
+const argon2SyncPoints = 4
+
+type argon2Block [128]uint64
+
+func argon2InitHash(password, salt, secret, data []byte, time, memory, threads, keyLen uint32, mode int) [blake2b.Size + 8]byte {
+	var h0 [blake2b.Size + 8]byte
+	var params [24]byte
+	b2, _ := blake2b.New512(nil)
+	binary.LittleEndian.PutUint32(params[0:4], threads)
+	binary.LittleEndian.PutUint32(params[4:8], keyLen)
+	binary.LittleEndian.PutUint32(params[8:12], memory)
+	binary.LittleEndian.PutUint32(params[12:16], time)
+	binary.LittleEndian.PutUint32(params[16:20], 0x13)
+	binary.LittleEndian.PutUint32(params[20:24], uint32(mode))
+	b2.Write(params[:])
+	for _, in := range [][]byte{password, salt, secret, data} {
+		var n [4]byte
+		binary.LittleEndian.PutUint32(n[:], uint32(len(in)))
+		b2.Write(n[:])
+		b2.Write(in)
+	}
+	b2.Sum(h0[:0])
+	return h0
+}
+
+func argon2InitBlocks(h0 *[blake2b.Size + 8]byte, memory, threads uint32) []argon2Block {
+	var buf [1024]byte
+	B := make([]argon2Block, memory)
+	for lane := uint32(0); lane < threads; lane++ {
+		j := lane * (memory / threads)
+		binary.LittleEndian.PutUint32(h0[blake2b.Size+4:], lane)
+		for k := uint32(0); k < 2; k++ {
+			binary.LittleEndian.PutUint32(h0[blake2b.Size:], k)
+			blake2bLong(buf[:], h0[:])
+			for i := range B[j+k] {
+				B[j+k][i] = binary.LittleEndian.Uint64(buf[i*8:])
+			}
+		}
+	}
+	return B
+}
+
+// argon2IndexAlpha maps the pseudo-random value of a block onto the index
+// of the block it is mixed with.
+func argon2IndexAlpha(rand uint64, lanes, segments, threads, n, slice, lane, index uint32) uint32 {
+	refLane := uint32(rand>>32) % threads
+	if n == 0 && slice == 0 {
+		refLane = lane
+	}
+	m, s := 3*segments, ((slice+1)%argon2SyncPoints)*segments
+	if lane == refLane {
+		m += index
+	}
+	if n == 0 {
+		m, s = slice*segments, 0
+		if slice == 0 || lane == refLane {
+			m += index
+		}
+	}
+	if index == 0 || lane == refLane {
+		m--
+	}
+	p := rand & 0xFFFFFFFF
+	p = (p * p) >> 32
+	p = (p * uint64(m)) >> 32
+	return refLane*lanes + uint32((uint64(s)+uint64(m)-(p+1))%uint64(lanes))
+}
+
+// argon2ProcessBlock sets out to the compression of in1 and in2, or XORs
+// it in on passes after the first.
+func argon2ProcessBlock(out, in1, in2 *argon2Block, xor bool) {
+	var t argon2Block
+	for i := range t {
+		t[i] = in1[i] ^ in2[i]
+	}
+	var v [16]*uint64
+	for i := 0; i < 128; i += 16 {
+		for j := range v {
+			v[j] = &t[i+j]
+		}
+		blamka(&v)
+	}
+	for i := 0; i < 16; i += 2 {
+		for j := 0; j < 8; j++ {
+			v[2*j] = &t[i+16*j]
+			v[2*j+1] = &t[i+16*j+1]
+		}
+		blamka(&v)
+	}
+	for i := range t {
+		w := in1[i] ^ in2[i] ^ t[i]
+		if xor {
+			out[i] ^= w
+		} else {
+			out[i] = w
+		}
+	}
+}
+
+// blamka is the BLAKE2b round with the multiplication-hardened G function.
+func blamka(v *[16]*uint64) {
+	g := func(a, b, c, d *uint64) {
+		f := func(x, y uint64) uint64 { return x + y + 2*uint64(uint32(x))*uint64(uint32(y)) }
+		*a = f(*a, *b)
+		*d ^= *a
+		*d = *d>>32 | *d<<32
+		*c = f(*c, *d)
+		*b ^= *c
+		*b = *b>>24 | *b<<40
+		*a = f(*a, *b)
+		*d ^= *a
+		*d = *d>>16 | *d<<48
+		*c = f(*c, *d)
+		*b ^= *c
+		*b = *b>>63 | *b<<1
+	}
+	g(v[0], v[4], v[8], v[12])
+	g(v[1], v[5], v[9], v[13])
+	g(v[2], v[6], v[10], v[14])
+	g(v[3], v[7], v[11], v[15])
+	g(v[0], v[5], v[10], v[15])
+	g(v[1], v[6], v[11], v[12])
+	g(v[2], v[7], v[8], v[13])
+	g(v[3], v[4], v[9], v[14])
+}
+
+// blake2bLong is the variable-length hash H' of RFC 9106.
+func blake2bLong(out, in []byte) {
+	var b2 hash.Hash
+	if n := len(out); n < blake2b.Size {
+		b2, _ = blake2b.New(n, nil)
+	} else {
+		b2, _ = blake2b.New512(nil)
+	}
+	var buf [blake2b.Size]byte
+	binary.LittleEndian.PutUint32(buf[:4], uint32(len(out)))
+	b2.Write(buf[:4])
+	b2.Write(in)
+	if len(out) <= blake2b.Size {
+		b2.Sum(out[:0])
+		return
+	}
+	outLen := len(out)
+	b2.Sum(buf[:0])
+	b2.Reset()
+	copy(out, buf[:32])
+	out = out[32:]
+	for len(out) > blake2b.Size {
+		b2.Write(buf[:])
+		b2.Sum(buf[:0])
+		copy(out, buf[:32])
+		out = out[32:]
+		b2.Reset()
+	}
+	if outLen%blake2b.Size > 0 {
+		r := (outLen+31)/32 - 2
+		b2, _ = blake2b.New(outLen-32*r, nil)
+	}
+	b2.Write(buf[:])
+	b2.Sum(out[:0])
+}
@@ -0,0 +1,338 @@
+package importer
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/hkdf"
+	"golang.org/x/crypto/pbkdf2"
+
+	cr "project-crypto/internal/crypto"
+	"project-crypto/internal/vault"
+)
+
+// bwExport is a Bitwarden JSON export. A password-protected export keeps
+// the plain export, encrypted, in Data.
+type bwExport struct {
+	Encrypted         bool       `json:"encrypted"`
+	PasswordProtected bool       `json:"passwordProtected"`
+	Salt              string     `json:"salt"`
+	KdfType           int        `json:"kdfType"`
+	KdfIterations     uint32     `json:"kdfIterations"`
+	KdfMemory         uint32     `json:"kdfMemory"`
+	KdfParallelism    uint8      `json:"kdfParallelism"`
+	KeyValidation     string     `json:"encKeyValidation_DO_NOT_EDIT"`
+	Data              string     `json:"data"`
+	Folders           []bwFolder `json:"folders"`
+	Items             []bwItem   `json:"items"`
+}
+
+type bwFolder struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type bwItem struct {
+	Type     int       `json:"type"`
+	Name     string    `json:"name"`
+	Notes    string    `json:"notes"`
+	Favorite bool      `json:"favorite"`
+	FolderID string    `json:"folderId"`
+	Fields   []bwField `json:"fields"`
+	Login    *struct {
+		URIs []struct {
+			URI string `json:"uri"`
+		} `json:"uris"`
+		Username string `json:"username"`
+		Password string `json:"password"`
+		TOTP     string `json:"totp"`
+	} `json:"login"`
+	Card *struct {
+		CardholderName string `json:"cardholderName"`
+		Brand          string `json:"brand"`
+		Number         string `json:"number"`
+		ExpMonth       string `json:"expMonth"`
+		ExpYear        string `json:"expYear"`
+		Code           string `json:"code"`
+	} `json:"card"`
+	Identity *struct {
+		Title          string `json:"title"`
+		FirstName      string `json:"firstName"`
+		MiddleName     string `json:"middleName"`
+		LastName       string `json:"lastName"`
+		Address1       string `json:"address1"`
+		Address2       string `json:"address2"`
+		Address3       string `json:"address3"`
+		City           string `json:"city"`
+		State          string `json:"state"`
+		PostalCode     string `json:"postalCode"`
+		Country        string `json:"country"`
+		Company        string `json:"company"`
+		Email          string `json:"email"`
+		Phone          string `json:"phone"`
+		SSN            string `json:"ssn"`
+		Username       string `json:"username"`
+		PassportNumber string `json:"passportNumber"`
+		LicenseNumber  string `json:"licenseNumber"`
+	} `json:"identity"`
+	SSHKey *struct {
+		PrivateKey     string `json:"privateKey"`
+		PublicKey      string `json:"publicKey"`
+		KeyFingerprint string `json:"keyFingerprint"`
+	} `json:"sshKey"`
+}
+
+type bwField struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+	Type  int    `json:"type"`
+}
+
+const (
+	bwLogin = 1 + iota
+	bwNote
+	bwCard
+	bwIdentity
+	bwSSHKey
+)
+
+const (
+	bwKdfPBKDF2   = 0
+	bwKdfArgon2id = 1
+)
+
+// Upper bounds on the KDF parameters of an export, the largest Bitwarden
+// clients offer. The parameters come from the uploaded file, so anything
+// above them is refused before deriving rather than left to tie up the
+// server.
+const (
+	bwMaxPBKDF2Iterations = 2_000_000
+	bwMaxArgon2Iterations = 10
+	bwMaxArgon2Memory     = 1024 // MiB
+	bwMaxArgon2Threads    = 16
+)
+
+func parseBitwarden(data, password []byte) ([]Record, error) {
+	var exp bwExport
+	if err := json.Unmarshal(data, &exp); err != nil {
+		return nil, fmt.Errorf("importer: bitwarden: %w", err)
+	}
+	if exp.Encrypted {
+		if !exp.PasswordProtected {
+			return nil, errors.New("importer: bitwarden: account-encrypted exports can only be read by Bitwarden; export as password protected or unencrypted JSON")
+		}
+		plain, err := bwDecryptExport(exp, password)
+		if err != nil {
+			return nil, err
+		}
+		defer cr.Zero(plain)
+		exp = bwExport{}
+		if err := json.Unmarshal(plain, &exp); err != nil {
+			return nil, fmt.Errorf("importer: bitwarden: %w", err)
+		}
+	}
+
+	// Bitwarden nests folders by name: "Work/Servers" is Servers in Work.
+	folders := make(map[string]string, len(exp.Folders))
+	for _, f := range exp.Folders {
+		folders[f.ID] = cleanFolder(f.Name)
+	}
+	out := make([]Record, 0, len(exp.Items))
+	for _, it := range exp.Items {
+		rec := bwRecord(it)
+		rec.Folder = folders[it.FolderID]
+		rec.Favorite = it.Favorite
+		out = append(out, rec)
+	}
+	return out, nil
+}
+
+func bwRecord(it bwItem) Record {
+	var b *builder
+	switch {
+	case it.Type == bwLogin && it.Login != nil:
+		b = newBuilder("login", it.Name)
+		l := it.Login
+		b.set("username", l.Username)
+		b.set("password", l.Password)
+		for i, u := range l.URIs {
+			if i == 0 {
+				b.set("site", u.URI)
+			} else {
+				b.custom("Website", vault.KindURL, u.URI)
+			}
+		}
+		b.totp(l.TOTP)
+	case it.Type == bwCard && it.Card != nil:
+		b = newBuilder("card", it.Name)
+		c := it.Card
+		b.set("cardholder", c.CardholderName)
+		b.set("number", c.Number)
+		b.set("exp_month", c.ExpMonth)
+		b.set("exp_year", c.ExpYear)
+		b.set("cvv", c.Code)
+		b.set("network", c.Brand)
+	case it.Type == bwIdentity && it.Identity != nil:
+		b = newBuilder("identity", it.Name)
+		id := it.Identity
+		name := joinNonEmpty(" ", id.FirstName, id.MiddleName, id.LastName)
+		if name == "" {
+			name = it.Name
+		}
+		b.set("name", name)
+		b.set("email", id.Email)
+		b.set("phone", id.Phone)
+		b.set("address", joinNonEmpty(", ", id.Address1, id.Address2, id.Address3, id.City,
+			joinNonEmpty(" ", id.State, id.PostalCode), id.Country))
+		b.set("passport_number", id.PassportNumber)
+		b.set("national_id", id.SSN)
+		b.custom("Salutation", vault.KindText, id.Title)
+		b.custom("Company", vault.KindText, id.Company)
+		b.custom("Username", vault.KindText, id.Username)
+		b.custom("License number", vault.KindHidden, id.LicenseNumber)
+	case it.Type == bwSSHKey && it.SSHKey != nil:
+		b = newBuilder("ssh_key", it.Name)
+		b.set("private_key", it.SSHKey.PrivateKey)
+		b.set("public_key", it.SSHKey.PublicKey)
+		b.set("fingerprint", it.SSHKey.KeyFingerprint)
+	default:
+		b = newBuilder("note", it.Name)
+	}
+	b.set("notes", it.Notes)
+	for _, f := range it.Fields {
+		switch f.Type {
+		case 0, 2: // text, boolean
+			b.custom(f.Name, vault.KindText, f.Value)
+		case 1: // hidden
+			b.custom(f.Name, vault.KindHidden, f.Value)
+		}
+		// Linked fields (3) only point at another field of the item.
+	}
+	return b.record()
+}
+
+func joinNonEmpty(sep string, parts ...string) string {
+	var out []string
+	for _, p := range parts {
+		if p = strings.TrimSpace(p); p != "" {
+			out = append(out, p)
+		}
+	}
+	return strings.Join(out, sep)
+}
+
+// bwDecryptExport opens a password-protected export. The password is
+// stretched with the export's KDF, expanded into encryption and MAC keys
+// with HKDF, and checked against the key validation string before the data
+// is decrypted.
+func bwDecryptExport(exp bwExport, password []byte) ([]byte, error) {
+	if len(password) == 0 {
+		return nil, ErrPasswordRequired
+	}
+	var master []byte
+	switch exp.KdfType {
+	case bwKdfPBKDF2:
+		if exp.KdfIterations == 0 {
+			return nil, errors.New("importer: bitwarden: missing KDF iterations")
+		}
+		if exp.KdfIterations > bwMaxPBKDF2Iterations {
+			return nil, errors.New("importer: bitwarden: unsupported KDF iterations")
+		}
+		master = pbkdf2.Key(password, []byte(exp.Salt), int(exp.KdfIterations), 32, sha256.New)
+	case bwKdfArgon2id:
+		if exp.KdfIterations == 0 || exp.KdfMemory == 0 || exp.KdfParallelism == 0 {
+			return nil, errors.New("importer: bitwarden: missing KDF parameters")
+		}
+		if exp.KdfIterations > bwMaxArgon2Iterations || exp.KdfMemory > bwMaxArgon2Memory || exp.KdfParallelism > bwMaxArgon2Threads {
+			return nil, errors.New("importer: bitwarden: unsupported KDF parameters")
+		}
+		salt := sha256.Sum256([]byte(exp.Salt))
+		master = argon2.IDKey(password, salt[:], exp.KdfIterations, exp.KdfMemory*1024, exp.KdfParallelism, 32)
+	default:
+		return nil, fmt.Errorf("importer: bitwarden: unknown KDF type %d", exp.KdfType)
+	}
+	defer cr.Zero(master)
+
+	encKey, macKey := make([]byte, 32), make([]byte, 32)
+	defer cr.Zero(encKey)
+	defer cr.Zero(macKey)
+	if _, err := io.ReadFull(hkdf.Expand(sha256.New, master, []byte("enc")), encKey); err != nil {
+		return nil, err
+	}
+	if _, err := io.ReadFull(hkdf.Expand(sha256.New, master, []byte("mac")), macKey); err != nil {
+		return nil, err
+	}
+
+	check, err := bwDecrypt(exp.KeyValidation, encKey, macKey)
+	if err != nil {
+		return nil, err
+	}
+	cr.Zero(check)
+	return bwDecrypt(exp.Data, encKey, macKey)
+}
+
+// bwDecrypt opens a type 2 EncString, "2.IV|CIPHERTEXT|MAC" in base64:
+// AES-256-CBC with an HMAC-SHA256 over the IV and ciphertext.
+func bwDecrypt(s string, encKey, macKey []byte) ([]byte, error) {
+	typ, body, ok := strings.Cut(s, ".")
+	if !ok || typ != "2" {
+		return nil, fmt.Errorf("importer: bitwarden: unsupported cipher string type %q", typ)
+	}
+	parts := strings.Split(body, "|")
+	if len(parts) != 3 {
+		return nil, ErrBadPassword
+	}
+	var raw [3][]byte
+	for i, p := range parts {
+		b, err := base64.StdEncoding.DecodeString(p)
+		if err != nil {
+			return nil, ErrBadPassword
+		}
+		raw[i] = b
+	}
+	iv, ct, tag := raw[0], raw[1], raw[2]
+	m := hmac.New(sha256.New, macKey)
+	m.Write(iv)
+	m.Write(ct)
+	if !hmac.Equal(m.Sum(nil), tag) {
+		return nil, ErrBadPassword
+	}
+	return cbcDecrypt(encKey, iv, ct)
+}
+
+func cbcDecrypt(key, iv, ct []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cbcOpen(block, iv, ct)
+}
+
+// cbcOpen decrypts CBC with PKCS#7 padding.
+func cbcOpen(block cipher.Block, iv, ct []byte) ([]byte, error) {
+	bs := block.BlockSize()
+	if len(iv) != bs || len(ct) == 0 || len(ct)%bs != 0 {
+		return nil, ErrBadPassword
+	}
+	pt := make([]byte, len(ct))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(pt, ct)
+	n := int(pt[len(pt)-1])
+	if n == 0 || n > bs {
+		return nil, ErrBadPassword
+	}
+	for _, p := range pt[len(pt)-n:] {
+		if int(p) != n {
+			return nil, ErrBadPassword
+		}
+	}
+	return pt[:len(pt)-n], nil
+}
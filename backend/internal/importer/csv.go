@@ -0,0 +1,107 @@
+package importer
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+
+	"project-crypto/internal/vault"
+)
+
+// csvColumns maps the header names browsers use onto login fields.
+// Chrome and Edge write name,url,username,password,note; Firefox writes
+// url,username,password,httpRealm,formActionOrigin,guid and timestamps.
+var csvColumns = map[string]string{
+	"name":     "title",
+	"title":    "title",
+	"url":      "site",
+	"origin":   "site",
+	"username": "username",
+	"password": "password",
+	"note":     "notes",
+	"notes":    "notes",
+}
+
+// csvIgnored are browser bookkeeping columns not worth a custom field.
+var csvIgnored = map[string]bool{
+	"guid": true, "timecreated": true, "timelastused": true, "timepasswordchanged": true,
+	"formactionorigin": true,
+}
+
+func detectCSV(data []byte) (Format, bool) {
+	line, _, _ := bytes.Cut(data, []byte("\n"))
+	cols, err := csv.NewReader(bytes.NewReader(line)).Read()
+	if err != nil {
+		return "", false
+	}
+	has := map[string]bool{}
+	for _, c := range cols {
+		has[strings.ToLower(strings.TrimSpace(c))] = true
+	}
+	switch {
+	case !has["url"] || !has["username"] || !has["password"]:
+		return "", false
+	case has["httprealm"] || has["guid"]:
+		return FormatFirefoxCSV, true
+	default:
+		return FormatChromeCSV, true
+	}
+}
+
+// parseCSV reads a browser password export. Every row is a login; rows
+// for the browser's own sync account are skipped.
+func parseCSV(data []byte) ([]Record, error) {
+	r := csv.NewReader(bytes.NewReader(bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))))
+	r.FieldsPerRecord = -1
+	header, err := r.Read()
+	if err != nil {
+		return nil, fmt.Errorf("importer: csv header: %w", err)
+	}
+	for i := range header {
+		header[i] = strings.TrimSpace(header[i])
+	}
+
+	var out []Record
+	for {
+		row, err := r.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("importer: csv: %w", err)
+		}
+		b := newBuilder("login", "")
+		for i, val := range row {
+			if i >= len(header) {
+				break
+			}
+			col := strings.ToLower(header[i])
+			if field, ok := csvColumns[col]; ok {
+				b.set(field, val)
+				continue
+			}
+			if col == "httprealm" {
+				b.custom("HTTP realm", vault.KindText, val)
+				continue
+			}
+			if !csvIgnored[col] {
+				b.custom(header[i], vault.KindText, val)
+			}
+		}
+		site := b.rec.Item.Fields["site"]
+		if strings.HasPrefix(site, "chrome://") || strings.HasPrefix(site, "about:") {
+			continue
+		}
+		if b.rec.Item.Fields["title"] == "" {
+			if u, err := url.Parse(site); err == nil && u.Host != "" {
+				b.set("title", u.Hostname())
+			}
+		}
+		out = append(out, b.record())
+	}
+	return out, nil
+}
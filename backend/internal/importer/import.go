@@ -0,0 +1,300 @@
+package importer
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"slices"
+	"sort"
+	"strings"
+
+	"project-crypto/internal/vault"
+)
+
+// Duplicates says what Import does with a record that holds the same
+// secret as an item already in the vault or an earlier record of the
+// export.
+type Duplicates string
+
+const (
+	SkipDuplicates Duplicates = "skip"
+	KeepDuplicates Duplicates = "keep"
+)
+
+type Options struct {
+	DryRun     bool
+	Duplicates Duplicates // defaults to SkipDuplicates
+}
+
+// Entry statuses.
+const (
+	StatusNew       = "new" // would be imported; dry runs only
+	StatusImported  = "imported"
+	StatusDuplicate = "duplicate"
+	StatusInvalid   = "invalid"
+)
+
+// Entry is the outcome for one record. It never carries secrets: the
+// title is the only field value reported.
+type Entry struct {
+	Index  int    `json:"index"`
+	Type   string `json:"type"`
+	Title  string `json:"title,omitempty"`
+	Folder string `json:"folder,omitempty"`
+	Status string `json:"status"`
+	Reason string `json:"reason,omitempty"`
+	ID     string `json:"id,omitempty"`
+
+	// DuplicateOf is the vault item, or DuplicateOfEntry the earlier
+	// record, this one duplicates.
+	DuplicateOf      string `json:"duplicate_of,omitempty"`
+	DuplicateOfEntry *int   `json:"duplicate_of_entry,omitempty"`
+}
+
+// Report summarises an import. New counts the records imported, or that
+// would be on a dry run; Duplicates counts every duplicate found, whether
+// or not it was kept. Folders lists the folder paths created. Unreadable
+// lists vault items that could not be read to look for duplicates;
+// records matching them are not caught.
+type Report struct {
+	DryRun     bool     `json:"dry_run"`
+	Total      int      `json:"total"`
+	New        int      `json:"new"`
+	Duplicates int      `json:"duplicates"`
+	Invalid    int      `json:"invalid"`
+	Folders    []string `json:"folders"`
+	Unreadable []string `json:"unreadable,omitempty"`
+	Entries    []Entry  `json:"entries"`
+}
+
+// Import validates recs and adds them to v, creating folders by path as
+// needed. Invalid records are reported and skipped, never fatal. The items
+// are added in one batch once every record has been checked. An error from
+// the vault stops the import; the report then covers the records handled
+// so far, and only entries marked imported were added.
+func Import(ctx context.Context, v vault.Vault, recs []Record, opts Options) (Report, error) {
+	switch opts.Duplicates {
+	case "":
+		opts.Duplicates = SkipDuplicates
+	case SkipDuplicates, KeepDuplicates:
+	default:
+		return Report{}, fmt.Errorf("importer: unknown duplicates mode %q", opts.Duplicates)
+	}
+	existing, unreadable, err := vaultFingerprints(ctx, v)
+	if err != nil {
+		return Report{}, err
+	}
+	folders, err := folderPaths(ctx, v)
+	if err != nil {
+		return Report{}, err
+	}
+
+	report := Report{DryRun: opts.DryRun, Total: len(recs), Folders: []string{}, Unreadable: unreadable, Entries: make([]Entry, 0, len(recs))}
+	seen := map[string]int{}
+	var batch []vault.NewItem
+	var pending []int // indexes into report.Entries, one per item in batch
+	for i, rec := range recs {
+		e := Entry{Index: i, Type: rec.Item.Type, Title: rec.Item.Fields["title"], Folder: rec.Folder}
+		it, err := vault.ValidateItem(rec.Item)
+		if err != nil {
+			e.Status, e.Reason = StatusInvalid, err.Error()
+			report.Invalid++
+			report.Entries = append(report.Entries, e)
+			continue
+		}
+		e.Type = it.Type
+
+		fp := fingerprint(it)
+		dup := true
+		if id, ok := existing[fp]; ok {
+			e.DuplicateOf = id
+		} else if j, ok := seen[fp]; ok {
+			e.DuplicateOfEntry = &j
+		} else {
+			seen[fp] = i
+			dup = false
+		}
+		if dup {
+			report.Duplicates++
+			if opts.Duplicates == SkipDuplicates {
+				e.Status = StatusDuplicate
+				report.Entries = append(report.Entries, e)
+				continue
+			}
+		}
+
+		folder, err := ensureFolder(ctx, v, folders, rec.Folder, opts.DryRun, &report)
+		if err != nil {
+			return report, err
+		}
+		if opts.DryRun {
+			e.Status = StatusNew
+			report.New++
+			report.Entries = append(report.Entries, e)
+			continue
+		}
+		var o vault.Organization
+		if folder != "" {
+			o.Folder = &folder
+		}
+		if len(rec.Tags) > 0 {
+			o.Tags = rec.Tags
+		}
+		if rec.Favorite {
+			fav := true
+			o.Favorite = &fav
+		}
+		batch = append(batch, vault.NewItem{Item: it, Organization: o})
+		pending = append(pending, len(report.Entries))
+		report.Entries = append(report.Entries, e)
+	}
+	if len(batch) == 0 {
+		return report, nil
+	}
+	ids, err := v.AddItems(ctx, batch)
+	for n, id := range ids {
+		e := &report.Entries[pending[n]]
+		e.Status, e.ID = StatusImported, id
+		report.New++
+	}
+	if err != nil {
+		// Entries not added are dropped so the report only covers records
+		// handled; the first of them is the one that failed.
+		failed := report.Entries[pending[len(ids)]].Index
+		report.Entries = slices.DeleteFunc(report.Entries, func(e Entry) bool { return e.Status == "" })
+		return report, fmt.Errorf("importer: entry %d: %w", failed, err)
+	}
+	return report, nil
+}
+
+// vaultFingerprints maps the fingerprint of every live item to its id. An
+// item that cannot be read is left out and its id returned, so that one
+// damaged item does not block imports.
+func vaultFingerprints(ctx context.Context, v vault.Vault) (map[string]string, []string, error) {
+	metas, err := v.List(ctx, vault.Query{})
+	if err != nil {
+		return nil, nil, err
+	}
+	out := make(map[string]string, len(metas))
+	var unreadable []string
+	for _, m := range metas {
+		it, err := v.GetItem(ctx, m.ID)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, nil, ctx.Err()
+			}
+			unreadable = append(unreadable, m.ID)
+			continue
+		}
+		out[fingerprint(it)] = m.ID
+	}
+	return out, unreadable, nil
+}
+
+// fingerprint identifies an item by what it holds rather than what it is
+// called, since managers title the same login differently. Title and notes
+// only count when an item has nothing else; sites compare by host and
+// usernames ignore case.
+func fingerprint(it vault.Item) string {
+	var names []string
+	for name := range it.Fields {
+		if name != "title" && name != "notes" {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		names = []string{"title", "notes"}
+	}
+	sort.Strings(names)
+	h := sha256.New()
+	h.Write([]byte(it.Type))
+	for _, name := range names {
+		val := strings.TrimSpace(it.Fields[name])
+		switch name {
+		case "site", "url", "host":
+			val = siteHost(val)
+		case "username", "email":
+			val = strings.ToLower(val)
+		case "number":
+			val = strings.Map(func(r rune) rune {
+				if r >= '0' && r <= '9' {
+					return r
+				}
+				return -1
+			}, val)
+		}
+		h.Write([]byte{0})
+		h.Write([]byte(name))
+		h.Write([]byte{0})
+		h.Write([]byte(val))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func siteHost(s string) string {
+	if s == "" {
+		return ""
+	}
+	if !strings.Contains(s, "://") {
+		s = "https://" + s
+	}
+	u, err := url.Parse(s)
+	if err != nil || u.Host == "" {
+		return strings.ToLower(s)
+	}
+	return strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+}
+
+// folderPaths maps the slash-separated path of every folder to its id.
+func folderPaths(ctx context.Context, v vault.Vault) (map[string]string, error) {
+	list, err := v.ListFolders(ctx)
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[string]vault.Folder, len(list))
+	for _, f := range list {
+		byID[f.ID] = f
+	}
+	out := make(map[string]string, len(list))
+	for _, f := range list {
+		parts := []string{f.Name}
+		for p, n := f.Parent, 0; p != "" && n <= len(list); n++ {
+			parts = append([]string{byID[p].Name}, parts...)
+			p = byID[p].Parent
+		}
+		out[strings.Join(parts, "/")] = f.ID
+	}
+	return out, nil
+}
+
+// ensureFolder returns the id of the folder at path, creating it and any
+// missing parents. On a dry run nothing is created; the paths are only
+// reported, and the returned id is empty.
+func ensureFolder(ctx context.Context, v vault.Vault, folders map[string]string, path string, dryRun bool, report *Report) (string, error) {
+	if path == "" {
+		return "", nil
+	}
+	parent, prefix := "", ""
+	for _, name := range strings.Split(path, "/") {
+		if prefix != "" {
+			prefix += "/"
+		}
+		prefix += name
+		id, ok := folders[prefix]
+		if !ok {
+			if !dryRun {
+				f, err := v.CreateFolder(ctx, name, parent)
+				if err != nil {
+					return "", fmt.Errorf("importer: folder %q: %w", prefix, err)
+				}
+				id = f.ID
+			}
+			folders[prefix] = id
+			report.Folders = append(report.Folders, prefix)
+		}
+		parent = id
+	}
+	return parent, nil
+}
@@ -0,0 +1,232 @@
+// Package importer reads the exports of other password managers and files
+// their entries into a vault.
+//
+// Each parser turns an export into Records: a vault.Item plus the folder
+// path, tags and favorite flag it had in the source. Fields the vault has
+// no schema field for are kept as custom fields, so nothing in the export
+// is dropped silently. Import then validates every record, checks it for
+// duplicates against the vault and the rest of the export, and, unless it
+// is a dry run, creates the missing folders and adds the items.
+//
+// Exports are decrypted in memory only. Callers should zero the export
+// and its password once Parse returns.
+package importer
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/mail"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"project-crypto/internal/totp"
+	"project-crypto/internal/vault"
+)
+
+// Format names an export format.
+type Format string
+
+const (
+	FormatBitwarden   Format = "bitwarden"
+	FormatKeePass     Format = "kdbx"
+	FormatOnePassword Format = "1pux"
+	FormatChromeCSV   Format = "chrome-csv"
+	FormatFirefoxCSV  Format = "firefox-csv"
+)
+
+// Formats lists every supported format.
+var Formats = []Format{FormatBitwarden, FormatKeePass, FormatOnePassword, FormatChromeCSV, FormatFirefoxCSV}
+
+var (
+	ErrUnknownFormat    = errors.New("importer: unknown export format")
+	ErrPasswordRequired = errors.New("importer: export is encrypted, password required")
+	ErrBadPassword      = errors.New("importer: wrong password or corrupted export")
+)
+
+// Record is one entry of an export mapped onto the vault. Folder is a
+// slash-separated path, empty for the top level.
+type Record struct {
+	Item     vault.Item
+	Folder   string
+	Tags     []string
+	Favorite bool
+}
+
+// Parse reads an export of the given format. password is only used by
+// encrypted formats; ErrPasswordRequired is returned when one needs it and
+// it is empty. ctx bounds the key derivation of KeePass databases.
+func Parse(ctx context.Context, format Format, data, password []byte) ([]Record, error) {
+	switch format {
+	case FormatBitwarden:
+		return parseBitwarden(data, password)
+	case FormatKeePass:
+		return parseKeePass(ctx, data, password)
+	case FormatOnePassword:
+		return parseOnePassword(data)
+	case FormatChromeCSV, FormatFirefoxCSV:
+		return parseCSV(data)
+	}
+	return nil, fmt.Errorf("%w: %q", ErrUnknownFormat, format)
+}
+
+// Detect guesses the format of an export from its file name and content.
+func Detect(name string, data []byte) (Format, error) {
+	trimmed := bytes.TrimSpace(bytes.TrimPrefix(data, []byte("\xef\xbb\xbf")))
+	switch {
+	case isKeePass(data):
+		return FormatKeePass, nil
+	case bytes.HasPrefix(data, []byte("PK\x03\x04")):
+		return FormatOnePassword, nil
+	case bytes.HasPrefix(trimmed, []byte("{")):
+		return FormatBitwarden, nil
+	}
+	if f, ok := detectCSV(trimmed); ok {
+		return f, nil
+	}
+	switch strings.ToLower(path.Ext(name)) {
+	case ".kdbx":
+		return FormatKeePass, nil
+	case ".1pux":
+		return FormatOnePassword, nil
+	case ".json":
+		return FormatBitwarden, nil
+	}
+	return "", ErrUnknownFormat
+}
+
+// ParseFormat resolves a format name as given on a command line or form.
+func ParseFormat(s string) (Format, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	switch s {
+	case "keepass", "keepassxc":
+		return FormatKeePass, nil
+	case "1password", "onepassword":
+		return FormatOnePassword, nil
+	case "chrome", "edge", "chromium":
+		return FormatChromeCSV, nil
+	case "firefox":
+		return FormatFirefoxCSV, nil
+	}
+	for _, f := range Formats {
+		if string(f) == s {
+			return f, nil
+		}
+	}
+	return "", fmt.Errorf("%w: %q", ErrUnknownFormat, s)
+}
+
+// builder assembles one Record. Custom fields keep the order they were
+// added in and get unique names, as the vault requires.
+type builder struct {
+	rec  Record
+	seen map[string]bool
+}
+
+func newBuilder(typ, title string) *builder {
+	b := &builder{rec: Record{Item: vault.Item{Type: typ, Fields: map[string]string{}}}, seen: map[string]bool{}}
+	b.set("title", title)
+	return b
+}
+
+func (b *builder) set(field, value string) {
+	if value = strings.TrimSpace(value); value != "" {
+		b.rec.Item.Fields[field] = value
+	}
+}
+
+// custom adds a custom field. Values that would not pass the kind's
+// validation are kept as text rather than failing the whole item.
+func (b *builder) custom(name string, kind vault.FieldKind, value string) {
+	if strings.TrimSpace(value) == "" {
+		return
+	}
+	name = strings.TrimSpace(name)
+	if name == "" {
+		name = "Field"
+	}
+	unique := name
+	for n := 2; b.seen[unique]; n++ {
+		unique = fmt.Sprintf("%s (%d)", name, n)
+	}
+	b.seen[unique] = true
+	switch kind {
+	case vault.KindURL:
+		if u, err := url.Parse(value); err != nil || u.Scheme == "" || u.Host == "" {
+			kind = vault.KindText
+		}
+	case vault.KindTOTP:
+		if _, err := totp.ParseKey(value); err != nil {
+			kind = vault.KindHidden
+		}
+	case vault.KindEmail:
+		if _, err := mail.ParseAddress(value); err != nil {
+			kind = vault.KindText
+		}
+	case vault.KindDate:
+		if _, err := time.Parse("2006-01-02", value); err != nil {
+			kind = vault.KindText
+		}
+	case vault.KindText:
+		if strings.Contains(value, "\n") {
+			kind = vault.KindMultiline
+		}
+	}
+	b.rec.Item.Custom = append(b.rec.Item.Custom, vault.CustomField{Name: unique, Kind: kind, Value: value})
+}
+
+// totp sets the login's one-time code secret, or keeps a secret the vault
+// cannot use, such as a Steam code, as a hidden custom field.
+func (b *builder) totp(value string) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return
+	}
+	if _, err := totp.ParseKey(value); err == nil && b.rec.Item.Type == "login" {
+		b.set("totp", value)
+		return
+	}
+	b.custom("One-time code", vault.KindHidden, value)
+}
+
+// record returns the finished Record. A login without a password cannot
+// be stored as one; it becomes a secure note, with the site and username
+// kept as custom fields, when it has notes to carry.
+func (b *builder) record() Record {
+	it := &b.rec.Item
+	if it.Type == "login" && it.Fields["password"] == "" && it.Fields["notes"] != "" {
+		it.Type = "note"
+		site, user, otp := it.Fields["site"], it.Fields["username"], it.Fields["totp"]
+		delete(it.Fields, "site")
+		delete(it.Fields, "username")
+		delete(it.Fields, "totp")
+		custom := it.Custom
+		it.Custom = nil
+		b.seen = map[string]bool{}
+		b.custom("Website", vault.KindURL, site)
+		b.custom("Username", vault.KindText, user)
+		b.custom("One-time code", vault.KindTOTP, otp)
+		for _, f := range custom {
+			b.custom(f.Name, f.Kind, f.Value)
+		}
+	}
+	if len(it.Custom) == 0 {
+		it.Custom = nil
+	}
+	return b.rec
+}
+
+// cleanFolder normalizes a folder path: segments are trimmed and empty
+// ones dropped.
+func cleanFolder(p string) string {
+	var parts []string
+	for _, s := range strings.Split(p, "/") {
+		if s = strings.TrimSpace(s); s != "" {
+			parts = append(parts, s)
+		}
+	}
+	return strings.Join(parts, "/")
+}
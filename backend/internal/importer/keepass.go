@@ -0,0 +1,616 @@
+package importer
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/aes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/chacha20"
+	"golang.org/x/crypto/twofish"
+
+	cr "project-crypto/internal/crypto"
+	"project-crypto/internal/vault"
+)
+
+const (
+	kdbxSig1 = 0x9AA2D903
+	kdbxSig2 = 0xB54BFB67
+)
+
+// Outer header field ids.
+const (
+	kdbxEndOfHeader   = 0
+	kdbxCipherID      = 2
+	kdbxCompression   = 3
+	kdbxMasterSeed    = 4
+	kdbxEncryptionIV  = 7
+	kdbxKdfParameters = 11
+)
+
+// Inner header field ids.
+const (
+	kdbxInnerEnd       = 0
+	kdbxInnerStreamID  = 1
+	kdbxInnerStreamKey = 2
+	kdbxInnerBinary    = 3
+)
+
+const kdbxStreamChaCha20 = 3
+
+var (
+	kdbxCipherAES      = mustUUID("31c1f2e6bf714350be5805216afc5aff")
+	kdbxCipherChaCha20 = mustUUID("d6038a2b8b6f4cb5a524339a31dbb59a")
+	kdbxCipherTwofish  = mustUUID("ad68f29f576f4bb9a36ad47af965346c")
+
+	kdbxKdfAES      = mustUUID("c9d9f39a628a4460bf740d08c18a4fea")
+	kdbxKdfAESKDBX4 = mustUUID("7c02bb8279a74ac0927d114a00648238")
+	kdbxKdfArgon2d  = mustUUID("ef636ddf8c29444b91f7a9a403e30a0c")
+	kdbxKdfArgon2id = mustUUID("9e298b1956db4773b23dfc3ec6f0a1e6")
+)
+
+// Bounds on the key derivation a database may ask for, so a crafted file
+// cannot exhaust the server: Argon2 memory in bytes and passes, and
+// AES-KDF rounds. They sit well above what KeePass picks for a one-second
+// delay.
+const (
+	kdbxMaxMemory     = 1 << 30
+	kdbxMaxIterations = 100
+	kdbxMaxRounds     = 1 << 28
+)
+
+// maxKDBXInflated bounds a compressed payload once inflated, as it is read
+// into memory.
+const maxKDBXInflated = 256 << 20
+
+var errKDBXCorrupt = errors.New("importer: keepass: corrupted database")
+
+func mustUUID(s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil || len(b) != 16 {
+		panic("importer: bad uuid " + s)
+	}
+	return b
+}
+
+func isKeePass(data []byte) bool {
+	return len(data) >= 8 &&
+		binary.LittleEndian.Uint32(data[0:4]) == kdbxSig1 &&
+		binary.LittleEndian.Uint32(data[4:8]) == kdbxSig2
+}
+
+type kdbxHeader struct {
+	cipher     []byte
+	compressed bool
+	masterSeed []byte
+	iv         []byte
+	kdf        map[string][]byte
+	length     int // bytes up to and including the end-of-header field
+}
+
+// parseKeePass reads a KDBX 4 database protected by a password alone. Key
+// files and hardware keys are not supported, nor are attachments imported.
+// Entries in the recycle bin and the history of each entry are skipped.
+func parseKeePass(ctx context.Context, data, password []byte) ([]Record, error) {
+	if !isKeePass(data) {
+		return nil, errors.New("importer: keepass: not a KeePass database")
+	}
+	if len(password) == 0 {
+		return nil, ErrPasswordRequired
+	}
+	h, err := readKDBXHeader(data)
+	if err != nil {
+		return nil, err
+	}
+	rest := data[h.length:]
+	if len(rest) < 64 {
+		return nil, errKDBXCorrupt
+	}
+	if sum := sha256.Sum256(data[:h.length]); !hmac.Equal(sum[:], rest[:32]) {
+		return nil, errKDBXCorrupt
+	}
+
+	pwHash := sha256.Sum256(password)
+	composite := sha256.Sum256(pwHash[:])
+	defer cr.Zero(pwHash[:])
+	defer cr.Zero(composite[:])
+	transformed, err := kdbxTransformKey(ctx, h.kdf, composite[:])
+	if err != nil {
+		return nil, err
+	}
+	defer cr.Zero(transformed)
+
+	hk := sha512.New()
+	hk.Write(h.masterSeed)
+	hk.Write(transformed)
+	hk.Write([]byte{1})
+	hmacKey := hk.Sum(nil)
+	defer cr.Zero(hmacKey)
+	if !hmac.Equal(kdbxHMAC(hmacKey, ^uint64(0), data[:h.length]), rest[32:64]) {
+		return nil, ErrBadPassword
+	}
+
+	payload, err := readKDBXBlocks(rest[64:], hmacKey)
+	if err != nil {
+		return nil, err
+	}
+	ek := sha256.New()
+	ek.Write(h.masterSeed)
+	ek.Write(transformed)
+	encKey := ek.Sum(nil)
+	defer cr.Zero(encKey)
+
+	var plain []byte
+	switch {
+	case bytes.Equal(h.cipher, kdbxCipherAES):
+		plain, err = cbcDecrypt(encKey, h.iv, payload)
+	case bytes.Equal(h.cipher, kdbxCipherTwofish):
+		block, terr := twofish.NewCipher(encKey)
+		if terr != nil {
+			return nil, terr
+		}
+		plain, err = cbcOpen(block, h.iv, payload)
+	case bytes.Equal(h.cipher, kdbxCipherChaCha20):
+		c, cerr := chacha20.NewUnauthenticatedCipher(encKey, h.iv)
+		if cerr != nil {
+			return nil, errKDBXCorrupt
+		}
+		plain = make([]byte, len(payload))
+		c.XORKeyStream(plain, payload)
+	default:
+		return nil, errors.New("importer: keepass: unsupported cipher")
+	}
+	if err != nil {
+		return nil, errKDBXCorrupt
+	}
+	defer cr.Zero(plain)
+
+	if h.compressed {
+		zr, err := gzip.NewReader(bytes.NewReader(plain))
+		if err != nil {
+			return nil, errKDBXCorrupt
+		}
+		unzipped, err := io.ReadAll(io.LimitReader(zr, maxKDBXInflated+1))
+		if err != nil {
+			return nil, errKDBXCorrupt
+		}
+		defer cr.Zero(unzipped)
+		if len(unzipped) > maxKDBXInflated {
+			return nil, errors.New("importer: keepass: database is too large")
+		}
+		plain = unzipped
+	}
+
+	stream, body, err := readKDBXInner(plain)
+	if err != nil {
+		return nil, err
+	}
+	return readKDBXXML(body, stream)
+}
+
+func readKDBXHeader(data []byte) (kdbxHeader, error) {
+	var h kdbxHeader
+	if len(data) < 12 {
+		return h, errKDBXCorrupt
+	}
+	if major := binary.LittleEndian.Uint16(data[10:12]); major != 4 {
+		return h, fmt.Errorf("importer: keepass: KDBX %d is not supported; save the database as KDBX 4", major)
+	}
+	off := 12
+	for {
+		if off+5 > len(data) {
+			return h, errKDBXCorrupt
+		}
+		id := data[off]
+		n := int(binary.LittleEndian.Uint32(data[off+1 : off+5]))
+		off += 5
+		if n < 0 || off+n > len(data) {
+			return h, errKDBXCorrupt
+		}
+		val := data[off : off+n]
+		off += n
+		switch id {
+		case kdbxEndOfHeader:
+			h.length = off
+			if h.cipher == nil || h.masterSeed == nil || h.iv == nil || h.kdf == nil {
+				return h, errKDBXCorrupt
+			}
+			return h, nil
+		case kdbxCipherID:
+			h.cipher = val
+		case kdbxCompression:
+			h.compressed = len(val) == 4 && binary.LittleEndian.Uint32(val) == 1
+		case kdbxMasterSeed:
+			h.masterSeed = val
+		case kdbxEncryptionIV:
+			h.iv = val
+		case kdbxKdfParameters:
+			kdf, err := readVariantDict(val)
+			if err != nil {
+				return h, err
+			}
+			h.kdf = kdf
+		}
+	}
+}
+
+// readVariantDict reads a KeePass VariantDictionary. Values are kept raw;
+// the KDF knows the type of each one it needs.
+func readVariantDict(b []byte) (map[string][]byte, error) {
+	if len(b) < 2 || b[1] != 1 {
+		return nil, errKDBXCorrupt
+	}
+	out := map[string][]byte{}
+	b = b[2:]
+	for {
+		if len(b) < 1 {
+			return nil, errKDBXCorrupt
+		}
+		if b[0] == 0 {
+			return out, nil
+		}
+		if len(b) < 5 {
+			return nil, errKDBXCorrupt
+		}
+		kl := int(binary.LittleEndian.Uint32(b[1:5]))
+		b = b[5:]
+		if kl < 0 || len(b) < kl+4 {
+			return nil, errKDBXCorrupt
+		}
+		key := string(b[:kl])
+		vl := int(binary.LittleEndian.Uint32(b[kl : kl+4]))
+		b = b[kl+4:]
+		if vl < 0 || len(b) < vl {
+			return nil, errKDBXCorrupt
+		}
+		out[key] = b[:vl]
+		b = b[vl:]
+	}
+}
+
+func kdbxTransformKey(ctx context.Context, p map[string][]byte, composite []byte) ([]byte, error) {
+	u64 := func(k string) uint64 {
+		if v := p[k]; len(v) == 8 {
+			return binary.LittleEndian.Uint64(v)
+		}
+		return 0
+	}
+	u32 := func(k string) uint32 {
+		if v := p[k]; len(v) == 4 {
+			return binary.LittleEndian.Uint32(v)
+		}
+		return 0
+	}
+	uuid := p["$UUID"]
+	switch {
+	case bytes.Equal(uuid, kdbxKdfAES), bytes.Equal(uuid, kdbxKdfAESKDBX4):
+		block, err := aes.NewCipher(p["S"])
+		if err != nil {
+			return nil, errKDBXCorrupt
+		}
+		rounds := u64("R")
+		if rounds > kdbxMaxRounds {
+			return nil, errors.New("importer: keepass: unsupported AES-KDF rounds")
+		}
+		key := append([]byte(nil), composite...)
+		defer cr.Zero(key)
+		for i := uint64(0); i < rounds; i++ {
+			if i%(1<<16) == 0 {
+				if err := ctx.Err(); err != nil {
+					return nil, err
+				}
+			}
+			block.Encrypt(key[:16], key[:16])
+			block.Encrypt(key[16:], key[16:])
+		}
+		sum := sha256.Sum256(key)
+		return sum[:], nil
+
+	case bytes.Equal(uuid, kdbxKdfArgon2d), bytes.Equal(uuid, kdbxKdfArgon2id):
+		salt, mem, iter, par := p["S"], u64("M"), u64("I"), u32("P")
+		if v := u32("V"); v != 0x13 {
+			return nil, fmt.Errorf("importer: keepass: Argon2 version %#x is not supported", v)
+		}
+		if mem < 8*1024 || mem > kdbxMaxMemory || iter == 0 || iter > kdbxMaxIterations || par == 0 || par > 255 {
+			return nil, errors.New("importer: keepass: unsupported Argon2 parameters")
+		}
+		if bytes.Equal(uuid, kdbxKdfArgon2d) {
+			return argon2dKey(ctx, composite, salt, p["K"], p["A"], uint32(iter), uint32(mem/1024), par, 32)
+		}
+		if len(p["K"]) > 0 || len(p["A"]) > 0 {
+			return nil, errors.New("importer: keepass: Argon2id with a secret or associated data is not supported")
+		}
+		return argon2.IDKey(composite, salt, uint32(iter), uint32(mem/1024), uint8(par), 32), nil
+	}
+	return nil, errors.New("importer: keepass: unsupported key derivation function")
+}
+
+// kdbxHMAC authenticates one block under its own key. The header is
+// block 2^64-1 and MACed as is; payload blocks count up from 0 and their
+// index and length are MACed with the data.
+func kdbxHMAC(hmacKey []byte, index uint64, data []byte) []byte {
+	var idx [8]byte
+	binary.LittleEndian.PutUint64(idx[:], index)
+	kh := sha512.New()
+	kh.Write(idx[:])
+	kh.Write(hmacKey)
+	m := hmac.New(sha256.New, kh.Sum(nil))
+	if index != ^uint64(0) {
+		var n [4]byte
+		binary.LittleEndian.PutUint32(n[:], uint32(len(data)))
+		m.Write(idx[:])
+		m.Write(n[:])
+	}
+	m.Write(data)
+	return m.Sum(nil)
+}
+
+func readKDBXBlocks(b, hmacKey []byte) ([]byte, error) {
+	var out []byte
+	for i := uint64(0); ; i++ {
+		if len(b) < 36 {
+			return nil, errKDBXCorrupt
+		}
+		tag := b[:32]
+		n := int(int32(binary.LittleEndian.Uint32(b[32:36])))
+		b = b[36:]
+		if n < 0 || len(b) < n {
+			return nil, errKDBXCorrupt
+		}
+		if !hmac.Equal(kdbxHMAC(hmacKey, i, b[:n]), tag) {
+			return nil, errKDBXCorrupt
+		}
+		if n == 0 {
+			return out, nil
+		}
+		out = append(out, b[:n]...)
+		b = b[n:]
+	}
+}
+
+// readKDBXInner reads the inner header and returns the stream that
+// protects values in the XML, and the XML itself.
+func readKDBXInner(b []byte) (*chacha20.Cipher, []byte, error) {
+	var streamID uint32
+	var streamKey []byte
+	for {
+		if len(b) < 5 {
+			return nil, nil, errKDBXCorrupt
+		}
+		id := b[0]
+		n := int(binary.LittleEndian.Uint32(b[1:5]))
+		b = b[5:]
+		if n < 0 || len(b) < n {
+			return nil, nil, errKDBXCorrupt
+		}
+		val := b[:n]
+		b = b[n:]
+		switch id {
+		case kdbxInnerStreamID:
+			if len(val) == 4 {
+				streamID = binary.LittleEndian.Uint32(val)
+			}
+		case kdbxInnerStreamKey:
+			streamKey = val
+		case kdbxInnerBinary:
+			// Attachments are not imported.
+		case kdbxInnerEnd:
+			if streamID != kdbxStreamChaCha20 {
+				return nil, nil, fmt.Errorf("importer: keepass: unsupported inner stream %d", streamID)
+			}
+			k := sha512.Sum512(streamKey)
+			defer cr.Zero(k[:])
+			c, err := chacha20.NewUnauthenticatedCipher(k[:32], k[32:44])
+			if err != nil {
+				return nil, nil, err
+			}
+			return c, b, nil
+		}
+	}
+}
+
+type kdbxGroup struct {
+	uuid, name string
+}
+
+type kdbxString struct {
+	key, value string
+	protected  bool
+}
+
+// readKDBXXML walks the database XML. Protected values are XORed with the
+// inner stream in document order, so every one of them is decrypted, in
+// history too, even though only current entries are kept.
+func readKDBXXML(body []byte, stream *chacha20.Cipher) ([]Record, error) {
+	dec := xml.NewDecoder(bytes.NewReader(body))
+	var (
+		out        []Record
+		names      []string
+		groups     []kdbxGroup
+		recycleBin string
+		history    int
+		entry      []kdbxString
+		tags       string
+		inEntry    bool
+		key, value string
+		protected  bool
+		text       strings.Builder
+	)
+	parent := func() string {
+		if len(names) < 2 {
+			return ""
+		}
+		return names[len(names)-2]
+	}
+	for {
+		tok, err := dec.Token()
+		if errors.Is(err, io.EOF) {
+			return out, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("importer: keepass: %w", err)
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			names = append(names, t.Name.Local)
+			text.Reset()
+			switch t.Name.Local {
+			case "Group":
+				groups = append(groups, kdbxGroup{})
+			case "History":
+				history++
+			case "Entry":
+				if history == 0 {
+					inEntry, entry, tags = true, nil, ""
+				}
+			case "Value":
+				protected = false
+				for _, a := range t.Attr {
+					if a.Name.Local == "Protected" && strings.EqualFold(a.Value, "true") {
+						protected = true
+					}
+				}
+			}
+		case xml.CharData:
+			text.Write(t)
+		case xml.EndElement:
+			s := text.String()
+			text.Reset()
+			switch p := parent(); t.Name.Local {
+			case "RecycleBinUUID":
+				if p == "Meta" {
+					recycleBin = s
+				}
+			case "UUID":
+				if p == "Group" {
+					groups[len(groups)-1].uuid = s
+				}
+			case "Name":
+				if p == "Group" {
+					groups[len(groups)-1].name = s
+				}
+			case "Key":
+				if p == "String" {
+					key = s
+				}
+			case "Value":
+				if p != "String" {
+					break
+				}
+				value = s
+				if protected {
+					raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s))
+					if err != nil {
+						return nil, errKDBXCorrupt
+					}
+					stream.XORKeyStream(raw, raw)
+					value = string(raw)
+					cr.Zero(raw)
+				}
+			case "String":
+				if inEntry && history == 0 && p == "Entry" {
+					entry = append(entry, kdbxString{key: key, value: value, protected: protected})
+				}
+				key, value, protected = "", "", false
+			case "Tags":
+				if inEntry && history == 0 && p == "Entry" {
+					tags = s
+				}
+			case "Entry":
+				if history > 0 || !inEntry {
+					break
+				}
+				inEntry = false
+				if inRecycleBin(groups, recycleBin) {
+					break
+				}
+				rec := kdbxRecord(entry)
+				rec.Folder = kdbxFolder(groups)
+				rec.Tags = strings.FieldsFunc(tags, func(r rune) bool { return r == ';' || r == ',' })
+				out = append(out, rec)
+			case "History":
+				history--
+			case "Group":
+				if len(groups) > 0 {
+					groups = groups[:len(groups)-1]
+				}
+			}
+			if len(names) > 0 {
+				names = names[:len(names)-1]
+			}
+		}
+	}
+}
+
+func inRecycleBin(groups []kdbxGroup, bin string) bool {
+	if bin == "" || bin == "AAAAAAAAAAAAAAAAAAAAAA==" {
+		return false
+	}
+	for _, g := range groups {
+		if g.uuid == bin {
+			return true
+		}
+	}
+	return false
+}
+
+// kdbxFolder is the path of the entry's group. The root group stands for
+// the database itself and is left out.
+func kdbxFolder(groups []kdbxGroup) string {
+	if len(groups) < 2 {
+		return ""
+	}
+	parts := make([]string, 0, len(groups)-1)
+	for _, g := range groups[1:] {
+		parts = append(parts, strings.ReplaceAll(g.name, "/", "-"))
+	}
+	return cleanFolder(strings.Join(parts, "/"))
+}
+
+func kdbxRecord(strs []kdbxString) Record {
+	get := func(k string) string {
+		for _, s := range strs {
+			if s.key == k {
+				return s.value
+			}
+		}
+		return ""
+	}
+	b := newBuilder("login", get("Title"))
+	b.set("username", get("UserName"))
+	b.set("password", get("Password"))
+	b.set("site", get("URL"))
+	b.set("notes", get("Notes"))
+	otp := get("otp")
+	if otp == "" {
+		otp = get("TimeOtp-Secret-Base32")
+	}
+	if otp == "" {
+		otp = get("TOTP Seed")
+	}
+	b.totp(otp)
+	for _, s := range strs {
+		switch s.key {
+		case "Title", "UserName", "Password", "URL", "Notes", "otp", "TimeOtp-Secret-Base32", "TOTP Seed", "TOTP Settings":
+			continue
+		}
+		kind := vault.KindText
+		if s.protected {
+			kind = vault.KindHidden
+		}
+		b.custom(s.key, kind, s.value)
+	}
+	return b.record()
+}
@@ -0,0 +1,252 @@
+package importer
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"html"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/chacha20"
+	"golang.org/x/crypto/twofish"
+
+	"project-crypto/internal/vault"
+)
+
+func TestKeePass(t *testing.T) {
+	ctx := context.Background()
+	argon := kdbxArgon2Params(kdbxKdfArgon2d, randBytes(t, 32))
+	aesKDF := [][2]any{{"$UUID", kdbxKdfAES}, {"R", uint64(100)}, {"S", randBytes(t, 32)}}
+
+	for _, tc := range []struct {
+		name   string
+		cipher []byte
+		kdf    [][2]any
+	}{
+		{"aes-argon2d", kdbxCipherAES, argon},
+		{"chacha20-argon2id", kdbxCipherChaCha20, kdbxArgon2Params(kdbxKdfArgon2id, randBytes(t, 32))},
+		{"twofish-aeskdf", kdbxCipherTwofish, aesKDF},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			db := writeKDBX(t, "db pass", tc.cipher, tc.kdf)
+			if f, _ := Detect("x.bin", db); f != FormatKeePass {
+				t.Fatalf("detect = %q", f)
+			}
+			recs, err := Parse(ctx, FormatKeePass, db, []byte("db pass"))
+			if err != nil {
+				t.Fatalf("parse: %v", err)
+			}
+			if len(recs) != 2 {
+				t.Fatalf("got %d records: %+v", len(recs), recs)
+			}
+			mail := recs[0]
+			if f := mail.Item.Fields; f["title"] != "Mail" || f["username"] != "me" || f["password"] != "current <pw>" || f["totp"] == "" {
+				t.Fatalf("entry = %v", f)
+			}
+			if mail.Folder != "" || fmt.Sprint(mail.Tags) != "[a b]" {
+				t.Fatalf("filing = %q %v", mail.Folder, mail.Tags)
+			}
+			want := []vault.CustomField{{Name: "PIN", Kind: vault.KindHidden, Value: "9876"}, {Name: "Plain", Kind: vault.KindText, Value: "visible"}}
+			if fmt.Sprint(mail.Item.Custom) != fmt.Sprint(want) {
+				t.Fatalf("custom = %+v", mail.Item.Custom)
+			}
+			if recs[1].Folder != "Internet/Shops" || recs[1].Item.Fields["password"] != "shop pw" {
+				t.Fatalf("nested entry = %+v", recs[1])
+			}
+		})
+	}
+
+	db := writeKDBX(t, "db pass", kdbxCipherAES, argon)
+	if _, err := Parse(ctx, FormatKeePass, db, nil); !errors.Is(err, ErrPasswordRequired) {
+		t.Fatalf("no password: %v", err)
+	}
+	if _, err := Parse(ctx, FormatKeePass, db, []byte("wrong")); !errors.Is(err, ErrBadPassword) {
+		t.Fatalf("wrong password: %v", err)
+	}
+	db[len(db)-40] ^= 1
+	if _, err := Parse(ctx, FormatKeePass, db, []byte("db pass")); err == nil {
+		t.Fatal("damaged database accepted")
+	}
+}
+
+func kdbxArgon2Params(uuid, salt []byte) [][2]any {
+	return [][2]any{{"$UUID", uuid}, {"S", salt}, {"P", uint32(1)}, {"M", uint64(64 * 1024)}, {"I", uint64(2)}, {"V", uint32(0x13)}}
+}
+
+// writeKDBX builds a KDBX 4 database with a fixed set of groups and
+// entries: a current entry whose history holds an older protected
+// password, a nested group, and an entry in the recycle bin.
+func writeKDBX(t *testing.T, password string, cipherID []byte, kdf [][2]any) []byte {
+	t.Helper()
+	innerKey := randBytes(t, 64)
+	ik := sha512.Sum512(innerKey)
+	stream, _ := chacha20.NewUnauthenticatedCipher(ik[:32], ik[32:44])
+	prot := func(s string) string {
+		b := []byte(s)
+		stream.XORKeyStream(b, b)
+		return `<Value Protected="True">` + base64.StdEncoding.EncodeToString(b) + `</Value>`
+	}
+	str := func(k, v string) string {
+		return "<String><Key>" + k + "</Key><Value>" + html.EscapeString(v) + "</Value></String>"
+	}
+	binUUID := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{7}, 16))
+
+	var x strings.Builder
+	x.WriteString(`<?xml version="1.0" encoding="utf-8" standalone="yes"?><KeePassFile><Meta>`)
+	x.WriteString("<RecycleBinUUID>" + binUUID + "</RecycleBinUUID></Meta><Root><Group><UUID>cm9vdA==</UUID><Name>Database</Name>")
+	x.WriteString("<Entry><UUID>ZW50cnk=</UUID><Tags>a;b</Tags>")
+	x.WriteString(str("Title", "Mail") + str("UserName", "me"))
+	x.WriteString("<String><Key>Password</Key>" + prot("current <pw>") + "</String>")
+	x.WriteString("<String><Key>PIN</Key>" + prot("9876") + "</String>")
+	x.WriteString(str("Plain", "visible") + str("otp", "otpauth://totp/Mail:me?secret=JBSWY3DPEHPK3PXP"))
+	x.WriteString("<History><Entry><UUID>ZW50cnk=</UUID>" + str("Title", "Mail (old)"))
+	x.WriteString("<String><Key>Password</Key>" + prot("old password") + "</String></Entry></History></Entry>")
+	x.WriteString("<Group><UUID>aW50</UUID><Name>Internet</Name><Group><UUID>c2hvcA==</UUID><Name>Shops</Name>")
+	x.WriteString("<Entry>" + str("Title", "Shop") + "<String><Key>Password</Key>" + prot("shop pw") + "</String></Entry>")
+	x.WriteString("</Group></Group>")
+	x.WriteString("<Group><UUID>" + binUUID + "</UUID><Name>Recycle Bin</Name>")
+	x.WriteString("<Entry>" + str("Title", "Deleted") + "<String><Key>Password</Key>" + prot("gone") + "</String></Entry>")
+	x.WriteString("</Group></Group></Root></KeePassFile>")
+
+	var inner bytes.Buffer
+	field := func(w *bytes.Buffer, id byte, val []byte) {
+		w.WriteByte(id)
+		binary.Write(w, binary.LittleEndian, uint32(len(val)))
+		w.Write(val)
+	}
+	field(&inner, kdbxInnerStreamID, binary.LittleEndian.AppendUint32(nil, kdbxStreamChaCha20))
+	field(&inner, kdbxInnerStreamKey, innerKey)
+	field(&inner, kdbxInnerEnd, nil)
+	inner.WriteString(x.String())
+
+	var zipped bytes.Buffer
+	zw := gzip.NewWriter(&zipped)
+	zw.Write(inner.Bytes())
+	zw.Close()
+
+	var dict bytes.Buffer
+	dict.Write([]byte{0, 1})
+	kdfParams := map[string][]byte{}
+	for _, kv := range kdf {
+		var typ byte
+		var val []byte
+		switch v := kv[1].(type) {
+		case uint32:
+			typ, val = 0x04, binary.LittleEndian.AppendUint32(nil, v)
+		case uint64:
+			typ, val = 0x05, binary.LittleEndian.AppendUint64(nil, v)
+		case []byte:
+			typ, val = 0x42, v
+		}
+		key := kv[0].(string)
+		kdfParams[key] = val
+		dict.WriteByte(typ)
+		binary.Write(&dict, binary.LittleEndian, uint32(len(key)))
+		dict.WriteString(key)
+		binary.Write(&dict, binary.LittleEndian, uint32(len(val)))
+		dict.Write(val)
+	}
+	dict.WriteByte(0)
+
+	seed := randBytes(t, 32)
+	ivLen := 16
+	if bytes.Equal(cipherID, kdbxCipherChaCha20) {
+		ivLen = 12
+	}
+	iv := randBytes(t, ivLen)
+	var hdr bytes.Buffer
+	binary.Write(&hdr, binary.LittleEndian, []uint32{kdbxSig1, kdbxSig2, 4 << 16})
+	field(&hdr, kdbxCipherID, cipherID)
+	field(&hdr, kdbxCompression, binary.LittleEndian.AppendUint32(nil, 1))
+	field(&hdr, kdbxMasterSeed, seed)
+	field(&hdr, kdbxEncryptionIV, iv)
+	field(&hdr, kdbxKdfParameters, dict.Bytes())
+	field(&hdr, kdbxEndOfHeader, []byte("\r\n\r\n"))
+
+	pw := sha256.Sum256([]byte(password))
+	composite := sha256.Sum256(pw[:])
+	transformed, err := kdbxTransformKey(context.Background(), kdfParams, composite[:])
+	if err != nil {
+		t.Fatalf("transform key: %v", err)
+	}
+	encKey := sha256.Sum256(append(append([]byte(nil), seed...), transformed...))
+	hmacKey := sha512.Sum512(append(append(append([]byte(nil), seed...), transformed...), 1))
+
+	var payload []byte
+	if ivLen == 12 {
+		c, _ := chacha20.NewUnauthenticatedCipher(encKey[:], iv)
+		payload = make([]byte, zipped.Len())
+		c.XORKeyStream(payload, zipped.Bytes())
+	} else {
+		var block cipher.Block
+		if bytes.Equal(cipherID, kdbxCipherAES) {
+			block, _ = aes.NewCipher(encKey[:])
+		} else {
+			block, _ = twofish.NewCipher(encKey[:])
+		}
+		n := 16 - zipped.Len()%16
+		pt := append(zipped.Bytes(), bytes.Repeat([]byte{byte(n)}, n)...)
+		payload = make([]byte, len(pt))
+		cipher.NewCBCEncrypter(block, iv).CryptBlocks(payload, pt)
+	}
+
+	out := bytes.NewBuffer(append([]byte(nil), hdr.Bytes()...))
+	sum := sha256.Sum256(hdr.Bytes())
+	out.Write(sum[:])
+	out.Write(kdbxHMAC(hmacKey[:], ^uint64(0), hdr.Bytes()))
+	for i, block := range [][]byte{payload, nil} {
+		out.Write(kdbxHMAC(hmacKey[:], uint64(i), block))
+		binary.Write(out, binary.LittleEndian, uint32(len(block)))
+		out.Write(block)
+	}
+	return out.Bytes()
+}
+
+func TestKeePassKDFLimits(t *testing.T) {
+	composite := make([]byte, 32)
+	dict := func(kdf [][2]any) map[string][]byte {
+		out := map[string][]byte{}
+		for _, kv := range kdf {
+			switch v := kv[1].(type) {
+			case []byte:
+				out[kv[0].(string)] = v
+			case uint32:
+				out[kv[0].(string)] = binary.LittleEndian.AppendUint32(nil, v)
+			case uint64:
+				out[kv[0].(string)] = binary.LittleEndian.AppendUint64(nil, v)
+			}
+		}
+		return out
+	}
+	ctx := context.Background()
+	aesKDF := func(rounds uint64) map[string][]byte {
+		return dict([][2]any{{"$UUID", kdbxKdfAES}, {"R", rounds}, {"S", randBytes(t, 32)}})
+	}
+	if _, err := kdbxTransformKey(ctx, aesKDF(1<<40), composite); err == nil {
+		t.Fatal("unbounded AES-KDF rounds accepted")
+	}
+	argon := dict(kdbxArgon2Params(kdbxKdfArgon2d, randBytes(t, 32)))
+	argon["I"] = binary.LittleEndian.AppendUint64(nil, 1<<31)
+	if _, err := kdbxTransformKey(ctx, argon, composite); err == nil {
+		t.Fatal("unbounded Argon2 iterations accepted")
+	}
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := kdbxTransformKey(cancelled, aesKDF(kdbxMaxRounds), composite); !errors.Is(err, context.Canceled) {
+		t.Fatalf("AES-KDF with cancelled context: %v", err)
+	}
+	argon["I"] = binary.LittleEndian.AppendUint64(nil, 2)
+	if _, err := kdbxTransformKey(cancelled, argon, composite); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Argon2d with cancelled context: %v", err)
+	}
+}
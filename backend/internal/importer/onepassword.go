@@ -0,0 +1,307 @@
+package importer
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"project-crypto/internal/vault"
+)
+
+// maxOnePasswordData bounds export.data, which is read into memory.
+const maxOnePasswordData = 64 << 20
+
+type opuxExport struct {
+	Accounts []struct {
+		Vaults []struct {
+			Attrs struct {
+				Name string `json:"name"`
+			} `json:"attrs"`
+			Items []opuxItem `json:"items"`
+		} `json:"vaults"`
+	} `json:"accounts"`
+}
+
+type opuxItem struct {
+	FavIndex     int    `json:"favIndex"`
+	State        string `json:"state"`
+	CategoryUUID string `json:"categoryUuid"`
+	Details      struct {
+		LoginFields []struct {
+			Value       string `json:"value"`
+			Name        string `json:"name"`
+			FieldType   string `json:"fieldType"`
+			Designation string `json:"designation"`
+		} `json:"loginFields"`
+		NotesPlain string `json:"notesPlain"`
+		Password   string `json:"password"`
+		Sections   []struct {
+			Title  string `json:"title"`
+			Fields []struct {
+				Title string                     `json:"title"`
+				ID    string                     `json:"id"`
+				Value map[string]json.RawMessage `json:"value"`
+			} `json:"fields"`
+		} `json:"sections"`
+	} `json:"details"`
+	Overview struct {
+		Title string `json:"title"`
+		URL   string `json:"url"`
+		URLs  []struct {
+			URL string `json:"url"`
+		} `json:"urls"`
+		Tags []string `json:"tags"`
+	} `json:"overview"`
+}
+
+// 1Password item categories.
+const (
+	opLogin    = "001"
+	opCard     = "002"
+	opNote     = "003"
+	opIdentity = "004"
+	opPassword = "005"
+	opDatabase = "102"
+	opAPI      = "112"
+	opSSHKey   = "114"
+)
+
+// opFieldMap maps the section field ids of each category onto schema
+// fields. Anything not listed becomes a custom field.
+var opFieldMap = map[string]map[string]string{
+	opCard: {
+		"cardholder": "cardholder", "type": "network", "ccnum": "number", "cvv": "cvv",
+	},
+	opIdentity: {
+		"email": "email", "defphone": "phone", "cellphone": "phone", "address": "address",
+		"birthdate": "birth_date",
+	},
+	opDatabase: {
+		"database_type": "engine", "hostname": "host", "port": "port", "database": "database",
+		"username": "username", "password": "password",
+	},
+	opAPI: {
+		"credential": "key", "hostname": "url", "expires": "expires",
+	},
+	opSSHKey: {
+		"private_key": "private_key",
+	},
+}
+
+// parseOnePassword reads a 1PUX export: a zip with the whole export in
+// export.data as JSON. Each 1Password vault becomes a top-level folder.
+// Attachments under files/ are not imported.
+func parseOnePassword(data []byte) ([]Record, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("importer: 1password: %w", err)
+	}
+	var raw []byte
+	for _, f := range zr.File {
+		if f.Name != "export.data" {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, fmt.Errorf("importer: 1password: %w", err)
+		}
+		raw, err = io.ReadAll(io.LimitReader(rc, maxOnePasswordData+1))
+		rc.Close()
+		if err != nil {
+			return nil, fmt.Errorf("importer: 1password: %w", err)
+		}
+		if len(raw) > maxOnePasswordData {
+			return nil, errors.New("importer: 1password: export.data is too large")
+		}
+	}
+	if raw == nil {
+		return nil, errors.New("importer: 1password: export.data missing; is this a .1pux file?")
+	}
+	var exp opuxExport
+	if err := json.Unmarshal(raw, &exp); err != nil {
+		return nil, fmt.Errorf("importer: 1password: %w", err)
+	}
+
+	var out []Record
+	for _, acct := range exp.Accounts {
+		for _, v := range acct.Vaults {
+			folder := cleanFolder(strings.ReplaceAll(v.Attrs.Name, "/", "-"))
+			for _, it := range v.Items {
+				if it.State == "trashed" {
+					continue
+				}
+				rec := opuxRecord(it)
+				rec.Folder = folder
+				rec.Favorite = it.FavIndex > 0
+				rec.Tags = it.Overview.Tags
+				if it.State == "archived" {
+					rec.Tags = append(rec.Tags, "archived")
+				}
+				out = append(out, rec)
+			}
+		}
+	}
+	return out, nil
+}
+
+func opuxRecord(it opuxItem) Record {
+	var b *builder
+	d := it.Details
+	switch it.CategoryUUID {
+	case opLogin, opPassword:
+		b = newBuilder("login", it.Overview.Title)
+		b.set("site", it.Overview.URL)
+		b.set("password", d.Password)
+		for _, f := range d.LoginFields {
+			switch {
+			case f.Designation == "username":
+				b.set("username", f.Value)
+			case f.Designation == "password":
+				b.set("password", f.Value)
+			case f.FieldType == "P":
+				b.custom(f.Name, vault.KindHidden, f.Value)
+			default:
+				b.custom(f.Name, vault.KindText, f.Value)
+			}
+		}
+		for _, u := range it.Overview.URLs {
+			if u.URL != it.Overview.URL {
+				b.custom("Website", vault.KindURL, u.URL)
+			}
+		}
+	case opCard:
+		b = newBuilder("card", it.Overview.Title)
+	case opIdentity:
+		b = newBuilder("identity", it.Overview.Title)
+	case opDatabase:
+		b = newBuilder("database", it.Overview.Title)
+	case opAPI:
+		b = newBuilder("api_credential", it.Overview.Title)
+	case opSSHKey:
+		b = newBuilder("ssh_key", it.Overview.Title)
+	default:
+		b = newBuilder("note", it.Overview.Title)
+	}
+	b.set("notes", d.NotesPlain)
+
+	fields := opFieldMap[it.CategoryUUID]
+	var first, initial, last string
+	for _, sec := range d.Sections {
+		for _, f := range sec.Fields {
+			val, kind := opuxValue(f.Value)
+			if val == "" {
+				continue
+			}
+			switch {
+			case kind == vault.KindTOTP:
+				b.totp(val)
+				continue
+			case it.CategoryUUID == opIdentity && f.ID == "firstname":
+				first = val
+				continue
+			case it.CategoryUUID == opIdentity && f.ID == "initial":
+				initial = val
+				continue
+			case it.CategoryUUID == opIdentity && f.ID == "lastname":
+				last = val
+				continue
+			case it.CategoryUUID == opCard && f.ID == "expiry" && len(val) == 6:
+				b.set("exp_year", val[:4])
+				b.set("exp_month", strings.TrimPrefix(val[4:], "0"))
+				continue
+			case it.CategoryUUID == opSSHKey && f.ID == "private_key":
+				priv, pub, fp := opuxSSHKey(f.Value)
+				b.set("private_key", priv)
+				b.set("public_key", pub)
+				b.set("fingerprint", fp)
+				continue
+			}
+			if name, ok := fields[f.ID]; ok && b.rec.Item.Fields[name] == "" {
+				b.set(name, val)
+				continue
+			}
+			label := f.Title
+			if label == "" {
+				label = f.ID
+			}
+			b.custom(label, kind, val)
+		}
+	}
+	if it.CategoryUUID == opIdentity {
+		name := joinNonEmpty(" ", first, initial, last)
+		if name == "" {
+			name = it.Overview.Title
+		}
+		b.set("name", name)
+	}
+	return b.record()
+}
+
+// opuxValue returns the text of a section field value, which is an object
+// with a single key naming its type, and the custom field kind for it.
+func opuxValue(v map[string]json.RawMessage) (string, vault.FieldKind) {
+	for typ, raw := range v {
+		var s string
+		_ = json.Unmarshal(raw, &s)
+		switch typ {
+		case "concealed", "creditCardNumber":
+			return s, vault.KindHidden
+		case "totp":
+			return s, vault.KindTOTP
+		case "url":
+			return s, vault.KindURL
+		case "email":
+			var e struct {
+				Address string `json:"email_address"`
+			}
+			if json.Unmarshal(raw, &e) == nil && e.Address != "" {
+				s = e.Address
+			}
+			return s, vault.KindEmail
+		case "date":
+			var n int64
+			if json.Unmarshal(raw, &n) == nil && n != 0 {
+				return time.Unix(n, 0).UTC().Format("2006-01-02"), vault.KindDate
+			}
+			return "", vault.KindDate
+		case "monthYear":
+			var n int
+			if json.Unmarshal(raw, &n) == nil && n != 0 {
+				return strconv.Itoa(n), vault.KindText
+			}
+			return "", vault.KindText
+		case "address":
+			var a struct {
+				Street, City, State, Zip, Country string
+			}
+			_ = json.Unmarshal(raw, &a)
+			return joinNonEmpty(", ", a.Street, a.City, joinNonEmpty(" ", a.State, a.Zip), a.Country), vault.KindText
+		case "sshKey":
+			priv, _, _ := opuxSSHKey(v)
+			return priv, vault.KindHidden
+		default:
+			return s, vault.KindText
+		}
+	}
+	return "", vault.KindText
+}
+
+func opuxSSHKey(v map[string]json.RawMessage) (priv, pub, fingerprint string) {
+	var k struct {
+		PrivateKey string `json:"privateKey"`
+		Metadata   struct {
+			PublicKey   string `json:"publicKey"`
+			Fingerprint string `json:"fingerprint"`
+		} `json:"metadata"`
+	}
+	if raw, ok := v["sshKey"]; ok {
+		_ = json.Unmarshal(raw, &k)
+	}
+	return k.PrivateKey, k.Metadata.PublicKey, k.Metadata.Fingerprint
+}
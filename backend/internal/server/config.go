@@ -32,6 +32,10 @@ type Config struct {
 	TOTPIssuer      string
 	SMTP            SMTPConfig
 	SeedUsers       []SeedUser
+
+	// BreachRange is a breach.Open spec: a local range file or directory,
+	// or the URL of a local range server. Empty disables breach checks.
+	BreachRange string
 }
 
 func (c *Config) setDefaults() {
@@ -0,0 +1,126 @@
+package server
+
+import (
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"project-crypto/internal/vault"
+)
+
+// handleItemAttachments serves /api/items/{id}/attachments and its children:
+//
+//	GET    .../attachments                list attachments
+//	POST   .../attachments?name=file.pdf  upload the raw request body
+//	GET    .../attachments/{att}          download one attachment
+//	DELETE .../attachments/{att}          delete one attachment
+func (s *Server) handleItemAttachments(w http.ResponseWriter, r *http.Request, v vault.Vault, id, attID string) {
+	if attID == "" {
+		switch r.Method {
+		case http.MethodGet:
+			atts, err := v.ListAttachments(r.Context(), id)
+			if err != nil {
+				http.Error(w, err.Error(), vaultErrStatus(err, http.StatusBadRequest))
+				return
+			}
+			writeJSON(w, atts)
+
+		case http.MethodPost:
+			name := strings.TrimSpace(r.URL.Query().Get("name"))
+			if name == "" {
+				http.Error(w, "name required", http.StatusBadRequest)
+				return
+			}
+			ctype := r.Header.Get("Content-Type")
+			if ctype == "" {
+				ctype = "application/octet-stream"
+			}
+			meta, err := v.AddAttachment(r.Context(), id, name, ctype, r.Body)
+			if err != nil {
+				http.Error(w, err.Error(), vaultErrStatus(err, http.StatusBadRequest))
+				return
+			}
+			writeJSONStatus(w, http.StatusCreated, meta)
+
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+		return
+	}
+	if strings.Contains(attID, "/") {
+		http.NotFound(w, r)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		// Look the metadata up before streaming: ReadAttachment holds the
+		// vault's read lock while it writes, so out must not call back in.
+		atts, err := v.ListAttachments(r.Context(), id)
+		if err != nil {
+			http.Error(w, err.Error(), vaultErrStatus(err, http.StatusBadRequest))
+			return
+		}
+		out := &attachmentWriter{w: w}
+		for _, a := range atts {
+			if a.ID == attID {
+				out.meta, out.found = a, true
+			}
+		}
+		if _, err := v.ReadAttachment(r.Context(), id, attID, out); err != nil {
+			if !out.started {
+				http.Error(w, err.Error(), vaultErrStatus(err, http.StatusInternalServerError))
+			}
+			return
+		}
+		// An empty attachment never reaches Write.
+		out.start()
+
+	case http.MethodDelete:
+		if err := v.DeleteAttachment(r.Context(), id, attID); err != nil {
+			http.Error(w, err.Error(), vaultErrStatus(err, http.StatusBadRequest))
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// attachmentWriter sets the download headers on the first write, so an
+// error before any plaintext is produced can still be sent as JSON. The
+// content type comes from the uploader, so the response is always a
+// download the browser must not sniff or render on the API origin.
+type attachmentWriter struct {
+	w       http.ResponseWriter
+	meta    vault.AttachmentMeta
+	found   bool
+	started bool
+}
+
+func (a *attachmentWriter) start() {
+	if a.started {
+		return
+	}
+	a.started = true
+	h := a.w.Header()
+	h.Set("Content-Type", "application/octet-stream")
+	h.Set("Content-Disposition", "attachment")
+	h.Set("X-Content-Type-Options", "nosniff")
+	if m := a.meta; a.found {
+		if m.MIME != "" {
+			h.Set("Content-Type", m.MIME)
+		}
+		h.Set("Content-Length", strconv.FormatInt(m.Size, 10))
+		if d := mime.FormatMediaType("attachment", map[string]string{"filename": m.Name}); d != "" {
+			h.Set("Content-Disposition", d)
+		}
+	}
+}
+
+func (a *attachmentWriter) Write(p []byte) (int, error) {
+	a.start()
+	return a.w.Write(p)
+}
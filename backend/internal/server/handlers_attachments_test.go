@@ -0,0 +1,33 @@
+package server
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"project-crypto/internal/vault"
+)
+
+func TestAttachmentWriterHeaders(t *testing.T) {
+	rec := httptest.NewRecorder()
+	out := &attachmentWriter{w: rec, meta: vault.AttachmentMeta{Name: "page.html", MIME: "text/html"}, found: true}
+	out.start()
+	h := rec.Header()
+	if h.Get("X-Content-Type-Options") != "nosniff" {
+		t.Fatalf("nosniff missing: %v", h)
+	}
+	if got := h.Get("Content-Disposition"); got != `attachment; filename=page.html` {
+		t.Fatalf("Content-Disposition = %q", got)
+	}
+	if h.Get("Content-Length") != "0" {
+		t.Fatalf("Content-Length = %q", h.Get("Content-Length"))
+	}
+
+	rec = httptest.NewRecorder()
+	out = &attachmentWriter{w: rec}
+	if _, err := out.Write([]byte("x")); err != nil {
+		t.Fatal(err)
+	}
+	if h := rec.Header(); h.Get("Content-Disposition") != "attachment" || h.Get("Content-Type") != "application/octet-stream" {
+		t.Fatalf("headers without metadata: %v", h)
+	}
+}
@@ -29,6 +29,8 @@ type loginResp struct {
 	ExpiresAt time.Time `json:"expires_at"`
 	Vault     string    `json:"vault"`
 	Note      string    `json:"note,omitempty"`
+
+	KDFUpgraded bool `json:"kdf_upgraded,omitempty"`
 }
 
 type signupReq struct {
@@ -108,7 +110,7 @@ func (s *Server) handleSignup(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "valid email required", http.StatusBadRequest)
 		return
 	}
-	if err := validatePassword(req.Password); err != nil {
+	if err := s.validatePassword(r.Context(), req.Password, req.Username, req.Email); err != nil {
 		http.Error(w, "weak password: "+err.Error(), http.StatusBadRequest)
 		return
 	}
@@ -357,24 +359,6 @@ func (s *Server) clearChallenge(id string) {
 	}
 }
 
-func shouldResetVault(err error) bool {
-	if err == nil {
-		return false
-	}
-	if errors.Is(err, cr.ErrCiphertextTooShort) {
-		return true
-	}
-	var syntaxErr *json.SyntaxError
-	if errors.As(err, &syntaxErr) {
-		return true
-	}
-	var typeErr *json.UnmarshalTypeError
-	if errors.As(err, &typeErr) {
-		return true
-	}
-	return false
-}
-
 func (s *Server) completeLogin(ctx context.Context, username string, master []byte, roles []auth.Role) (loginResp, error) {
 	metaColl, blobColl := collectionNames(username)
 
@@ -409,19 +393,10 @@ func (s *Server) completeLogin(ctx context.Context, username string, master []by
 			return loginResp{}, fmt.Errorf("create vault: %w", err)
 		}
 	} else {
+		// A vault that fails to open is reported, never replaced: the
+		// error may come from one damaged blob the user can still recover.
 		if err := v.Unlock(ctx, masterCopy); err != nil {
-			if shouldResetVault(err) {
-				s.logger.Printf("[vault] %s vault corrupted (%v); recreating", username, err)
-				if nukeErr := s.nukeUserVault(ctx, username); nukeErr != nil {
-					return loginResp{}, fmt.Errorf("unlock: %w", err)
-				}
-				v = vault.NewWithStores(vpath, blobs, meta)
-				if err := v.Create(ctx, masterCopy); err != nil {
-					return loginResp{}, fmt.Errorf("recreate vault: %w", err)
-				}
-			} else {
-				return loginResp{}, fmt.Errorf("unlock: %w", err)
-			}
+			return loginResp{}, fmt.Errorf("unlock: %w", err)
 		}
 	}
 
@@ -431,10 +406,11 @@ func (s *Server) completeLogin(ctx context.Context, username string, master []by
 	}
 
 	s.mu.Lock()
-	s.sessions[username] = &userSession{v: v, vpath: vpath, unlocked: true}
+	s.sessions[username] = newSession(v, vpath, time.Now())
 	s.mu.Unlock()
 
-	return loginResp{Token: tok, ExpiresAt: exp, Vault: filepath.Base(vpath)}, nil
+	upgraded := s.logUnlock(username, v)
+	return loginResp{Token: tok, ExpiresAt: exp, Vault: filepath.Base(vpath), KDFUpgraded: upgraded}, nil
 }
 
 func (s *Server) handleForgotPassword(w http.ResponseWriter, r *http.Request) {
@@ -530,10 +506,6 @@ func (s *Server) handleResetPassword(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "token and next password required", http.StatusBadRequest)
 		return
 	}
-	if err := validatePassword(next); err != nil {
-		http.Error(w, "weak password: "+err.Error(), http.StatusBadRequest)
-		return
-	}
 
 	ip := getClientIP(r)
 	if !s.rlResetIP.allow(ip) {
@@ -563,6 +535,10 @@ func (s *Server) handleResetPassword(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "invalid token", http.StatusUnauthorized)
 		return
 	}
+	if err := s.validatePassword(r.Context(), next, user.Username, user.Email); err != nil {
+		http.Error(w, "weak password: "+err.Error(), http.StatusBadRequest)
+		return
+	}
 
 	hash, err := auth.HashPassword(auth.DefaultArgon, next)
 	if err != nil {
@@ -612,7 +588,7 @@ func (s *Server) handleChangePassword(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "new password must differ from current password", http.StatusBadRequest)
 		return
 	}
-	if err := validatePassword(next); err != nil {
+	if err := s.validatePassword(r.Context(), next, claims.Sub, current); err != nil {
 		http.Error(w, "weak password: "+err.Error(), http.StatusBadRequest)
 		return
 	}
@@ -670,7 +646,7 @@ func (s *Server) handleChangePassword(w http.ResponseWriter, r *http.Request) {
 			http.Error(w, "unlock: "+err.Error(), http.StatusUnauthorized)
 			return
 		}
-		sess = &userSession{v: v, vpath: vpath, unlocked: true}
+		sess = newSession(v, vpath, time.Now())
 	} else if !sess.unlocked {
 		if err := sess.v.Unlock(ctx, masterCurrent); err != nil {
 			http.Error(w, "unlock: "+err.Error(), http.StatusUnauthorized)
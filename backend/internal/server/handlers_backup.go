@@ -0,0 +1,65 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime"
+	"net/http"
+	"strconv"
+	"time"
+
+	"project-crypto/internal/auth"
+	cr "project-crypto/internal/crypto"
+)
+
+// backupRequest is the body of POST /api/backup. The server never keeps
+// the master password, so the client sends the passphrase the archive is
+// sealed under: the master password itself or a separate one.
+type backupRequest struct {
+	Passphrase string `json:"passphrase"`
+}
+
+// handleBackup returns an encrypted archive of the session's vault. The
+// archive is built in memory first so a failure is still reported as an
+// error rather than a truncated download.
+func (s *Server) handleBackup(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	claims, ok := auth.FromContext(r.Context())
+	if !ok {
+		http.Error(w, "no auth context", http.StatusUnauthorized)
+		return
+	}
+	v, err := s.withSessionVault(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	var req backupRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "bad json", http.StatusBadRequest)
+		return
+	}
+	if req.Passphrase == "" {
+		http.Error(w, "passphrase required", http.StatusBadRequest)
+		return
+	}
+
+	var buf bytes.Buffer
+	pass := []byte(req.Passphrase)
+	_, err = v.Backup(r.Context(), &buf, pass)
+	cr.Zero(pass)
+	if err != nil {
+		http.Error(w, err.Error(), vaultErrStatus(err, http.StatusInternalServerError))
+		return
+	}
+	name := "vault-" + claims.Sub + "-" + time.Now().UTC().Format("20060102-150405") + ".vltb"
+	h := w.Header()
+	h.Set("Content-Type", "application/octet-stream")
+	h.Set("Content-Length", strconv.Itoa(buf.Len()))
+	h.Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name}))
+	h.Set("Cache-Control", "no-store")
+	_, _ = buf.WriteTo(w)
+}
@@ -0,0 +1,82 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+type folderRequest struct {
+	Name   string  `json:"name"`
+	Parent *string `json:"parent"`
+}
+
+func (s *Server) handleFolders(w http.ResponseWriter, r *http.Request) {
+	v, err := s.withSessionVault(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	id := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/folders"), "/")
+	if id == "" {
+		switch r.Method {
+		case http.MethodGet:
+			folders, err := v.ListFolders(r.Context())
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			writeJSON(w, folders)
+
+		case http.MethodPost:
+			var req folderRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, "bad json", http.StatusBadRequest)
+				return
+			}
+			f, err := v.CreateFolder(r.Context(), req.Name, deref(req.Parent))
+			if err != nil {
+				http.Error(w, err.Error(), vaultErrStatus(err, http.StatusBadRequest))
+				return
+			}
+			writeJSONStatus(w, http.StatusCreated, f)
+
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPut:
+		var req folderRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "bad json", http.StatusBadRequest)
+			return
+		}
+		f, err := v.UpdateFolder(r.Context(), id, req.Name, req.Parent)
+		if err != nil {
+			http.Error(w, err.Error(), vaultErrStatus(err, http.StatusBadRequest))
+			return
+		}
+		writeJSON(w, f)
+
+	case http.MethodDelete:
+		if err := v.DeleteFolder(r.Context(), id); err != nil {
+			http.Error(w, err.Error(), vaultErrStatus(err, http.StatusBadRequest))
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func deref(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
@@ -0,0 +1,82 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"project-crypto/internal/generator"
+)
+
+// generateRequest is the body of POST /api/generate. Type is "password"
+// (the default) or "passphrase"; the matching options apply. The character
+// classes are pointers so that naming some classes selects exactly those;
+// a class left out is used only when no class is turned on.
+type generateRequest struct {
+	Type           string `json:"type"`
+	Length         int    `json:"length"`
+	Lower          *bool  `json:"lower"`
+	Upper          *bool  `json:"upper"`
+	Digits         *bool  `json:"digits"`
+	Symbols        *bool  `json:"symbols"`
+	AvoidAmbiguous bool   `json:"avoid_ambiguous"`
+	Exclude        string `json:"exclude"`
+	generator.PassphraseOptions
+}
+
+// options returns the password options of req over the defaults.
+func (req generateRequest) options() generator.Options {
+	o := generator.DefaultOptions()
+	o.Length, o.AvoidAmbiguous, o.Exclude = req.Length, req.AvoidAmbiguous, req.Exclude
+	classes := []*bool{req.Lower, req.Upper, req.Digits, req.Symbols}
+	chosen := false
+	for _, c := range classes {
+		chosen = chosen || (c != nil && *c)
+	}
+	on := make([]bool, len(classes))
+	for i, c := range classes {
+		on[i] = !chosen
+		if c != nil {
+			on[i] = *c
+		}
+	}
+	o.Lower, o.Upper, o.Digits, o.Symbols = on[0], on[1], on[2], on[3]
+	return o
+}
+
+// handleGenerate creates a password or passphrase. GET returns a password
+// with the default options.
+func (s *Server) handleGenerate(w http.ResponseWriter, r *http.Request) {
+	req := generateRequest{
+		Length:            generator.DefaultOptions().Length,
+		PassphraseOptions: generator.DefaultPassphraseOptions(),
+	}
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "bad json", http.StatusBadRequest)
+			return
+		}
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var res generator.Result
+	var err error
+	switch req.Type {
+	case "", "password":
+		res, err = generator.Password(req.options())
+	case "passphrase":
+		res, err = generator.Passphrase(req.PassphraseOptions)
+	default:
+		http.Error(w, "type must be password or passphrase", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, res)
+}
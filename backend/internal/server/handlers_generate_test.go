@@ -0,0 +1,31 @@
+package server
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"project-crypto/internal/generator"
+)
+
+func TestGenerateRequestOptions(t *testing.T) {
+	for _, tc := range []struct {
+		body string
+		want generator.Options
+	}{
+		{`{}`, generator.DefaultOptions()},
+		{`{"lower": true}`, generator.Options{Length: 20, Lower: true}},
+		{`{"digits": true, "upper": false, "length": 8}`, generator.Options{Length: 8, Digits: true}},
+		{`{"symbols": false}`, generator.Options{Length: 20, Lower: true, Upper: true, Digits: true}},
+		{`{"exclude": "abc", "avoid_ambiguous": true}`, generator.Options{Length: 20, Lower: true, Upper: true, Digits: true, Symbols: true, AvoidAmbiguous: true, Exclude: "abc"}},
+	} {
+		req := generateRequest{Length: generator.DefaultOptions().Length}
+		if err := json.NewDecoder(strings.NewReader(tc.body)).Decode(&req); err != nil {
+			t.Fatalf("%s: %v", tc.body, err)
+		}
+		if got := req.options(); !reflect.DeepEqual(got, tc.want) {
+			t.Fatalf("%s: options = %+v, want %+v", tc.body, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"project-crypto/internal/vault"
+)
+
+// handleItemHistory serves /api/items/{id}/history and its children:
+//
+//	GET  .../history                      list revisions, newest first
+//	GET  .../history/{version}            decrypt one revision
+//	GET  .../history/{version}/diff[?to=] diff a revision against current or ?to
+//	POST .../history/{version}/restore    restore a revision as a new version
+func (s *Server) handleItemHistory(w http.ResponseWriter, r *http.Request, v vault.Vault, id, rest string) {
+	if rest == "" {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		revs, err := v.History(r.Context(), id)
+		if err != nil {
+			http.Error(w, err.Error(), vaultErrStatus(err, http.StatusNotFound))
+			return
+		}
+		writeJSON(w, revs)
+		return
+	}
+
+	parts := strings.Split(rest, "/")
+	version, err := strconv.Atoi(parts[0])
+	if err != nil || version <= 0 || len(parts) > 2 {
+		http.Error(w, "bad revision", http.StatusBadRequest)
+		return
+	}
+	action := ""
+	if len(parts) == 2 {
+		action = parts[1]
+	}
+
+	switch {
+	case action == "" && r.Method == http.MethodGet:
+		it, err := v.GetRevision(r.Context(), id, version)
+		if err != nil {
+			http.Error(w, err.Error(), vaultErrStatus(err, http.StatusNotFound))
+			return
+		}
+		writeJSON(w, it)
+
+	case action == "diff" && r.Method == http.MethodGet:
+		from, err := v.GetRevision(r.Context(), id, version)
+		if err != nil {
+			http.Error(w, err.Error(), vaultErrStatus(err, http.StatusNotFound))
+			return
+		}
+		var to vault.Item
+		if toParam := r.URL.Query().Get("to"); toParam != "" {
+			toVersion, err := strconv.Atoi(toParam)
+			if err != nil {
+				http.Error(w, "bad revision", http.StatusBadRequest)
+				return
+			}
+			to, err = v.GetRevision(r.Context(), id, toVersion)
+			if err != nil {
+				http.Error(w, err.Error(), vaultErrStatus(err, http.StatusNotFound))
+				return
+			}
+		} else {
+			to, err = v.GetItem(r.Context(), id)
+			if err != nil {
+				http.Error(w, err.Error(), vaultErrStatus(err, http.StatusNotFound))
+				return
+			}
+		}
+		changes := vault.Diff(from, to)
+		if changes == nil {
+			changes = []vault.FieldChange{}
+		}
+		writeJSON(w, changes)
+
+	case action == "restore" && r.Method == http.MethodPost:
+		if err := v.RestoreRevision(r.Context(), id, version); err != nil {
+			http.Error(w, err.Error(), vaultErrStatus(err, http.StatusBadRequest))
+			return
+		}
+		writeJSON(w, map[string]any{"restored": version})
+
+	case action == "" || action == "diff" || action == "restore":
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+
+	default:
+		http.NotFound(w, r)
+	}
+}
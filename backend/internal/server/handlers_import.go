@@ -0,0 +1,134 @@
+package server
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+
+	cr "project-crypto/internal/crypto"
+	"project-crypto/internal/importer"
+)
+
+// maxImportSize bounds an import request. Exports are held in memory
+// while they are parsed.
+const maxImportSize = 32 << 20
+
+// handleImport imports another password manager's export into the
+// session's vault. It takes multipart/form-data with the fields:
+//
+//	file        the export (required)
+//	format      one of importer.Formats; detected when empty
+//	password    the export's password, for encrypted exports
+//	dry_run     "true" to only report what would be imported
+//	duplicates  "skip" (default) or "keep"
+//
+// The form is read part by part into memory rather than with
+// ParseMultipartForm, which spills large files to disk in plaintext.
+func (s *Server) handleImport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	v, err := s.withSessionVault(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportSize)
+	mr, err := r.MultipartReader()
+	if err != nil {
+		http.Error(w, "multipart form required", http.StatusBadRequest)
+		return
+	}
+
+	var data, password []byte
+	defer func() {
+		cr.Zero(data)
+		cr.Zero(password)
+	}()
+	var fileName, format, dryRun, duplicates string
+	for {
+		part, err := mr.NextPart()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		var tooBig *http.MaxBytesError
+		if errors.As(err, &tooBig) {
+			http.Error(w, "export too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		if err != nil {
+			http.Error(w, "bad multipart form", http.StatusBadRequest)
+			return
+		}
+		var buf bytes.Buffer
+		_, err = io.Copy(&buf, part)
+		part.Close()
+		if errors.As(err, &tooBig) {
+			http.Error(w, "export too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		if err != nil {
+			http.Error(w, "bad multipart form", http.StatusBadRequest)
+			return
+		}
+		switch part.FormName() {
+		case "file":
+			data, fileName = buf.Bytes(), part.FileName()
+		case "password":
+			password = buf.Bytes()
+		case "format":
+			format = buf.String()
+		case "dry_run":
+			dryRun = buf.String()
+		case "duplicates":
+			duplicates = buf.String()
+		default:
+			cr.Zero(buf.Bytes())
+		}
+	}
+	if data == nil {
+		http.Error(w, "file required", http.StatusBadRequest)
+		return
+	}
+
+	var f importer.Format
+	if format == "" {
+		f, err = importer.Detect(fileName, data)
+	} else {
+		f, err = importer.ParseFormat(format)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	opts := importer.Options{Duplicates: importer.Duplicates(duplicates)}
+	if dryRun != "" {
+		if opts.DryRun, err = strconv.ParseBool(dryRun); err != nil {
+			http.Error(w, "dry_run must be true or false", http.StatusBadRequest)
+			return
+		}
+	}
+	if opts.Duplicates != "" && opts.Duplicates != importer.SkipDuplicates && opts.Duplicates != importer.KeepDuplicates {
+		http.Error(w, "duplicates must be skip or keep", http.StatusBadRequest)
+		return
+	}
+
+	recs, err := importer.Parse(r.Context(), f, data, password)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	report, err := importer.Import(r.Context(), v, recs, opts)
+	if err != nil {
+		http.Error(w, err.Error(), vaultErrStatus(err, http.StatusInternalServerError))
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, struct {
+		Format importer.Format `json:"format"`
+		importer.Report
+	}{f, report})
+}
@@ -1,10 +1,17 @@
 package server
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
 	"strings"
 
+	"project-crypto/internal/strength"
 	"project-crypto/internal/vault"
 )
 
@@ -17,18 +24,31 @@ func (s *Server) handleItems(w http.ResponseWriter, r *http.Request) {
 
 	switch r.Method {
 	case http.MethodGet:
-
-		q := vault.Query{Type: "login"}
-
-		metas, err := v.List(r.Context(), q)
+		params := r.URL.Query()
+		q, err := itemQuery(params)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
+		reveal := params.Get("reveal") == "true"
 
-		out := make([]map[string]any, 0, len(metas))
-		for _, m := range metas {
+		page, err := v.ListPage(r.Context(), q)
+		if err != nil {
+			http.Error(w, err.Error(), vaultErrStatus(err, http.StatusBadRequest))
+			return
+		}
+		w.Header().Set("X-Total-Count", strconv.Itoa(page.Total))
+		if page.Next != "" {
+			w.Header().Set("X-Next-Cursor", page.Next)
+		}
+
+		out := make([]map[string]any, 0, len(page.Items))
+		for _, m := range page.Items {
 			it, err := v.GetItem(r.Context(), m.ID)
+			if errors.Is(err, vault.ErrIntegrity) {
+				http.Error(w, err.Error(), vaultErrStatus(err, http.StatusInternalServerError))
+				return
+			}
 			if err != nil {
 				continue
 			}
@@ -42,7 +62,7 @@ func (s *Server) handleItems(w http.ResponseWriter, r *http.Request) {
 				}
 			}
 			if _, ok := fields["site"]; !ok || fields["site"] == "" {
-				switch strings.ToLower(m.Type) {
+				switch vault.CanonicalType(m.Type) {
 				case "card":
 					l4 := last4Digits(fields["number"])
 					if l4 != "" {
@@ -60,42 +80,51 @@ func (s *Server) handleItems(w http.ResponseWriter, r *http.Request) {
 					}
 				}
 			}
+			it.Fields = fields
+			var score *itemStrength
+			var breached *int
+			if pw := it.Fields["password"]; pw != "" {
+				score = estimateItem(pw, fields["username"], fields["site"])
+				breached = s.breachCount(r.Context(), pw)
+			}
+			var masked []string
+			if !reveal {
+				masked = maskItem(&it)
+			}
 			out = append(out, map[string]any{
-				"id":      m.ID,
-				"type":    canonType(m.Type),
-				"created": m.Created,
-				"updated": m.Updated,
-				"version": m.Version,
-				"fields":  fields,
+				"id":       m.ID,
+				"type":     vault.CanonicalType(m.Type),
+				"created":  m.Created,
+				"updated":  m.Updated,
+				"version":  m.Version,
+				"folder":   m.Folder,
+				"tags":     m.Tags,
+				"favorite": m.Favorite,
+				"fields":   it.Fields,
+				"custom":   it.Custom,
+				"masked":   masked,
+				"strength": score,
+				"breached": breached,
 			})
 		}
 		writeJSON(w, out)
 
 	case http.MethodPost:
-		var it vault.Item
-		if err := json.NewDecoder(r.Body).Decode(&it); err != nil {
+		var req itemRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 			http.Error(w, "bad json", http.StatusBadRequest)
 			return
 		}
 
-		it.Type = strings.ToLower(strings.TrimSpace(it.Type))
-		if it.Type == "" {
-			it.Type = "login"
-		}
-		if it.Type != "login" {
-			http.Error(w, "only login items are supported", http.StatusBadRequest)
-			return
-		}
-		if it.Fields == nil || strings.TrimSpace(it.Fields["password"]) == "" {
-			http.Error(w, "fields.password required", http.StatusBadRequest)
-			return
+		if strings.TrimSpace(req.Type) == "" {
+			req.Type = "login"
 		}
-		id, err := v.AddItem(r.Context(), it)
+		ids, err := v.AddItems(r.Context(), []vault.NewItem{{Item: req.Item, Organization: req.Organization}})
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			http.Error(w, err.Error(), vaultErrStatus(err, http.StatusBadRequest))
 			return
 		}
-		writeJSONStatus(w, http.StatusCreated, map[string]string{"id": id})
+		writeJSONStatus(w, http.StatusCreated, map[string]string{"id": ids[0]})
 
 	default:
 		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
@@ -114,37 +143,89 @@ func (s *Server) handleItemByID(w http.ResponseWriter, r *http.Request) {
 		http.NotFound(w, r)
 		return
 	}
+	if i := strings.Index(id, "/"); i >= 0 {
+		rest := strings.Trim(id[i+1:], "/")
+		id = id[:i]
+		switch {
+		case rest == "history" || strings.HasPrefix(rest, "history/"):
+			s.handleItemHistory(w, r, v, id, strings.TrimPrefix(strings.TrimPrefix(rest, "history"), "/"))
+		case rest == "attachments" || strings.HasPrefix(rest, "attachments/"):
+			s.handleItemAttachments(w, r, v, id, strings.TrimPrefix(strings.TrimPrefix(rest, "attachments"), "/"))
+		case rest == "totp":
+			s.handleItemTOTP(w, r, v, id)
+		default:
+			http.NotFound(w, r)
+		}
+		return
+	}
 
 	switch r.Method {
 	case http.MethodGet:
 		it, err := v.GetItem(r.Context(), id)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusNotFound)
+			http.Error(w, err.Error(), vaultErrStatus(err, http.StatusNotFound))
 			return
 		}
+		w.Header().Set("ETag", itemETag(it.Version))
 		writeJSON(w, it)
 
 	case http.MethodPut:
-		var patch vault.Item
+		var patch itemRequest
 		if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
 			http.Error(w, "bad json", http.StatusBadRequest)
 			return
 		}
-
-		pt := strings.ToLower(strings.TrimSpace(patch.Type))
-		if pt != "" && pt != "login" {
-			http.Error(w, "only login items are supported", http.StatusBadRequest)
-			return
+		version, conditional := ifMatch(r)
+		if conditional {
+			patch.Version = version
 		}
-		if err := v.UpdateItem(r.Context(), id, patch); err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
-			return
+		fail := func(err error) {
+			status := vaultErrStatus(err, http.StatusBadRequest)
+			if conditional && errors.Is(err, vault.ErrConflict) {
+				status = http.StatusPreconditionFailed
+			}
+			http.Error(w, err.Error(), status)
+		}
+		// Content goes first so a stale version stops the whole request.
+		// Organizing does not change the version, so an organize-only
+		// request has Organize check it.
+		updates := patch.Type != "" || patch.Fields != nil || patch.Custom != nil || !patch.organizes()
+		if updates {
+			if err := v.UpdateItem(r.Context(), id, patch.Item); err != nil {
+				fail(err)
+				return
+			}
+		}
+		if patch.organizes() {
+			version := patch.Version
+			if updates {
+				version = 0
+			}
+			if err := v.Organize(r.Context(), id, patch.Organization, version); err != nil {
+				fail(err)
+				return
+			}
+		}
+		if updates && patch.Version != 0 {
+			w.Header().Set("ETag", itemETag(patch.Version+1))
 		}
 		writeJSON(w, map[string]any{"updated": true})
 
 	case http.MethodDelete:
-		if err := v.DeleteItem(r.Context(), id); err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+		version, conditional := ifMatch(r)
+		permanent := r.URL.Query().Get("permanent") == "true"
+		// A permanent delete goes through the trash too, so that Purge
+		// only ever sees trashed items.
+		err := v.DeleteItem(r.Context(), id, version)
+		if err == nil && permanent {
+			err = v.Purge(r.Context(), id)
+		}
+		if err != nil {
+			status := vaultErrStatus(err, http.StatusBadRequest)
+			if conditional && errors.Is(err, vault.ErrConflict) {
+				status = http.StatusPreconditionFailed
+			}
+			http.Error(w, err.Error(), status)
 			return
 		}
 		w.WriteHeader(http.StatusNoContent)
@@ -154,6 +235,143 @@ func (s *Server) handleItemByID(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// itemQuery builds a vault.Query from the /api/items query string:
+// type, folder, subfolders, tag (repeatable), favorite, updated_since and
+// created_before (unix seconds), sort (updated, created or title), order
+// (asc or desc), limit and cursor.
+func itemQuery(params url.Values) (vault.Query, error) {
+	q := vault.Query{
+		Type:       vault.CanonicalType(params.Get("type")),
+		Folder:     params.Get("folder"),
+		Subfolders: params.Get("subfolders") == "true",
+		Tags:       params["tag"],
+		Favorite:   params.Get("favorite") == "true",
+		Sort:       vault.SortKey(params.Get("sort")),
+		Cursor:     params.Get("cursor"),
+	}
+	switch params.Get("order") {
+	case "", "asc":
+	case "desc":
+		q.Desc = true
+	default:
+		return q, errors.New("order must be asc or desc")
+	}
+	for name, dst := range map[string]*int64{
+		"updated_since":  &q.UpdatedSince,
+		"created_before": &q.CreatedBefore,
+	} {
+		if s := params.Get(name); s != "" {
+			n, err := strconv.ParseInt(s, 10, 64)
+			if err != nil || n < 0 {
+				return q, fmt.Errorf("%s must be a unix timestamp", name)
+			}
+			*dst = n
+		}
+	}
+	if s := params.Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 || n > maxPageSize {
+			return q, fmt.Errorf("limit must be between 1 and %d", maxPageSize)
+		}
+		q.Limit = n
+	}
+	return q, nil
+}
+
+const maxPageSize = 500
+
+// itemStrength is the part of a strength estimate the item listing
+// reports for an item's password.
+type itemStrength struct {
+	Score        int     `json:"score"`
+	GuessesLog10 float64 `json:"guesses_log10"`
+	Warning      string  `json:"warning,omitempty"`
+}
+
+func estimateItem(pw string, userInputs ...string) *itemStrength {
+	est := strength.Estimate(pw, userInputs...)
+	return &itemStrength{Score: est.Score, GuessesLog10: est.GuessesLog10, Warning: est.Warning}
+}
+
+// itemETag is the entity tag of an item at version.
+func itemETag(version int) string {
+	return strconv.Quote(strconv.Itoa(version))
+}
+
+// ifMatch reads the If-Match header of a request that changes an item. ok
+// is false when there is none; "*" matches any version, and a tag that is
+// not one of ours matches none.
+func ifMatch(r *http.Request) (version int, ok bool) {
+	h := strings.TrimSpace(r.Header.Get("If-Match"))
+	if h == "" {
+		return 0, false
+	}
+	if h == "*" {
+		return 0, true
+	}
+	tag, err := strconv.Unquote(strings.TrimPrefix(h, "W/"))
+	if err != nil {
+		return -1, true
+	}
+	n, err := strconv.Atoi(tag)
+	if err != nil || n <= 0 {
+		return -1, true
+	}
+	return n, true
+}
+
+// breachCount returns how often pw appears in the breach corpus, or nil
+// if breach checks are off or the source could not be reached.
+func (s *Server) breachCount(ctx context.Context, pw string) *int {
+	if s.breach == nil {
+		return nil
+	}
+	n, err := s.breach.Count(ctx, pw)
+	if err != nil {
+		s.logger.Printf("breach check: %v", err)
+		return nil
+	}
+	return &n
+}
+
+// itemRequest is the body of POST /api/items and PUT /api/items/{id}: an
+// item plus optional folder, tags and favorite flag.
+type itemRequest struct {
+	vault.Item
+	vault.Organization
+}
+
+func (r itemRequest) organizes() bool {
+	return r.Folder != nil || r.Tags != nil || r.Favorite != nil
+}
+
+const maskedValue = "••••••••"
+
+// maskItem blanks out the secret schema fields and sensitive custom fields
+// of it in place and returns their names, custom fields prefixed with
+// "custom.".
+func maskItem(it *vault.Item) []string {
+	masked := []string{}
+	schema, _ := vault.LookupSchema(it.Type)
+	for k, val := range it.Fields {
+		if val != "" && schema.IsSecret(k) {
+			it.Fields[k] = maskedValue
+			masked = append(masked, k)
+		}
+	}
+	sort.Strings(masked)
+	custom := make([]vault.CustomField, len(it.Custom))
+	for i, f := range it.Custom {
+		if f.Sensitive && f.Value != "" {
+			f.Value = maskedValue
+			masked = append(masked, "custom."+f.Name)
+		}
+		custom[i] = f
+	}
+	it.Custom = custom
+	return masked
+}
+
 func last4Digits(s string) string {
 	d := make([]rune, 0, len(s))
 	for _, r := range s {
@@ -167,12 +385,32 @@ func last4Digits(s string) string {
 	return string(d[len(d)-4:])
 }
 
-func canonType(t string) string {
-	t = strings.ToLower(strings.TrimSpace(t))
-	switch t {
-	case "secure note", "secure-note":
-		return "note"
-	default:
-		return t
+// handleItemTOTP returns the current one-time code for the item's seed.
+// ?field= picks a seed field other than the default. HOTP seeds advance
+// their counter on every code, so they are only served to POST.
+func (s *Server) handleItemTOTP(w http.ResponseWriter, r *http.Request, v vault.Vault, id string) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	code, err := v.OTP(r.Context(), id, r.URL.Query().Get("field"), r.Method == http.MethodPost)
+	if err != nil {
+		status := vaultErrStatus(err, http.StatusBadRequest)
+		if errors.Is(err, vault.ErrOTPAdvance) {
+			w.Header().Set("Allow", http.MethodPost)
+			status = http.StatusMethodNotAllowed
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, code)
+}
+
+func (s *Server) handleSchemas(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
 	}
+	writeJSON(w, vault.Schemas())
 }
@@ -0,0 +1,90 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+
+	"project-crypto/internal/vault"
+)
+
+func TestMaskItem(t *testing.T) {
+	it := vault.Item{
+		Type:   "login",
+		Fields: map[string]string{"site": "example.com", "password": "pw", "notes": ""},
+		Custom: []vault.CustomField{
+			{Name: "recovery", Kind: vault.KindHidden, Value: "abc", Sensitive: true},
+			{Name: "portal", Kind: vault.KindURL, Value: "https://example.com"},
+		},
+	}
+	orig := it.Custom
+	masked := maskItem(&it)
+
+	if want := []string{"password", "custom.recovery"}; !reflect.DeepEqual(masked, want) {
+		t.Fatalf("masked = %v, want %v", masked, want)
+	}
+	if it.Fields["password"] != maskedValue || it.Fields["site"] != "example.com" {
+		t.Fatalf("fields = %v", it.Fields)
+	}
+	if it.Custom[0].Value != maskedValue || it.Custom[1].Value != "https://example.com" {
+		t.Fatalf("custom = %+v", it.Custom)
+	}
+	if orig[0].Value != "abc" {
+		t.Fatal("masking must not modify the caller's custom fields")
+	}
+}
+
+func TestItemQuery(t *testing.T) {
+	params, _ := url.ParseQuery("type=login&tag=a&tag=b&sort=title&order=desc&limit=20&updated_since=100&cursor=xyz")
+	q, err := itemQuery(params)
+	if err != nil {
+		t.Fatalf("itemQuery: %v", err)
+	}
+	want := vault.Query{
+		Type:         "login",
+		Tags:         []string{"a", "b"},
+		Sort:         vault.SortTitle,
+		Desc:         true,
+		Limit:        20,
+		UpdatedSince: 100,
+		Cursor:       "xyz",
+	}
+	if !reflect.DeepEqual(q, want) {
+		t.Fatalf("query = %+v, want %+v", q, want)
+	}
+
+	for _, bad := range []string{"order=up", "limit=0", "limit=100000", "created_before=yesterday"} {
+		params, _ := url.ParseQuery(bad)
+		if _, err := itemQuery(params); err == nil {
+			t.Errorf("%s: expected an error", bad)
+		}
+	}
+}
+
+func TestIfMatch(t *testing.T) {
+	cases := []struct {
+		header  string
+		version int
+		ok      bool
+	}{
+		{"", 0, false},
+		{"*", 0, true},
+		{`"3"`, 3, true},
+		{`W/"3"`, 3, true},
+		{itemETag(12), 12, true},
+		{"3", -1, true},
+		{`"abc"`, -1, true},
+		{`"0"`, -1, true},
+	}
+	for _, c := range cases {
+		r := httptest.NewRequest(http.MethodPut, "/api/items/x", nil)
+		if c.header != "" {
+			r.Header.Set("If-Match", c.header)
+		}
+		if v, ok := ifMatch(r); v != c.version || ok != c.ok {
+			t.Errorf("ifMatch(%q) = %d, %v; want %d, %v", c.header, v, ok, c.version, c.ok)
+		}
+	}
+}
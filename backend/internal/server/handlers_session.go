@@ -7,6 +7,7 @@ import (
 	"os"
 	"path"
 	"strings"
+	"time"
 
 	"project-crypto/internal/auth"
 	cr "project-crypto/internal/crypto"
@@ -24,19 +25,29 @@ func (s *Server) handleSession(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "no auth context", http.StatusUnauthorized)
 		return
 	}
+	// Polling the session must not count as activity, so this only reads
+	// the timers and never touches lastActive.
+	now := time.Now()
+	resp := map[string]any{"user": claims.Sub, "unlocked": false, "vault": ""}
 	s.mu.Lock()
-	sess := s.sessions[claims.Sub]
+	expired := s.dropExpired(now)
+	if sess := s.sessions[claims.Sub]; sess != nil {
+		idle, absolute := sess.remaining(now)
+		resp["unlocked"] = sess.unlocked
+		resp["vault"] = path.Base(sess.vpath)
+		resp["idle_remaining_ms"] = durationMillis(idle)
+		resp["max_remaining_ms"] = durationMillis(absolute)
+	}
 	s.mu.Unlock()
-	writeJSON(w, map[string]any{
-		"user":     claims.Sub,
-		"unlocked": sess != nil && sess.unlocked,
-		"vault": func() string {
-			if sess != nil {
-				return path.Base(sess.vpath)
-			}
-			return ""
-		}(),
-	})
+	lockSessions(expired...)
+	writeJSON(w, resp)
+}
+
+func durationMillis(d time.Duration) int64 {
+	if d < 0 {
+		return -1
+	}
+	return d.Milliseconds()
 }
 
 func (s *Server) handleUnlock(w http.ResponseWriter, r *http.Request) {
@@ -103,9 +114,26 @@ func (s *Server) handleUnlock(w http.ResponseWriter, r *http.Request) {
 	}
 
 	s.mu.Lock()
-	s.sessions[claims.Sub] = &userSession{v: v, vpath: vpath, unlocked: true}
+	s.sessions[claims.Sub] = newSession(v, vpath, time.Now())
 	s.mu.Unlock()
-	writeJSON(w, map[string]any{"ok": true, "vault": path.Base(vpath)})
+	upgraded := s.logUnlock(claims.Sub, v)
+	writeJSON(w, map[string]any{"ok": true, "vault": path.Base(vpath), "kdf_upgraded": upgraded})
+}
+
+func (s *Server) logUnlock(username string, v vault.Vault) bool {
+	rep := v.LastUnlock()
+	if rep.Recovered {
+		s.logger.Printf("[vault] %s header restored from journal", username)
+	}
+	if len(rep.SkippedItems) > 0 {
+		s.logger.Printf("[vault] %s migration skipped unreadable items %v", username, rep.SkippedItems)
+	}
+	if !rep.KDFUpgraded {
+		return false
+	}
+	s.logger.Printf("[vault] %s kdf upgraded m=%d,t=%d,p=%d -> m=%d,t=%d,p=%d", username,
+		rep.OldKDF.M, rep.OldKDF.T, rep.OldKDF.P, rep.NewKDF.M, rep.NewKDF.T, rep.NewKDF.P)
+	return true
 }
 
 func (s *Server) handleLock(w http.ResponseWriter, r *http.Request) {
@@ -119,24 +147,48 @@ func (s *Server) handleLock(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	s.mu.Lock()
-	if sess, ok := s.sessions[claims.Sub]; ok && sess.v != nil {
-		sess.v.Lock()
-	}
+	sess, ok := s.sessions[claims.Sub]
 	delete(s.sessions, claims.Sub)
 	s.mu.Unlock()
+	if ok {
+		lockSessions(sess)
+	}
 	w.WriteHeader(http.StatusNoContent)
 }
 
+func (s *Server) handleRekey(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	v, err := s.withSessionVault(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if err := v.Rekey(r.Context()); err != nil {
+		http.Error(w, "rekey failed: "+err.Error(), vaultErrStatus(err, http.StatusInternalServerError))
+		return
+	}
+	writeJSON(w, map[string]any{"ok": true, "note": "Vault keys rotated; all items re-encrypted."})
+}
+
 func (s *Server) withSessionVault(r *http.Request) (vault.Vault, error) {
 	claims, ok := auth.FromContext(r.Context())
 	if !ok {
 		return nil, errors.New("no auth context")
 	}
+	now := time.Now()
 	s.mu.Lock()
-	defer s.mu.Unlock()
+	expired := s.dropExpired(now)
 	sess := s.sessions[claims.Sub]
 	if sess == nil || !sess.unlocked || sess.v == nil {
+		s.mu.Unlock()
+		lockSessions(expired...)
 		return nil, errors.New("vault not unlocked")
 	}
+	sess.lastActive = now
+	s.mu.Unlock()
+	lockSessions(expired...)
 	return sess.v, nil
 }
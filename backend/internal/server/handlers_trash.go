@@ -0,0 +1,68 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+)
+
+func (s *Server) handleTrash(w http.ResponseWriter, r *http.Request) {
+	v, err := s.withSessionVault(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	rest := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/trash"), "/")
+	if rest == "" {
+		switch r.Method {
+		case http.MethodGet:
+			metas, err := v.ListTrash(r.Context())
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			writeJSON(w, metas)
+
+		case http.MethodDelete:
+			metas, err := v.ListTrash(r.Context())
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			for _, m := range metas {
+				if err := v.Purge(r.Context(), m.ID); err != nil {
+					http.Error(w, err.Error(), vaultErrStatus(err, http.StatusInternalServerError))
+					return
+				}
+			}
+			writeJSON(w, map[string]any{"purged": len(metas)})
+
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+		return
+	}
+
+	id, action, _ := strings.Cut(rest, "/")
+	switch {
+	case action == "restore" && r.Method == http.MethodPost:
+		if err := v.Restore(r.Context(), id); err != nil {
+			http.Error(w, err.Error(), vaultErrStatus(err, http.StatusBadRequest))
+			return
+		}
+		writeJSON(w, map[string]any{"restored": id})
+
+	case action == "" && r.Method == http.MethodDelete:
+		if err := v.Purge(r.Context(), id); err != nil {
+			http.Error(w, err.Error(), vaultErrStatus(err, http.StatusBadRequest))
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	case action == "" || action == "restore":
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+
+	default:
+		http.NotFound(w, r)
+	}
+}
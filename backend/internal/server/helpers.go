@@ -1,17 +1,20 @@
 package server
 
 import (
+	"context"
 	"crypto/rand"
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"net/http"
-	"strconv"
 	"regexp"
+	"strconv"
 	"strings"
 
 	"project-crypto/internal/auth"
+	"project-crypto/internal/strength"
+	"project-crypto/internal/vault"
 )
 
 func writeJSON(w http.ResponseWriter, v any) {
@@ -31,31 +34,62 @@ func tooMany(w http.ResponseWriter, retryAfterSeconds int) {
 	http.Error(w, "too many requests", http.StatusTooManyRequests)
 }
 
-var (
-	reUpper = regexp.MustCompile(`[A-Z]`)
-	reLower = regexp.MustCompile(`[a-z]`)
-	reDigit = regexp.MustCompile(`[0-9]`)
-	reSym   = regexp.MustCompile(`[^A-Za-z0-9]`)
-	reEmail = regexp.MustCompile(`^[^@\s]+@[^@\s]+\.[^@\s]+$`)
-)
+var reEmail = regexp.MustCompile(`^[^@\s]+@[^@\s]+\.[^@\s]+$`)
 
-func validatePassword(pw string) error {
-	switch {
-	case len(pw) < 12:
+// minPasswordScore is the strength.Estimate score account passwords need:
+// at least 10^8 guesses, which at the server's Argon2id cost is years of
+// offline cracking.
+const minPasswordScore = 3
+
+// validatePassword rejects account passwords that are short, easy to
+// guess or in the breach corpus. userInputs are the username, email and
+// similar values the password should not be built from. An unreachable
+// breach source is logged and does not block the password.
+func (s *Server) validatePassword(ctx context.Context, pw string, userInputs ...string) error {
+	if len([]rune(pw)) < 12 {
 		return errors.New("password must be at least 12 characters")
-	case strings.Contains(pw, " "):
-		return errors.New("password must not contain spaces")
-	case !reUpper.MatchString(pw):
-		return errors.New("password must include an uppercase letter")
-	case !reLower.MatchString(pw):
-		return errors.New("password must include a lowercase letter")
-	case !reDigit.MatchString(pw):
-		return errors.New("password must include a digit")
-	case !reSym.MatchString(pw):
-		return errors.New("password must include a special character")
-	default:
+	}
+	est := strength.Estimate(pw, userInputs...)
+	if est.Score >= minPasswordScore {
+		if s.breach == nil {
+			return nil
+		}
+		n, err := s.breach.Count(ctx, pw)
+		if err != nil {
+			s.logger.Printf("breach check: %v", err)
+			return nil
+		}
+		if n > 0 {
+			return errors.New("password has appeared in a data breach; choose another")
+		}
 		return nil
 	}
+	msg := "password is too easy to guess"
+	if est.Warning != "" {
+		msg += ": " + strings.ToLower(est.Warning[:1]) + est.Warning[1:]
+	}
+	if len(est.Suggestions) > 0 {
+		msg += ". " + est.Suggestions[0]
+	}
+	return errors.New(msg)
+}
+
+func vaultErrStatus(err error, def int) int {
+	switch {
+	case errors.Is(err, vault.ErrItemNotFound), errors.Is(err, vault.ErrAttachmentNotFound),
+		errors.Is(err, vault.ErrFolderNotFound), errors.Is(err, vault.ErrNoOTP):
+		return http.StatusNotFound
+	case errors.Is(err, vault.ErrInvalidItem), errors.Is(err, vault.ErrBadCursor):
+		return http.StatusBadRequest
+	case errors.Is(err, vault.ErrAttachmentTooLarge):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, vault.ErrInTrash), errors.Is(err, vault.ErrConflict):
+		return http.StatusConflict
+	case errors.Is(err, vault.ErrIntegrity):
+		return http.StatusInternalServerError
+	default:
+		return def
+	}
 }
 
 func isValidEmail(email string) bool {
@@ -0,0 +1,55 @@
+package server
+
+import (
+	"context"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"project-crypto/internal/breach"
+)
+
+func TestValidatePassword(t *testing.T) {
+	s := &Server{}
+	ctx := context.Background()
+	weak := []struct{ pw, user string }{
+		{"short1!", ""},
+		{"Password1234!", ""},
+		{"qwertyuiop123", ""},
+		{"aaaaaaaaaaaaaaaa", ""},
+		{"Zorblatquinzy1", "zorblatquinzy"},
+	}
+	for _, c := range weak {
+		if err := s.validatePassword(ctx, c.pw, c.user); err == nil {
+			t.Errorf("%q accepted", c.pw)
+		}
+	}
+	for _, pw := range []string{"xK9#mQ2$vL7@nR4p", "vivid walrus harbor tulip"} {
+		if err := s.validatePassword(ctx, pw, "alice"); err != nil {
+			t.Errorf("%q rejected: %v", pw, err)
+		}
+	}
+}
+
+func TestValidatePasswordBreached(t *testing.T) {
+	dir := t.TempDir()
+	p, suffix := breach.Hash("vivid walrus harbor tulip")
+	if err := os.WriteFile(filepath.Join(dir, p+".txt"), []byte(suffix+":12\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	s := &Server{breach: breach.New(breach.DirSource(dir)), logger: log.New(io.Discard, "", 0)}
+	ctx := context.Background()
+	if err := s.validatePassword(ctx, "vivid walrus harbor tulip"); err == nil {
+		t.Fatal("breached password accepted")
+	}
+	if err := s.validatePassword(ctx, "xK9#mQ2$vL7@nR4p"); err != nil {
+		t.Fatalf("clean password rejected: %v", err)
+	}
+
+	s.breach = breach.New(breach.DirSource(filepath.Join(dir, "missing", "\x00")))
+	if err := s.validatePassword(ctx, "xK9#mQ2$vL7@nR4p"); err != nil {
+		t.Fatalf("unreachable source should not block: %v", err)
+	}
+}
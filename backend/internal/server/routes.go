@@ -5,6 +5,7 @@ import "net/http"
 func (s *Server) routes() {
 	s.mux.HandleFunc("/health", s.handleHealth)
 	s.mux.HandleFunc("/api/health", s.handleHealth)
+	s.mux.HandleFunc("/api/health/vault", s.handleVaultHealth)
 
 	s.mux.HandleFunc("/api/login", s.handleLogin)
 	s.mux.HandleFunc("/api/login/verify", s.handleLoginVerify)
@@ -16,8 +17,17 @@ func (s *Server) routes() {
 	s.mux.HandleFunc("/api/unlock", s.handleUnlock)
 	s.mux.HandleFunc("/api/lock", s.handleLock)
 	s.mux.HandleFunc("/api/password", s.handleChangePassword)
+	s.mux.HandleFunc("/api/rekey", s.handleRekey)
 	s.mux.HandleFunc("/api/items", s.handleItems)
 	s.mux.HandleFunc("/api/items/", s.handleItemByID)
+	s.mux.HandleFunc("/api/schemas", s.handleSchemas)
+	s.mux.HandleFunc("/api/generate", s.handleGenerate)
+	s.mux.HandleFunc("/api/folders", s.handleFolders)
+	s.mux.HandleFunc("/api/folders/", s.handleFolders)
+	s.mux.HandleFunc("/api/trash", s.handleTrash)
+	s.mux.HandleFunc("/api/trash/", s.handleTrash)
+	s.mux.HandleFunc("/api/backup", s.handleBackup)
+	s.mux.HandleFunc("/api/import", s.handleImport)
 }
 
 func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
@@ -25,3 +35,24 @@ func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 	_, _ = w.Write([]byte("ok"))
 }
+
+// handleVaultHealth reports weak, reused and stale passwords in the
+// session's vault. Unlike /api/health it needs an unlocked vault.
+func (s *Server) handleVaultHealth(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	v, err := s.withSessionVault(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	report, err := v.Health(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), vaultErrStatus(err, http.StatusBadRequest))
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, report)
+}
@@ -13,6 +13,7 @@ import (
 	"time"
 
 	"project-crypto/internal/auth"
+	"project-crypto/internal/breach"
 	"project-crypto/internal/totp"
 
 	"go.mongodb.org/mongo-driver/mongo"
@@ -34,6 +35,7 @@ type Server struct {
 	challs   map[string]*twoFAChallenge
 
 	storageClient *mongo.Client
+	breach        *breach.Checker
 
 	rlLoginIP       *multiLimiter
 	rlLoginID       *multiLimiter
@@ -81,6 +83,14 @@ func New(ctx context.Context, cfg Config) (*Server, error) {
 	}
 	s.mail = newSMTPMailer(cfg.SMTP, s.logger)
 
+	if cfg.BreachRange != "" {
+		src, err := breach.Open(cfg.BreachRange)
+		if err != nil {
+			return nil, fmt.Errorf("server: breach range: %w", err)
+		}
+		s.breach = breach.New(src)
+	}
+
 	sc, err := mongo.Connect(ctx, options.Client().ApplyURI(cfg.MongoURI))
 	if err != nil {
 		return nil, err
@@ -113,6 +123,7 @@ func New(ctx context.Context, cfg Config) (*Server, error) {
 	}
 
 	s.routes()
+	go s.reapSessions(ctx)
 	return s, nil
 }
 
@@ -160,8 +171,9 @@ func (s *Server) isPublic(path string) bool {
 
 func (s *Server) addDefaultHeaders(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type")
+	w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type, If-Match")
 	w.Header().Set("Access-Control-Allow-Methods", "GET,POST,PUT,DELETE,OPTIONS")
+	w.Header().Set("Access-Control-Expose-Headers", "X-Total-Count, X-Next-Cursor, ETag")
 	if strings.HasPrefix(r.URL.Path, "/api/") {
 		w.Header().Set("Content-Type", "application/json; charset=utf-8")
 	}
@@ -202,48 +214,3 @@ func (s *Server) vaultPath(username string) string {
 	name := sha256Hex(username) + ".vlt"
 	return filepath.Join(s.cfg.VaultDir, name)
 }
-
-func (s *Server) nukeUserVault(ctx context.Context, username string) error {
-	metaColl, blobColl := collectionNames(username)
-	var errs []string
-
-	if err := s.dropCollection(ctx, metaColl); err != nil {
-		errs = append(errs, fmt.Sprintf("meta: %v", err))
-	}
-	if err := s.dropCollection(ctx, blobColl); err != nil {
-		errs = append(errs, fmt.Sprintf("blobs: %v", err))
-	}
-	vpath := s.vaultPath(username)
-	if err := os.Remove(vpath); err != nil && !errors.Is(err, os.ErrNotExist) {
-		errs = append(errs, fmt.Sprintf("vault file: %v", err))
-	}
-	if len(errs) > 0 {
-		return errors.New(strings.Join(errs, "; "))
-	}
-	return nil
-}
-
-func (s *Server) dropCollection(ctx context.Context, collName string) error {
-	dropCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
-	defer cancel()
-
-	cli, err := mongo.Connect(dropCtx, options.Client().ApplyURI(s.cfg.MongoURI))
-	if err != nil {
-		return err
-	}
-	defer cli.Disconnect(dropCtx)
-
-	err = cli.Database(s.cfg.MongoDB).Collection(collName).Drop(dropCtx)
-	if isNamespaceNotFound(err) {
-		return nil
-	}
-	return err
-}
-
-func isNamespaceNotFound(err error) bool {
-	if err == nil {
-		return false
-	}
-	var cmdErr mongo.CommandError
-	return errors.As(err, &cmdErr) && cmdErr.Code == 26
-}
@@ -0,0 +1,84 @@
+package server
+
+import (
+	"context"
+	"time"
+
+	"project-crypto/internal/vault"
+)
+
+const sessionReapInterval = 15 * time.Second
+
+func newSession(v vault.Vault, vpath string, now time.Time) *userSession {
+	sess := &userSession{v: v, vpath: vpath, unlocked: true, unlockedAt: now, lastActive: now}
+	p := v.Policy()
+	if p.LockTimeout > 0 {
+		sess.idleTimeout = time.Duration(p.LockTimeout) * time.Millisecond
+	}
+	if p.MaxUnlocked > 0 {
+		sess.maxUnlocked = time.Duration(p.MaxUnlocked) * time.Millisecond
+	}
+	return sess
+}
+
+// remaining reports how long the session stays unlocked before the idle
+// timeout and the absolute limit kick in. A zero timeout means the limit
+// is disabled and is reported as -1.
+func (sess *userSession) remaining(now time.Time) (idle, absolute time.Duration) {
+	idle, absolute = -1, -1
+	if sess.idleTimeout > 0 {
+		idle = max(sess.lastActive.Add(sess.idleTimeout).Sub(now), 0)
+	}
+	if sess.maxUnlocked > 0 {
+		absolute = max(sess.unlockedAt.Add(sess.maxUnlocked).Sub(now), 0)
+	}
+	return idle, absolute
+}
+
+func (sess *userSession) expired(now time.Time) bool {
+	idle, absolute := sess.remaining(now)
+	return idle == 0 || absolute == 0
+}
+
+// dropExpired drops every session past its idle or absolute limit and
+// returns them. Callers must hold s.mu, and lock the returned sessions
+// with lockSessions once they have released it: Lock waits for vault calls
+// in flight, which must not hold up every other request.
+func (s *Server) dropExpired(now time.Time) []*userSession {
+	var expired []*userSession
+	for user, sess := range s.sessions {
+		if !sess.expired(now) {
+			continue
+		}
+		delete(s.sessions, user)
+		expired = append(expired, sess)
+		s.logger.Printf("[vault] %s auto-locked", user)
+	}
+	return expired
+}
+
+// lockSessions locks the vaults of sessions already dropped from
+// s.sessions. Callers must not hold s.mu.
+func lockSessions(sessions ...*userSession) {
+	for _, sess := range sessions {
+		if sess.v != nil {
+			sess.v.Lock()
+		}
+	}
+}
+
+func (s *Server) reapSessions(ctx context.Context) {
+	t := time.NewTicker(sessionReapInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-t.C:
+			s.mu.Lock()
+			expired := s.dropExpired(now)
+			s.mu.Unlock()
+			lockSessions(expired...)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package server
+
+import (
+	"io"
+	"log"
+	"testing"
+	"time"
+)
+
+func TestSessionRemaining(t *testing.T) {
+	start := time.Unix(1_700_000_000, 0)
+	sess := &userSession{unlocked: true, unlockedAt: start, lastActive: start,
+		idleTimeout: 5 * time.Minute, maxUnlocked: time.Hour}
+
+	idle, absolute := sess.remaining(start.Add(2 * time.Minute))
+	if idle != 3*time.Minute || absolute != 58*time.Minute {
+		t.Fatalf("remaining = %v, %v", idle, absolute)
+	}
+	if sess.expired(start.Add(4 * time.Minute)) {
+		t.Fatal("session should still be unlocked")
+	}
+	if !sess.expired(start.Add(5 * time.Minute)) {
+		t.Fatal("session should be idle-expired")
+	}
+
+	sess.lastActive = start.Add(59 * time.Minute)
+	if !sess.expired(start.Add(time.Hour)) {
+		t.Fatal("session should hit the absolute limit despite activity")
+	}
+
+	sess.idleTimeout, sess.maxUnlocked = 0, 0
+	if idle, absolute := sess.remaining(start.Add(24 * time.Hour)); idle != -1 || absolute != -1 {
+		t.Fatalf("disabled limits = %v, %v", idle, absolute)
+	}
+}
+
+func TestLockExpiredDropsSessions(t *testing.T) {
+	start := time.Unix(1_700_000_000, 0)
+	s := &Server{logger: log.New(io.Discard, "", 0), sessions: map[string]*userSession{
+		"idle":   {unlocked: true, unlockedAt: start, lastActive: start, idleTimeout: time.Minute},
+		"active": {unlocked: true, unlockedAt: start, lastActive: start.Add(90 * time.Second), idleTimeout: time.Minute},
+	}}
+	if expired := s.dropExpired(start.Add(2 * time.Minute)); len(expired) != 1 {
+		t.Fatalf("expected one expired session, got %d", len(expired))
+	}
+	if _, ok := s.sessions["idle"]; ok {
+		t.Fatal("idle session should have been locked")
+	}
+	if _, ok := s.sessions["active"]; !ok {
+		t.Fatal("active session should be kept")
+	}
+}
@@ -11,6 +11,11 @@ type userSession struct {
 	v        vault.Vault
 	vpath    string
 	unlocked bool
+
+	unlockedAt  time.Time
+	lastActive  time.Time
+	idleTimeout time.Duration
+	maxUnlocked time.Duration
 }
 
 type resetToken struct {
@@ -102,11 +102,33 @@ type ItemMeta struct {
 	Created int64  `bson:"created" json:"created"`
 	Updated int64  `bson:"updated" json:"updated"`
 	Version int    `bson:"version" json:"version"`
+	Deleted int64  `bson:"deleted" json:"deleted,omitempty"`
+}
+
+// MetaQuery selects and orders metadata documents. Trashed documents are
+// never returned.
+type MetaQuery struct {
+	Types         []string // any of; empty for all types
+	UpdatedSince  int64    // inclusive, unix seconds; 0 for no bound
+	CreatedBefore int64    // exclusive, unix seconds; 0 for no bound
+
+	// Sort is "updated" or "created"; empty leaves the order undefined.
+	// Ties are broken by id in the same direction.
+	Sort string
+	Desc bool
+
+	// AfterValue and AfterID continue a sorted listing after the document
+	// with that sort value and id.
+	AfterValue int64
+	AfterID    string
+
+	Limit int64 // 0 for no limit
 }
 
 type MetaStore interface {
 	PutMeta(ctx context.Context, meta ItemMeta) error
-	ListMeta(ctx context.Context, filter map[string]interface{}) ([]ItemMeta, error)
+	ListMeta(ctx context.Context, q MetaQuery) ([]ItemMeta, error)
+	DeleteMeta(ctx context.Context, id string) error
 }
 
 type MongoMetaStore struct {
@@ -132,9 +154,14 @@ func NewMongoMetaStore(ctx context.Context, uri, dbName, collName string) (*Mong
 
 	coll := cli.Database(dbName).Collection(collName)
 
-	_, _ = coll.Indexes().CreateOne(ctx, mongo.IndexModel{
-		Keys:    bson.D{{Key: "id", Value: 1}},
-		Options: options.Index().SetUnique(true),
+	_, _ = coll.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "id", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{Keys: bson.D{{Key: "updated", Value: 1}, {Key: "id", Value: 1}}},
+		{Keys: bson.D{{Key: "created", Value: 1}, {Key: "id", Value: 1}}},
+		{Keys: bson.D{{Key: "type", Value: 1}, {Key: "updated", Value: 1}, {Key: "id", Value: 1}}},
 	})
 
 	return &MongoMetaStore{client: cli, coll: coll}, nil
@@ -162,6 +189,7 @@ func (m *MongoMetaStore) PutMeta(ctx context.Context, meta ItemMeta) error {
 				"created": meta.Created,
 				"updated": meta.Updated,
 				"version": meta.Version,
+				"deleted": meta.Deleted,
 			},
 			"$setOnInsert": bson.M{
 				"createdAt": time.Now(),
@@ -172,8 +200,45 @@ func (m *MongoMetaStore) PutMeta(ctx context.Context, meta ItemMeta) error {
 	return err
 }
 
-func (m *MongoMetaStore) ListMeta(ctx context.Context, filter map[string]interface{}) ([]ItemMeta, error) {
-	cur, err := m.coll.Find(ctx, filter)
+func (m *MongoMetaStore) DeleteMeta(ctx context.Context, id string) error {
+	if id == "" {
+		return errors.New("empty meta.id")
+	}
+	_, err := m.coll.DeleteOne(ctx, bson.M{"id": id})
+	return err
+}
+
+func (m *MongoMetaStore) ListMeta(ctx context.Context, q MetaQuery) ([]ItemMeta, error) {
+	filter := bson.M{"deleted": bson.M{"$in": bson.A{0, nil}}}
+	if len(q.Types) > 0 {
+		filter["type"] = bson.M{"$in": q.Types}
+	}
+	if q.UpdatedSince != 0 {
+		filter["updated"] = bson.M{"$gte": q.UpdatedSince}
+	}
+	if q.CreatedBefore != 0 {
+		filter["created"] = bson.M{"$lt": q.CreatedBefore}
+	}
+
+	opts := options.Find()
+	if q.Sort != "" {
+		dir, cmp := 1, "$gt"
+		if q.Desc {
+			dir, cmp = -1, "$lt"
+		}
+		opts.SetSort(bson.D{{Key: q.Sort, Value: dir}, {Key: "id", Value: dir}})
+		if q.AfterID != "" {
+			filter["$or"] = bson.A{
+				bson.M{q.Sort: bson.M{cmp: q.AfterValue}},
+				bson.M{q.Sort: q.AfterValue, "id": bson.M{cmp: q.AfterID}},
+			}
+		}
+	}
+	if q.Limit > 0 {
+		opts.SetLimit(q.Limit)
+	}
+
+	cur, err := m.coll.Find(ctx, filter, opts)
 	if err != nil {
 		return nil, err
 	}
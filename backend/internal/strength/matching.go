@@ -0,0 +1,432 @@
+package strength
+
+import (
+	_ "embed"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"project-crypto/internal/wordlist"
+)
+
+// Match is a part of a password that an attacker would guess as a unit.
+// I and J are inclusive rune offsets.
+type Match struct {
+	Pattern string  `json:"pattern"`
+	I       int     `json:"i"`
+	J       int     `json:"j"`
+	Guesses float64 `json:"guesses"`
+
+	token string
+
+	// dictionary
+	dict     string
+	rank     int
+	reversed bool
+	l33t     map[rune]rune // substituted character -> letter
+
+	// spatial
+	turns   int
+	shifted int
+
+	// repeat
+	base   string
+	repeat int
+
+	// sequence
+	ascending bool
+
+	// date and year
+	year      int
+	separator bool
+}
+
+const (
+	dictPasswords  = "passwords"
+	dictEnglish    = "english"
+	dictUserInputs = "user_inputs"
+)
+
+var (
+	//go:embed passwords.txt
+	passwordsData string
+
+	dictionaries = map[string]map[string]int{
+		dictPasswords: rankedList(strings.Fields(passwordsData)),
+		dictEnglish:   rankedList(wordlist.English),
+	}
+)
+
+func rankedList(list []string) map[string]int {
+	out := map[string]int{}
+	for i, w := range list {
+		if _, ok := out[w]; !ok {
+			out[w] = i + 1
+		}
+	}
+	return out
+}
+
+// omnimatch runs every matcher over pw.
+func omnimatch(pw []rune, userInputs map[string]int) []Match {
+	dicts := dictionaries
+	if len(userInputs) > 0 {
+		dicts = map[string]map[string]int{dictUserInputs: userInputs}
+		for name, d := range dictionaries {
+			dicts[name] = d
+		}
+	}
+	var out []Match
+	out = append(out, dictionaryMatches(pw, dicts)...)
+	out = append(out, reverseDictionaryMatches(pw, dicts)...)
+	out = append(out, l33tMatches(pw, dicts)...)
+	out = append(out, spatialMatches(pw)...)
+	out = append(out, repeatMatches(pw)...)
+	out = append(out, sequenceMatches(pw)...)
+	out = append(out, dateMatches(pw)...)
+	out = append(out, yearMatches(pw)...)
+	return out
+}
+
+func dictionaryMatches(pw []rune, dicts map[string]map[string]int) []Match {
+	lower := []rune(strings.ToLower(string(pw)))
+	if len(lower) != len(pw) {
+		return nil
+	}
+	var out []Match
+	for i := range lower {
+		for j := i; j < len(lower); j++ {
+			word := string(lower[i : j+1])
+			for name, d := range dicts {
+				if rank, ok := d[word]; ok {
+					out = append(out, Match{Pattern: "dictionary", I: i, J: j, token: string(pw[i : j+1]), dict: name, rank: rank})
+				}
+			}
+		}
+	}
+	return out
+}
+
+func reverseDictionaryMatches(pw []rune, dicts map[string]map[string]int) []Match {
+	n := len(pw)
+	rev := make([]rune, n)
+	for i, r := range pw {
+		rev[n-1-i] = r
+	}
+	var out []Match
+	for _, m := range dictionaryMatches(rev, dicts) {
+		if m.J-m.I < 2 {
+			continue
+		}
+		m.I, m.J = n-1-m.J, n-1-m.I
+		m.token = string(pw[m.I : m.J+1])
+		m.reversed = true
+		out = append(out, m)
+	}
+	return out
+}
+
+// l33tTable lists the usual substitutions. '1' and '|' are tried as both
+// "i" and "l".
+var l33tTable = map[rune][]rune{
+	'4': {'a'}, '@': {'a'},
+	'8': {'b'},
+	'(': {'c'}, '{': {'c'}, '[': {'c'}, '<': {'c'},
+	'3': {'e'},
+	'6': {'g'}, '9': {'g'},
+	'1': {'i', 'l'}, '!': {'i'}, '|': {'i', 'l'},
+	'0': {'o'},
+	'$': {'s'}, '5': {'s'},
+	'7': {'t'}, '+': {'t'},
+	'%': {'x'},
+	'2': {'z'},
+}
+
+func l33tMatches(pw []rune, dicts map[string]map[string]int) []Match {
+	var out []Match
+	for variant := 0; variant < 2; variant++ {
+		sub := make([]rune, len(pw))
+		subbed := make([]bool, len(pw))
+		any := false
+		for i, r := range pw {
+			sub[i] = r
+			if letters, ok := l33tTable[r]; ok {
+				sub[i] = letters[variant%len(letters)]
+				subbed[i] = true
+				any = true
+			}
+		}
+		if !any {
+			return out
+		}
+		for _, m := range dictionaryMatches(sub, dicts) {
+			table := map[rune]rune{}
+			for k := m.I; k <= m.J; k++ {
+				if subbed[k] {
+					table[pw[k]] = sub[k]
+				}
+			}
+			// A lone substituted character is not worth reporting.
+			if len(table) == 0 || m.J == m.I {
+				continue
+			}
+			m.token = string(pw[m.I : m.J+1])
+			m.l33t = table
+			out = append(out, m)
+		}
+	}
+	return out
+}
+
+// qwerty is the US layout, unshifted then shifted. Each row is offset
+// half a key to the right of the row above.
+var qwerty = [][2]string{
+	{"`1234567890-=", "~!@#$%^&*()_+"},
+	{"qwertyuiop[]\\", "QWERTYUIOP{}|"},
+	{"asdfghjkl;'", "ASDFGHJKL:\""},
+	{"zxcvbnm,./", "ZXCVBNM<>?"},
+}
+
+type keyPos struct{ row, col int }
+
+var keyboard = func() map[rune]keyPos {
+	out := map[rune]keyPos{}
+	for r, row := range qwerty {
+		for c, k := range row[0] {
+			out[k] = keyPos{r, c}
+		}
+		for c, k := range row[1] {
+			out[k] = keyPos{r, c}
+		}
+	}
+	return out
+}()
+
+const (
+	keyboardStarts = 94  // keys, shifted and unshifted
+	keyboardDegree = 4.6 // average neighbours per key
+)
+
+func isShifted(r rune) bool {
+	for _, row := range qwerty {
+		if strings.ContainsRune(row[1], r) {
+			return true
+		}
+	}
+	return false
+}
+
+// keyDirection returns which neighbour of a b is, or -1 if it is not one.
+func keyDirection(a, b rune) int {
+	pa, ok1 := keyboard[a]
+	pb, ok2 := keyboard[b]
+	if !ok1 || !ok2 {
+		return -1
+	}
+	dr, dc := pb.row-pa.row, pb.col-pa.col
+	switch {
+	case dr == 0 && dc == -1:
+		return 0
+	case dr == 0 && dc == 1:
+		return 1
+	case dr == -1 && dc == 0:
+		return 2
+	case dr == -1 && dc == 1:
+		return 3
+	case dr == 1 && dc == -1:
+		return 4
+	case dr == 1 && dc == 0:
+		return 5
+	}
+	return -1
+}
+
+func spatialMatches(pw []rune) []Match {
+	var out []Match
+	for i := 0; i < len(pw)-2; {
+		j, turns, last := i, 0, -1
+		for j+1 < len(pw) {
+			dir := keyDirection(pw[j], pw[j+1])
+			if dir < 0 {
+				break
+			}
+			if dir != last {
+				turns++
+				last = dir
+			}
+			j++
+		}
+		if j-i >= 2 {
+			shifted := 0
+			for _, r := range pw[i : j+1] {
+				if isShifted(r) {
+					shifted++
+				}
+			}
+			out = append(out, Match{Pattern: "spatial", I: i, J: j, token: string(pw[i : j+1]), turns: turns, shifted: shifted})
+			i = j + 1
+			continue
+		}
+		i++
+	}
+	return out
+}
+
+func repeatMatches(pw []rune) []Match {
+	var out []Match
+	for i := 0; i < len(pw); {
+		bestLen, bestBase, bestCount := 0, 0, 0
+		for b := 1; i+2*b <= len(pw); b++ {
+			count := 1
+			for i+(count+1)*b <= len(pw) && string(pw[i+count*b:i+(count+1)*b]) == string(pw[i:i+b]) {
+				count++
+			}
+			if count >= 2 && count*b > bestLen {
+				bestLen, bestBase, bestCount = count*b, b, count
+			}
+		}
+		if bestLen >= 3 {
+			out = append(out, Match{
+				Pattern: "repeat", I: i, J: i + bestLen - 1,
+				token: string(pw[i : i+bestLen]), base: string(pw[i : i+bestBase]), repeat: bestCount,
+			})
+			i += bestLen
+			continue
+		}
+		i++
+	}
+	return out
+}
+
+func charClass(r rune) int {
+	switch {
+	case r >= 'a' && r <= 'z':
+		return 1
+	case r >= 'A' && r <= 'Z':
+		return 2
+	case r >= '0' && r <= '9':
+		return 3
+	}
+	return 0
+}
+
+func sequenceMatches(pw []rune) []Match {
+	var out []Match
+	for i := 0; i < len(pw)-2; {
+		delta := int(pw[i+1]) - int(pw[i])
+		class := charClass(pw[i])
+		if class == 0 || charClass(pw[i+1]) != class || delta == 0 || delta > 5 || delta < -5 {
+			i++
+			continue
+		}
+		j := i + 1
+		for j+1 < len(pw) && charClass(pw[j+1]) == class && int(pw[j+1])-int(pw[j]) == delta {
+			j++
+		}
+		if j-i >= 2 {
+			out = append(out, Match{Pattern: "sequence", I: i, J: j, token: string(pw[i : j+1]), ascending: delta > 0})
+			i = j + 1
+			continue
+		}
+		i++
+	}
+	return out
+}
+
+// referenceYear is the year dates and years are measured from.
+var referenceYear = 2026
+
+func yearMatches(pw []rune) []Match {
+	var out []Match
+	for i := 0; i+4 <= len(pw); i++ {
+		tok := string(pw[i : i+4])
+		if !(strings.HasPrefix(tok, "19") || strings.HasPrefix(tok, "20")) {
+			continue
+		}
+		y, err := strconv.Atoi(tok)
+		if err != nil {
+			continue
+		}
+		out = append(out, Match{Pattern: "year", I: i, J: i + 3, token: tok, year: y})
+	}
+	return out
+}
+
+// dateMatches finds digit runs of 4 to 8 characters, or runs split by one
+// kind of separator, that read as a day, month and year in some order.
+func dateMatches(pw []rune) []Match {
+	var out []Match
+	for i := range pw {
+		for j := i + 3; j < len(pw) && j-i < 10; j++ {
+			tok := string(pw[i : j+1])
+			if y, sep, ok := parseDate(tok); ok {
+				out = append(out, Match{Pattern: "date", I: i, J: j, token: tok, year: y, separator: sep})
+			}
+		}
+	}
+	return out
+}
+
+func parseDate(tok string) (year int, sep bool, ok bool) {
+	var parts []string
+	if strings.IndexFunc(tok, func(r rune) bool { return !unicode.IsDigit(r) }) < 0 {
+		if len(tok) > 8 {
+			return 0, false, false
+		}
+		// Try every way of splitting the digits into three parts.
+		for a := 1; a <= 4 && a < len(tok); a++ {
+			for b := a + 1; b <= a+4 && b < len(tok); b++ {
+				if y, ok := dateParts(tok[:a], tok[a:b], tok[b:]); ok {
+					return y, false, true
+				}
+			}
+		}
+		return 0, false, false
+	}
+	for _, s := range []string{"/", "-", ".", "_", " ", "\\"} {
+		if strings.Count(tok, s) == 2 {
+			parts = strings.Split(tok, s)
+			break
+		}
+	}
+	if len(parts) != 3 {
+		return 0, false, false
+	}
+	for _, p := range parts {
+		if p == "" || strings.IndexFunc(p, func(r rune) bool { return !unicode.IsDigit(r) }) >= 0 {
+			return 0, false, false
+		}
+	}
+	y, ok := dateParts(parts[0], parts[1], parts[2])
+	return y, true, ok
+}
+
+// dateParts accepts d-m-y, m-d-y and y-m-d orders with two or four digit
+// years between 1900 and 2050.
+func dateParts(a, b, c string) (int, bool) {
+	valid := func(d, m, y string) (int, bool) {
+		if len(d) > 2 || len(m) > 2 || (len(y) != 2 && len(y) != 4) {
+			return 0, false
+		}
+		dn, _ := strconv.Atoi(d)
+		mn, _ := strconv.Atoi(m)
+		yn, _ := strconv.Atoi(y)
+		if len(y) == 2 {
+			if yn > 50 {
+				yn += 1900
+			} else {
+				yn += 2000
+			}
+		}
+		if dn < 1 || dn > 31 || mn < 1 || mn > 12 || yn < 1900 || yn > 2050 {
+			return 0, false
+		}
+		return yn, true
+	}
+	for _, order := range [][3]string{{a, b, c}, {b, a, c}, {c, b, a}} {
+		if y, ok := valid(order[0], order[1], order[2]); ok {
+			return y, true
+		}
+	}
+	return 0, false
+}
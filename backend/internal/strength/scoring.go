@@ -0,0 +1,249 @@
+package strength
+
+import (
+	"math"
+	"unicode"
+)
+
+const (
+	bruteforceCardinality   = 10
+	minGuessesSingleChar    = 10
+	minGuessesMultiChar     = 50
+	minGuessesBeforeGrowing = 10000
+	minYearSpace            = 20
+)
+
+// estimateGuesses fills in m.Guesses.
+func estimateGuesses(m *Match, pw []rune) float64 {
+	if m.Guesses != 0 {
+		return m.Guesses
+	}
+	var g float64
+	switch m.Pattern {
+	case "dictionary":
+		g = float64(m.rank) * uppercaseVariations(m.token) * l33tVariations(m)
+		if m.reversed {
+			g *= 2
+		}
+	case "spatial":
+		g = spatialGuesses(m)
+	case "repeat":
+		g = Estimate(m.base).Guesses * float64(m.repeat)
+	case "sequence":
+		g = sequenceGuesses(m)
+	case "year":
+		g = yearSpace(m.year)
+	case "date":
+		g = 365 * yearSpace(m.year)
+		if m.separator {
+			g *= 4
+		}
+	default:
+		g = bruteforceGuesses(m.J - m.I + 1)
+	}
+	min := float64(minGuessesMultiChar)
+	if m.J == m.I {
+		min = minGuessesSingleChar
+	}
+	if m.Pattern != "bruteforce" && g < min {
+		g = min
+	}
+	m.Guesses = g
+	return g
+}
+
+func bruteforceGuesses(n int) float64 {
+	g := math.Pow(bruteforceCardinality, float64(n))
+	min := float64(minGuessesMultiChar + 1)
+	if n == 1 {
+		min = minGuessesSingleChar + 1
+	}
+	return math.Max(g, min)
+}
+
+func yearSpace(year int) float64 {
+	return math.Max(math.Abs(float64(year-referenceYear)), minYearSpace)
+}
+
+func uppercaseVariations(token string) float64 {
+	var upper, lower int
+	for _, r := range token {
+		switch {
+		case unicode.IsUpper(r):
+			upper++
+		case unicode.IsLower(r):
+			lower++
+		}
+	}
+	if upper == 0 {
+		return 1
+	}
+	runes := []rune(token)
+	first, last := unicode.IsUpper(runes[0]), unicode.IsUpper(runes[len(runes)-1])
+	if lower == 0 || (upper == 1 && (first || last)) {
+		return 2
+	}
+	var v float64
+	for i := 1; i <= upper && i <= lower; i++ {
+		v += binomial(upper+lower, i)
+	}
+	return v
+}
+
+func l33tVariations(m *Match) float64 {
+	if len(m.l33t) == 0 {
+		return 1
+	}
+	v := 1.0
+	for subbed, letter := range m.l33t {
+		var s, u int
+		for _, r := range m.token {
+			switch unicode.ToLower(r) {
+			case subbed:
+				s++
+			case letter:
+				u++
+			}
+		}
+		if s == 0 || u == 0 {
+			v *= 2
+			continue
+		}
+		var p float64
+		for i := 1; i <= s && i <= u; i++ {
+			p += binomial(s+u, i)
+		}
+		v *= p
+	}
+	return v
+}
+
+func spatialGuesses(m *Match) float64 {
+	n := m.J - m.I + 1
+	var g float64
+	for i := 2; i <= n; i++ {
+		for j := 1; j <= m.turns && j <= i-1; j++ {
+			g += binomial(i-1, j-1) * keyboardStarts * math.Pow(keyboardDegree, float64(j))
+		}
+	}
+	if m.shifted > 0 {
+		unshifted := n - m.shifted
+		if unshifted == 0 {
+			g *= 2
+		} else {
+			var v float64
+			for i := 1; i <= m.shifted && i <= unshifted; i++ {
+				v += binomial(m.shifted+unshifted, i)
+			}
+			g *= v
+		}
+	}
+	return g
+}
+
+func sequenceGuesses(m *Match) float64 {
+	first := []rune(m.token)[0]
+	var base float64
+	switch {
+	case first == 'a' || first == 'A' || first == 'z' || first == 'Z' || first == '0' || first == '1' || first == '9':
+		base = 4
+	case unicode.IsDigit(first):
+		base = 10
+	default:
+		base = 26
+	}
+	if !m.ascending {
+		base *= 2
+	}
+	return base * float64(m.J-m.I+1)
+}
+
+func binomial(n, k int) float64 {
+	if k > n {
+		return 0
+	}
+	r := 1.0
+	for d := 1; d <= k; d++ {
+		r = r * float64(n-k+d) / float64(d)
+	}
+	return r
+}
+
+// mostGuessable picks the sequence of non-overlapping matches, with
+// bruteforce filling the gaps, that minimises
+//
+//	l! * product(guesses) + minGuessesBeforeGrowing^(l-1)
+//
+// over sequences of length l, as zxcvbn does.
+func mostGuessable(pw []rune, matches []Match) (float64, []Match) {
+	n := len(pw)
+	if n == 0 {
+		return 1, nil
+	}
+	byEnd := make([][]int, n)
+	for i := range matches {
+		estimateGuesses(&matches[i], pw)
+		byEnd[matches[i].J] = append(byEnd[matches[i].J], i)
+	}
+
+	// best[k][j] is the smallest product covering pw[:j] with k matches;
+	// from[k][j] is the match that ends the prefix, with -1 - start for a
+	// bruteforce run starting at start.
+	best := make([][]float64, n+1)
+	from := make([][]int, n+1)
+	for k := range best {
+		best[k] = make([]float64, n+1)
+		from[k] = make([]int, n+1)
+		for j := range best[k] {
+			best[k][j] = math.Inf(1)
+		}
+	}
+	best[0][0] = 1
+	for j := 1; j <= n; j++ {
+		for k := 1; k <= j; k++ {
+			for _, mi := range byEnd[j-1] {
+				m := matches[mi]
+				if g := best[k-1][m.I] * m.Guesses; g < best[k][j] {
+					best[k][j], from[k][j] = g, mi
+				}
+			}
+			for start := 0; start < j; start++ {
+				if g := best[k-1][start] * bruteforceGuesses(j-start); g < best[k][j] {
+					best[k][j], from[k][j] = g, -1-start
+				}
+			}
+		}
+	}
+
+	total, bestK := math.Inf(1), 1
+	for k := 1; k <= n; k++ {
+		if math.IsInf(best[k][n], 1) {
+			continue
+		}
+		g := factorial(k)*best[k][n] + math.Pow(minGuessesBeforeGrowing, float64(k-1))
+		if g < total {
+			total, bestK = g, k
+		}
+	}
+
+	seq := make([]Match, bestK)
+	for k, j := bestK, n; k > 0; k-- {
+		if f := from[k][j]; f >= 0 {
+			seq[k-1] = matches[f]
+			j = matches[f].I
+		} else {
+			start := -1 - f
+			seq[k-1] = Match{Pattern: "bruteforce", I: start, J: j - 1, token: string(pw[start:j]), Guesses: bruteforceGuesses(j - start)}
+			j = start
+		}
+	}
+	return total, seq
+}
+
+func factorial(n int) float64 {
+	f := 1.0
+	for i := 2; i <= n; i++ {
+		f *= float64(i)
+	}
+	return f
+}
@@ -0,0 +1,191 @@
+// Package strength estimates how many guesses an attacker needs to find a
+// password, in the style of zxcvbn.
+//
+// The password is broken into the cheapest sequence of recognisable
+// patterns: common passwords and words (also reversed or with l33t
+// substitutions), keyboard walks, repeats, sequences, dates and years,
+// with bruteforce filling anything left over. The guess counts of the
+// parts multiply, so a password is only as strong as the way it was built.
+package strength
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// maxLength bounds the work done per estimate. Anything longer is scored
+// on its first maxLength characters, which only underestimates.
+const maxLength = 100
+
+// Result is the estimate for one password.
+type Result struct {
+	Guesses      float64  `json:"guesses"`
+	GuessesLog10 float64  `json:"guesses_log10"`
+	Score        int      `json:"score"` // 0 (trivial) to 4 (very strong)
+	CrackTime    string   `json:"crack_time"`
+	Warning      string   `json:"warning,omitempty"`
+	Suggestions  []string `json:"suggestions,omitempty"`
+	Sequence     []Match  `json:"-"`
+}
+
+// Estimate scores pw. userInputs, such as the username and email, are
+// treated as the most likely dictionary words of all.
+func Estimate(pw string, userInputs ...string) Result {
+	runes := []rune(pw)
+	if len(runes) > maxLength {
+		runes = runes[:maxLength]
+	}
+	inputs := map[string]int{}
+	for _, in := range userInputs {
+		for _, w := range strings.FieldsFunc(strings.ToLower(in), func(r rune) bool {
+			return r == '@' || r == '.' || r == ' ' || r == '_' || r == '-'
+		}) {
+			if len([]rune(w)) >= 3 {
+				if _, ok := inputs[w]; !ok {
+					inputs[w] = len(inputs) + 1
+				}
+			}
+		}
+		if in = strings.ToLower(strings.TrimSpace(in)); in != "" {
+			if _, ok := inputs[in]; !ok {
+				inputs[in] = len(inputs) + 1
+			}
+		}
+	}
+
+	guesses, seq := mostGuessable(runes, omnimatch(runes, inputs))
+	r := Result{
+		Guesses:      guesses,
+		GuessesLog10: math.Round(math.Log10(guesses)*100) / 100,
+		Score:        score(guesses),
+		CrackTime:    crackTime(guesses / offlineSlowHashRate),
+		Sequence:     seq,
+	}
+	r.Warning, r.Suggestions = feedback(r.Score, seq)
+	return r
+}
+
+func score(guesses float64) int {
+	const delta = 5
+	switch {
+	case guesses < 1e3+delta:
+		return 0
+	case guesses < 1e6+delta:
+		return 1
+	case guesses < 1e8+delta:
+		return 2
+	case guesses < 1e10+delta:
+		return 3
+	default:
+		return 4
+	}
+}
+
+// offlineSlowHashRate is guesses per second against a slow password hash
+// such as the Argon2id the vault uses, on one attacker's hardware.
+const offlineSlowHashRate = 1e4
+
+func crackTime(seconds float64) string {
+	const (
+		minute = 60
+		hour   = 60 * minute
+		day    = 24 * hour
+		month  = 31 * day
+		year   = 12 * month
+	)
+	unit := func(n float64, name string) string {
+		v := math.Round(n)
+		if v == 1 {
+			return "1 " + name
+		}
+		return fmt.Sprintf("%.0f %ss", v, name)
+	}
+	switch {
+	case seconds < 1:
+		return "less than a second"
+	case seconds < minute:
+		return unit(seconds, "second")
+	case seconds < hour:
+		return unit(seconds/minute, "minute")
+	case seconds < day:
+		return unit(seconds/hour, "hour")
+	case seconds < month:
+		return unit(seconds/day, "day")
+	case seconds < year:
+		return unit(seconds/month, "month")
+	case seconds < 100*year:
+		return unit(seconds/year, "year")
+	default:
+		return "centuries"
+	}
+}
+
+func feedback(score int, seq []Match) (string, []string) {
+	if len(seq) == 0 {
+		return "", []string{"Use a few words, avoid common phrases", "No need for symbols, digits, or uppercase letters"}
+	}
+	if score > 2 {
+		return "", nil
+	}
+	longest := seq[0]
+	for _, m := range seq[1:] {
+		if m.J-m.I > longest.J-longest.I {
+			longest = m
+		}
+	}
+	warning, suggestions := matchFeedback(longest, len(seq) == 1)
+	return warning, append([]string{"Add another word or two. Uncommon words are better."}, suggestions...)
+}
+
+func matchFeedback(m Match, only bool) (string, []string) {
+	switch m.Pattern {
+	case "dictionary":
+		var warning string
+		switch {
+		case m.dict == dictUserInputs:
+			warning = "Passwords based on your name or email are easy to guess"
+		case m.dict == dictPasswords && only && !m.reversed && len(m.l33t) == 0:
+			switch {
+			case m.rank <= 10:
+				warning = "This is a top-10 common password"
+			case m.rank <= 100:
+				warning = "This is a top-100 common password"
+			default:
+				warning = "This is a very common password"
+			}
+		case m.dict == dictPasswords:
+			warning = "This is similar to a commonly used password"
+		case only:
+			warning = "A word by itself is easy to guess"
+		}
+		var s []string
+		if uppercaseVariations(m.token) > 1 {
+			s = append(s, "Capitalization doesn't help very much")
+		}
+		if m.reversed {
+			s = append(s, "Reversed words aren't much harder to guess")
+		}
+		if len(m.l33t) > 0 {
+			s = append(s, "Predictable substitutions like '@' instead of 'a' don't help very much")
+		}
+		return warning, s
+	case "spatial":
+		if m.turns == 1 {
+			return "Straight rows of keys are easy to guess", []string{"Use a longer keyboard pattern with more turns"}
+		}
+		return "Short keyboard patterns are easy to guess", []string{"Use a longer keyboard pattern with more turns"}
+	case "repeat":
+		if len([]rune(m.base)) == 1 {
+			return `Repeats like "aaa" are easy to guess`, []string{"Avoid repeated words and characters"}
+		}
+		return `Repeats like "abcabcabc" are only slightly harder to guess than "abc"`, []string{"Avoid repeated words and characters"}
+	case "sequence":
+		return "Sequences like abc or 6543 are easy to guess", []string{"Avoid sequences"}
+	case "year":
+		return "Recent years are easy to guess", []string{"Avoid recent years", "Avoid years that are associated with you"}
+	case "date":
+		return "Dates are often easy to guess", []string{"Avoid dates and years that are associated with you"}
+	}
+	return "", nil
+}
@@ -0,0 +1,73 @@
+package strength
+
+import (
+	"testing"
+)
+
+func TestEstimateScores(t *testing.T) {
+	cases := []struct {
+		pw       string
+		maxScore int
+		minScore int
+	}{
+		{"password", 0, 0},
+		{"Password1234!", 1, 0},
+		{"P@ssw0rd", 0, 0},
+		{"qwertyuiop", 0, 0},
+		{"aaaaaaaaaaaa", 0, 0},
+		{"abcdefghij", 0, 0},
+		{"13/05/1991", 1, 0},
+		{"drowssap", 0, 0},
+		{"xK9#mQ2$vL7@nR4p", 4, 4},
+		{"correcthorsebatterystaple", 4, 3},
+	}
+	for _, c := range cases {
+		r := Estimate(c.pw)
+		if r.Score < c.minScore || r.Score > c.maxScore {
+			t.Errorf("%q: score %d, want %d..%d (guesses 1e%.2f)", c.pw, r.Score, c.minScore, c.maxScore, r.GuessesLog10)
+		}
+	}
+}
+
+func TestPatterns(t *testing.T) {
+	cases := map[string]string{
+		"qazxswedc":  "spatial",
+		"kkkkkkkk":   "repeat",
+		"stuvwxyz":   "sequence",
+		"97531":      "sequence",
+		"2019":       "year",
+		"1991-05-13": "date",
+		"olleh":      "dictionary",
+	}
+	for pw, want := range cases {
+		r := Estimate(pw)
+		if len(r.Sequence) != 1 || r.Sequence[0].Pattern != want {
+			t.Errorf("%q: sequence %+v, want a single %s match", pw, r.Sequence, want)
+		}
+	}
+}
+
+func TestUserInputs(t *testing.T) {
+	pw := "Zorblat"
+	without := Estimate(pw)
+	with := Estimate(pw, "zorblat", "quinzy@example.com")
+	if with.Guesses >= without.Guesses/1000 {
+		t.Fatalf("user inputs barely mattered: %v vs %v", with.Guesses, without.Guesses)
+	}
+	if with.Warning != "Passwords based on your name or email are easy to guess" {
+		t.Fatalf("warning = %q", with.Warning)
+	}
+}
+
+func TestFeedback(t *testing.T) {
+	r := Estimate("password")
+	if r.Warning != "This is a top-10 common password" || len(r.Suggestions) == 0 {
+		t.Fatalf("feedback = %q %v", r.Warning, r.Suggestions)
+	}
+	if r := Estimate("xK9#mQ2$vL7@nR4p"); r.Warning != "" || r.Suggestions != nil {
+		t.Fatalf("strong password got feedback %q %v", r.Warning, r.Suggestions)
+	}
+	if r.CrackTime != "less than a second" {
+		t.Fatalf("crack time = %q", r.CrackTime)
+	}
+}
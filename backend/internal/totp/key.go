@@ -0,0 +1,193 @@
+package totp
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"errors"
+	"fmt"
+	"hash"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Algorithm string
+
+const (
+	SHA1   Algorithm = "SHA1"
+	SHA256 Algorithm = "SHA256"
+	SHA512 Algorithm = "SHA512"
+)
+
+func (a Algorithm) hash() (func() hash.Hash, error) {
+	switch a {
+	case SHA1, "":
+		return sha1.New, nil
+	case SHA256:
+		return sha256.New, nil
+	case SHA512:
+		return sha512.New, nil
+	default:
+		return nil, fmt.Errorf("totp: unsupported algorithm %q", string(a))
+	}
+}
+
+const (
+	TypeTOTP = "totp"
+	TypeHOTP = "hotp"
+)
+
+var ErrInvalidKey = errors.New("totp: invalid key")
+
+// Key is a one-time password seed as described by an otpauth:// URI.
+type Key struct {
+	Type      string    `json:"type"`
+	Secret    string    `json:"-"`
+	Issuer    string    `json:"issuer,omitempty"`
+	Account   string    `json:"account,omitempty"`
+	Algorithm Algorithm `json:"algorithm"`
+	Digits    int       `json:"digits"`
+	Period    int       `json:"period,omitempty"`  // seconds, TOTP only
+	Counter   uint64    `json:"counter,omitempty"` // HOTP only
+}
+
+// ParseKey accepts either an otpauth:// URI or a bare base32 secret, which
+// is taken as a default SHA1, 6 digit, 30 second TOTP key.
+func ParseKey(s string) (Key, error) {
+	s = strings.TrimSpace(s)
+	if strings.HasPrefix(strings.ToLower(s), "otpauth://") {
+		return ParseURI(s)
+	}
+	k := Key{
+		Type:      TypeTOTP,
+		Secret:    s,
+		Algorithm: SHA1,
+		Digits:    DefaultDigits,
+		Period:    int(DefaultStep / time.Second),
+	}
+	return k, k.validate()
+}
+
+// ParseURI parses a Key URI in the format used by Google Authenticator:
+// otpauth://TYPE/ISSUER:ACCOUNT?secret=...&issuer=...&algorithm=...
+func ParseURI(uri string) (Key, error) {
+	u, err := url.Parse(uri)
+	if err != nil || !strings.EqualFold(u.Scheme, "otpauth") {
+		return Key{}, fmt.Errorf("%w: not an otpauth:// URI", ErrInvalidKey)
+	}
+	q := u.Query()
+	k := Key{
+		Type:      strings.ToLower(u.Host),
+		Secret:    q.Get("secret"),
+		Issuer:    q.Get("issuer"),
+		Algorithm: Algorithm(strings.ToUpper(q.Get("algorithm"))),
+		Digits:    DefaultDigits,
+		Period:    int(DefaultStep / time.Second),
+	}
+	if k.Algorithm == "" {
+		k.Algorithm = SHA1
+	}
+	label := strings.TrimPrefix(u.Path, "/")
+	if issuer, account, ok := strings.Cut(label, ":"); ok {
+		if k.Issuer == "" {
+			k.Issuer = strings.TrimSpace(issuer)
+		}
+		label = account
+	}
+	k.Account = strings.TrimSpace(label)
+
+	if s := q.Get("digits"); s != "" {
+		if k.Digits, err = strconv.Atoi(s); err != nil {
+			return Key{}, fmt.Errorf("%w: bad digits %q", ErrInvalidKey, s)
+		}
+	}
+	switch k.Type {
+	case TypeTOTP:
+		if s := q.Get("period"); s != "" {
+			if k.Period, err = strconv.Atoi(s); err != nil {
+				return Key{}, fmt.Errorf("%w: bad period %q", ErrInvalidKey, s)
+			}
+		}
+	case TypeHOTP:
+		k.Period = 0
+		if s := q.Get("counter"); s != "" {
+			if k.Counter, err = strconv.ParseUint(s, 10, 64); err != nil {
+				return Key{}, fmt.Errorf("%w: bad counter %q", ErrInvalidKey, s)
+			}
+		}
+	}
+	return k, k.validate()
+}
+
+func (k Key) validate() error {
+	if k.Type != TypeTOTP && k.Type != TypeHOTP {
+		return fmt.Errorf("%w: unknown type %q", ErrInvalidKey, k.Type)
+	}
+	if _, err := k.Algorithm.hash(); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidKey, err)
+	}
+	if k.Digits < 6 || k.Digits > 8 {
+		return fmt.Errorf("%w: digits must be 6 to 8", ErrInvalidKey)
+	}
+	if k.Type == TypeTOTP && k.Period <= 0 {
+		return fmt.Errorf("%w: period must be positive", ErrInvalidKey)
+	}
+	secret, err := decodeSecret(k.Secret)
+	if err != nil || len(secret) == 0 {
+		return fmt.Errorf("%w: secret must be base32", ErrInvalidKey)
+	}
+	zero(secret)
+	return nil
+}
+
+// URI formats k as an otpauth:// URI.
+func (k Key) URI() string {
+	label := url.PathEscape(k.Account)
+	if k.Issuer != "" {
+		label = url.PathEscape(k.Issuer) + ":" + label
+	}
+	q := url.Values{}
+	q.Set("secret", strings.ToUpper(strings.ReplaceAll(k.Secret, " ", "")))
+	if k.Issuer != "" {
+		q.Set("issuer", k.Issuer)
+	}
+	q.Set("algorithm", string(k.Algorithm))
+	q.Set("digits", strconv.Itoa(k.Digits))
+	if k.Type == TypeHOTP {
+		q.Set("counter", strconv.FormatUint(k.Counter, 10))
+	} else {
+		q.Set("period", strconv.Itoa(k.Period))
+	}
+	return "otpauth://" + k.Type + "/" + label + "?" + q.Encode()
+}
+
+// Code returns the code for when, or for the current counter of an HOTP
+// key. Callers of HOTP keys must store the key with Counter advanced.
+func (k Key) Code(when time.Time) (string, error) {
+	if err := k.validate(); err != nil {
+		return "", err
+	}
+	h, _ := k.Algorithm.hash()
+	secret, err := decodeSecret(k.Secret)
+	if err != nil {
+		return "", err
+	}
+	defer zero(secret)
+	counter := k.Counter
+	if k.Type == TypeTOTP {
+		counter = uint64(when.Unix() / int64(k.Period))
+	}
+	return generate(h, secret, counter, k.Digits), nil
+}
+
+// Remaining is how long the TOTP code for when stays valid. It is zero for
+// HOTP keys.
+func (k Key) Remaining(when time.Time) time.Duration {
+	if k.Type != TypeTOTP || k.Period <= 0 {
+		return 0
+	}
+	p := int64(k.Period)
+	return time.Duration(p-when.Unix()%p) * time.Second
+}
@@ -7,6 +7,7 @@ import (
 	"encoding/base32"
 	"encoding/binary"
 	"fmt"
+	"hash"
 	"strings"
 	"time"
 )
@@ -66,21 +67,31 @@ func ProvisionURI(account, issuer, secret string) string {
 }
 
 func computeCode(secret []byte, counter uint64) string {
+	return generate(sha1.New, secret, counter, DefaultDigits)
+}
+
+// generate is the HOTP value of RFC 4226, with the hash and number of
+// digits left open as RFC 6238 allows.
+func generate(h func() hash.Hash, secret []byte, counter uint64, digits int) string {
 	var buf [8]byte
 	binary.BigEndian.PutUint64(buf[:], counter)
 
-	mac := hmac.New(sha1.New, secret)
+	mac := hmac.New(h, secret)
 	mac.Write(buf[:])
 	sum := mac.Sum(nil)
 
 	offset := sum[len(sum)-1] & 0x0F
 	trunc := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7FFFFFFF
-	code := trunc % 1000000
-	return fmt.Sprintf("%0*d", DefaultDigits, code)
+	mod := uint32(1)
+	for i := 0; i < digits; i++ {
+		mod *= 10
+	}
+	return fmt.Sprintf("%0*d", digits, trunc%mod)
 }
 
 func decodeSecret(secret string) ([]byte, error) {
-	secret = strings.ToUpper(strings.TrimSpace(secret))
+	secret = strings.ToUpper(strings.ReplaceAll(strings.TrimSpace(secret), " ", ""))
+	secret = strings.TrimRight(secret, "=")
 	decoder := base32.StdEncoding.WithPadding(base32.NoPadding)
 	return decoder.DecodeString(secret)
 }
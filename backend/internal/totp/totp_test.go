@@ -0,0 +1,120 @@
+package totp
+
+import (
+	"encoding/base32"
+	"strings"
+	"testing"
+	"time"
+)
+
+func b32(s string) string {
+	return base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte(s))
+}
+
+// Test vectors from RFC 6238, appendix B.
+func TestRFC6238(t *testing.T) {
+	seeds := map[Algorithm]string{
+		SHA1:   "12345678901234567890",
+		SHA256: "12345678901234567890123456789012",
+		SHA512: "1234567890123456789012345678901234567890123456789012345678901234",
+	}
+	cases := []struct {
+		at   int64
+		algo Algorithm
+		want string
+	}{
+		{59, SHA1, "94287082"},
+		{59, SHA256, "46119246"},
+		{59, SHA512, "90693936"},
+		{1111111109, SHA1, "07081804"},
+		{1111111109, SHA256, "68084774"},
+		{1111111109, SHA512, "25091201"},
+		{20000000000, SHA512, "47863826"},
+	}
+	for _, c := range cases {
+		k := Key{Type: TypeTOTP, Secret: b32(seeds[c.algo]), Algorithm: c.algo, Digits: 8, Period: 30}
+		got, err := k.Code(time.Unix(c.at, 0))
+		if err != nil {
+			t.Fatalf("%s@%d: %v", c.algo, c.at, err)
+		}
+		if got != c.want {
+			t.Errorf("%s@%d: got %s, want %s", c.algo, c.at, got, c.want)
+		}
+	}
+}
+
+// Test vectors from RFC 4226, appendix D.
+func TestHOTP(t *testing.T) {
+	want := []string{"755224", "287082", "359152", "969429", "338314"}
+	k := Key{Type: TypeHOTP, Secret: b32("12345678901234567890"), Algorithm: SHA1, Digits: 6}
+	for i, w := range want {
+		k.Counter = uint64(i)
+		got, err := k.Code(time.Time{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != w {
+			t.Errorf("counter %d: got %s, want %s", i, got, w)
+		}
+	}
+}
+
+func TestParseURI(t *testing.T) {
+	k, err := ParseURI("otpauth://totp/ACME%20Co:john@example.com?secret=JBSWY3DPEHPK3PXP&algorithm=SHA256&digits=8&period=60")
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if k.Type != TypeTOTP || k.Issuer != "ACME Co" || k.Account != "john@example.com" ||
+		k.Algorithm != SHA256 || k.Digits != 8 || k.Period != 60 {
+		t.Fatalf("unexpected key: %+v", k)
+	}
+	if k.Remaining(time.Unix(125, 0)) != 55*time.Second {
+		t.Fatalf("remaining = %v", k.Remaining(time.Unix(125, 0)))
+	}
+
+	again, err := ParseURI(k.URI())
+	if err != nil || again != k {
+		t.Fatalf("round trip: %+v, %v", again, err)
+	}
+
+	h, err := ParseURI("otpauth://hotp/svc?secret=JBSWY3DPEHPK3PXP&counter=7")
+	if err != nil || h.Type != TypeHOTP || h.Counter != 7 || h.Period != 0 {
+		t.Fatalf("hotp: %+v, %v", h, err)
+	}
+	if !strings.Contains(h.URI(), "counter=7") {
+		t.Fatalf("hotp URI lost the counter: %s", h.URI())
+	}
+
+	for _, bad := range []string{
+		"https://example.com",
+		"otpauth://motp/x?secret=JBSWY3DPEHPK3PXP",
+		"otpauth://totp/x?secret=not-base32!",
+		"otpauth://totp/x",
+		"otpauth://totp/x?secret=JBSWY3DPEHPK3PXP&algorithm=MD5",
+		"otpauth://totp/x?secret=JBSWY3DPEHPK3PXP&digits=4",
+		"otpauth://totp/x?secret=JBSWY3DPEHPK3PXP&period=0",
+	} {
+		if _, err := ParseKey(bad); err == nil {
+			t.Errorf("%s: expected an error", bad)
+		}
+	}
+
+	if k, err := ParseKey("jbsw y3dp ehpk 3pxp"); err != nil || k.Digits != 6 || k.Period != 30 {
+		t.Fatalf("bare secret: %+v, %v", k, err)
+	}
+}
+
+func TestVerifyStillAcceptsDefaultCodes(t *testing.T) {
+	secret, err := GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	code, err := Key{Type: TypeTOTP, Secret: secret, Algorithm: SHA1, Digits: 6, Period: 30}.Code(now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !Verify(code, secret, now) {
+		t.Fatal("Verify rejected a code from Key.Code")
+	}
+}
@@ -0,0 +1,300 @@
+package vault
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	cr "project-crypto/internal/crypto"
+)
+
+var (
+	ErrAttachmentNotFound = errors.New("vault: attachment not found")
+	ErrAttachmentTooLarge = errors.New("vault: attachment too large")
+)
+
+type AttachmentMeta struct {
+	ID      string `json:"id"`
+	Name    string `json:"name"`
+	MIME    string `json:"mime,omitempty"`
+	Size    int64  `json:"size"`
+	Created int64  `json:"created"`
+}
+
+func attachmentBlobID(id, attID string) string { return id + ".att." + attID }
+
+func attachmentAAD(id, attID string) []byte { return []byte("attachment:" + id + "/" + attID) }
+
+func attachmentWrapAAD(id, attID string) []byte { return []byte("attachment-wrap:" + id + "/" + attID) }
+
+func (a Attachment) meta(attID string) AttachmentMeta {
+	return AttachmentMeta{ID: attID, Name: a.Name, MIME: a.MIME, Size: a.Size, Created: a.Created}
+}
+
+// AddAttachment encrypts the contents of r under a fresh DEK and stores
+// it as its own blob. Its name, type, size and wrapped DEK are kept in
+// the KeyDirectory entry of the item. Reading and encrypting r happen
+// without holding the vault lock, which is only taken to check the item
+// and to commit the entry, so a slow upload does not hold up other calls.
+func (v *vault) AddAttachment(ctx context.Context, id, name, mime string, r io.Reader) (AttachmentMeta, error) {
+	limit, err := v.attachmentLimit(id)
+	if err != nil {
+		return AttachmentMeta{}, err
+	}
+	src := r
+	if limit >= 0 {
+		src = io.LimitReader(r, limit+1)
+	}
+
+	attID, err := newShortID()
+	if err != nil {
+		return AttachmentMeta{}, err
+	}
+	dek := make([]byte, 32)
+	if _, err := rand.Read(dek); err != nil {
+		return AttachmentMeta{}, err
+	}
+	defer cr.Zero(dek)
+
+	// Only ciphertext is buffered; plaintext passes through in chunks.
+	var buf bytes.Buffer
+	sw, err := cr.NewStreamWriter(&buf, v.dekKey(dek), attachmentAAD(id, attID))
+	if err != nil {
+		return AttachmentMeta{}, err
+	}
+	size, err := io.Copy(sw, src)
+	if err != nil {
+		return AttachmentMeta{}, err
+	}
+	if limit >= 0 && size > limit {
+		return AttachmentMeta{}, fmt.Errorf("%w: limit is %d bytes", ErrAttachmentTooLarge, limit)
+	}
+	if err := sw.Close(); err != nil {
+		return AttachmentMeta{}, err
+	}
+	ct := buf.Bytes()
+	sum := sha256.Sum256(ct)
+	a := Attachment{
+		Name:    name,
+		MIME:    mime,
+		Size:    size,
+		Created: time.Now().Unix(),
+		Sum:     sum[:],
+		Chunked: true,
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	// The item may have changed while r was read, so every check is made
+	// again before anything is written.
+	if err := v.checkAttachmentSize(id, size); err != nil {
+		return AttachmentMeta{}, err
+	}
+	// The DEK is wrapped only now: a rekey may have replaced the VRK.
+	if a.DekWrap, err = cr.Seal(v.vrk[:], dek, attachmentWrapAAD(id, attID)); err != nil {
+		return AttachmentMeta{}, err
+	}
+	if err := v.store.Put(ctx, attachmentBlobID(id, attID), ct); err != nil {
+		return AttachmentMeta{}, err
+	}
+	ki := v.kd.Items[id]
+	if ki.Attachments == nil {
+		ki.Attachments = map[string]Attachment{}
+	}
+	ki.Attachments[attID] = a
+	v.kd.Items[id] = ki
+	if err := v.flushKD(); err != nil {
+		return AttachmentMeta{}, err
+	}
+	return a.meta(attID), nil
+}
+
+// attachmentLimit returns how many bytes a new attachment of id may hold,
+// or -1 for no limit.
+func (v *vault) attachmentLimit(id string) (int64, error) {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	if err := v.checkAttachable(id); err != nil {
+		return 0, err
+	}
+	return v.attachmentRoom(id), nil
+}
+
+// checkAttachmentSize reports whether an attachment of size bytes may be
+// added to id now.
+func (v *vault) checkAttachmentSize(id string, size int64) error {
+	if err := v.checkAttachable(id); err != nil {
+		return err
+	}
+	if limit := v.attachmentRoom(id); limit >= 0 && size > limit {
+		return fmt.Errorf("%w: limit is %d bytes", ErrAttachmentTooLarge, limit)
+	}
+	return nil
+}
+
+func (v *vault) checkAttachable(id string) error {
+	if !v.unlocked {
+		return ErrNotUnlocked
+	}
+	if v.store == nil {
+		return fmt.Errorf("no blob store configured")
+	}
+	if _, ok := v.kd.Items[id]; !ok {
+		return fmt.Errorf("%w: %s", ErrItemNotFound, id)
+	}
+	if v.meta[id].Deleted != 0 {
+		return fmt.Errorf("%w: %s", ErrInTrash, id)
+	}
+	return nil
+}
+
+// attachmentRoom is the smaller of the per-attachment limit and what is
+// left of the item's total, or -1 if neither applies.
+func (v *vault) attachmentRoom(id string) int64 {
+	limit := v.kd.Policy.MaxAttachmentSize
+	if total := v.kd.Policy.MaxItemAttachmentBytes; total >= 0 {
+		var used int64
+		for _, a := range v.kd.Items[id].Attachments {
+			used += a.Size
+		}
+		if limit < 0 || total-used < limit {
+			limit = max(total-used, 0)
+		}
+	}
+	return limit
+}
+
+func (v *vault) ListAttachments(ctx context.Context, id string) ([]AttachmentMeta, error) {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	if !v.unlocked {
+		return nil, ErrNotUnlocked
+	}
+	ki, ok := v.kd.Items[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrItemNotFound, id)
+	}
+	out := make([]AttachmentMeta, 0, len(ki.Attachments))
+	for attID, a := range ki.Attachments {
+		out = append(out, a.meta(attID))
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Created != out[j].Created {
+			return out[i].Created < out[j].Created
+		}
+		return out[i].ID < out[j].ID
+	})
+	return out, nil
+}
+
+// ReadAttachment decrypts an attachment and writes it to w. Chunked
+// attachments are written chunk by chunk as each one is authenticated, so
+// w may have received part of the plaintext when an error is returned.
+// The ciphertext and DEK are read under the vault lock; decrypting and
+// writing to w happen after it is released.
+func (v *vault) ReadAttachment(ctx context.Context, id, attID string, w io.Writer) (AttachmentMeta, error) {
+	a, ct, dek, err := v.openAttachment(ctx, id, attID)
+	if err != nil {
+		return AttachmentMeta{}, err
+	}
+	defer cr.Zero(dek)
+	if a.Chunked {
+		sr, err := cr.NewStreamReader(bytes.NewReader(ct), v.dekKey(dek), attachmentAAD(id, attID))
+		if err != nil {
+			return AttachmentMeta{}, err
+		}
+		if _, err := io.Copy(w, sr); err != nil {
+			return AttachmentMeta{}, err
+		}
+		return a.meta(attID), nil
+	}
+	pt, err := cr.OpenAny(v.dekKey(dek), ct, attachmentAAD(id, attID))
+	if err != nil {
+		return AttachmentMeta{}, err
+	}
+	defer cr.Zero(pt)
+	if _, err := w.Write(pt); err != nil {
+		return AttachmentMeta{}, err
+	}
+	return a.meta(attID), nil
+}
+
+// openAttachment returns the entry, the checked ciphertext and the DEK of
+// an attachment. The caller zeroes the DEK.
+func (v *vault) openAttachment(ctx context.Context, id, attID string) (Attachment, []byte, []byte, error) {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	if !v.unlocked {
+		return Attachment{}, nil, nil, ErrNotUnlocked
+	}
+	a, err := v.attachment(id, attID)
+	if err != nil {
+		return Attachment{}, nil, nil, err
+	}
+	ct, err := v.store.Get(ctx, attachmentBlobID(id, attID))
+	if err != nil {
+		return Attachment{}, nil, nil, err
+	}
+	if err := verifyAttachmentBlob(id, a, ct); err != nil {
+		return Attachment{}, nil, nil, err
+	}
+	dek, err := cr.OpenAny(v.vrk[:], a.DekWrap, attachmentWrapAAD(id, attID))
+	if err != nil {
+		return Attachment{}, nil, nil, err
+	}
+	return a, ct, dek, nil
+}
+
+func (v *vault) DeleteAttachment(ctx context.Context, id, attID string) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if !v.unlocked {
+		return ErrNotUnlocked
+	}
+	if _, err := v.attachment(id, attID); err != nil {
+		return err
+	}
+	ki := v.kd.Items[id]
+	delete(ki.Attachments, attID)
+	v.kd.Items[id] = ki
+	if err := v.flushKD(); err != nil {
+		return err
+	}
+	return v.store.Delete(ctx, attachmentBlobID(id, attID))
+}
+
+func (v *vault) attachment(id, attID string) (Attachment, error) {
+	ki, ok := v.kd.Items[id]
+	if !ok {
+		return Attachment{}, fmt.Errorf("%w: %s", ErrItemNotFound, id)
+	}
+	a, ok := ki.Attachments[attID]
+	if !ok {
+		return Attachment{}, fmt.Errorf("%w: %s/%s", ErrAttachmentNotFound, id, attID)
+	}
+	return a, nil
+}
+
+func verifyAttachmentBlob(id string, a Attachment, ct []byte) error {
+	sum := sha256.Sum256(ct)
+	if !hmac.Equal(sum[:], a.Sum) {
+		return &IntegrityError{ID: id, Reason: "attachment does not match the key directory"}
+	}
+	return nil
+}
+
+func newShortID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,415 @@
+package vault
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	cr "project-crypto/internal/crypto"
+	"project-crypto/internal/storage"
+)
+
+// A backup archive is
+//
+//	magic "VLTB" | archive version u16 | kdf length u16 | kdf
+//	STREAM ciphertext of a tar file
+//
+// where kdf is encoded as in the vault container and the STREAM key is
+// Argon2id of the backup passphrase under it. Everything before the
+// ciphertext is its AAD. The tar holds the vault file as "header", the
+// metadata documents as "meta.json", one "blobs/<id>" entry per blob and
+// finally "manifest.json", which lists the size and SHA-256 of every other
+// entry.
+//
+// The passphrase may be the master password or a separate one; the
+// archive does not say which.
+
+var ErrBadBackup = errors.New("vault: invalid or corrupt backup")
+
+var backupMagic = []byte("VLTB")
+
+const backupVersion = 1
+
+// Bounds on what an archive may ask of the reader. The key derivation must
+// be at least as strong as the cheapest the vault would write and no more
+// than a crafted file could use to exhaust memory or time: Argon2 memory
+// in KiB, passes and lanes, and salt bytes. Entries are held in memory
+// until the whole archive has been checked, so their sizes are capped one
+// by one and in total; each entry counts a tar block on top of its size.
+const (
+	backupMinKDFM    = 8 * 1024
+	backupMaxKDFM    = 1024 * 1024
+	backupMaxKDFT    = 16
+	backupMaxKDFP    = 16
+	backupMinKDFSalt = 16
+
+	backupMaxEntry = 256 << 20
+	backupMaxTotal = 2 << 30
+)
+
+const (
+	backupHeaderEntry   = "header"
+	backupMetaEntry     = "meta.json"
+	backupManifestEntry = "manifest.json"
+	backupBlobPrefix    = "blobs/"
+)
+
+type BackupManifest struct {
+	Version       int                   `json:"version"`
+	FormatVersion int                   `json:"format_version"`
+	Created       int64                 `json:"created"`
+	Items         int                   `json:"items"`
+	Blobs         int                   `json:"blobs"`
+	Entries       []BackupManifestEntry `json:"entries"`
+}
+
+type BackupManifestEntry struct {
+	Name   string `json:"name"`
+	Size   int64  `json:"size"`
+	SHA256 []byte `json:"sha256"`
+}
+
+// Backup writes an archive of the whole vault, trashed items and
+// revisions included, to w. The header, metadata and list of blobs are
+// taken under the read lock; the key is derived and the blobs are read and
+// written after it is released. Each blob is checked against the sum the
+// header records for it, so a change made meanwhile fails the backup with
+// ErrConflict instead of producing an archive that contradicts its header.
+func (v *vault) Backup(ctx context.Context, w io.Writer, passphrase []byte) (BackupManifest, error) {
+	snap, err := v.backupSnapshot()
+	if err != nil {
+		return BackupManifest{}, err
+	}
+
+	prefix, key := newBackupKey(passphrase)
+	defer zero32(&key)
+	if _, err := w.Write(prefix); err != nil {
+		return BackupManifest{}, err
+	}
+	sw, err := cr.NewStreamWriter(w, key[:], prefix)
+	if err != nil {
+		return BackupManifest{}, err
+	}
+	tw := tar.NewWriter(sw)
+
+	man := BackupManifest{
+		Version:       backupVersion,
+		FormatVersion: snap.version,
+		Created:       time.Now().Unix(),
+		Items:         snap.items,
+	}
+	add := func(name string, data []byte) error {
+		sum := sha256.Sum256(data)
+		man.Entries = append(man.Entries, BackupManifestEntry{Name: name, Size: int64(len(data)), SHA256: sum[:]})
+		return writeTarEntry(tw, name, data, man.Created)
+	}
+
+	if err := add(backupHeaderEntry, snap.header); err != nil {
+		return BackupManifest{}, err
+	}
+	metaJSON, _ := json.Marshal(snap.metas)
+	if err := add(backupMetaEntry, metaJSON); err != nil {
+		return BackupManifest{}, err
+	}
+	for _, b := range snap.blobs {
+		ct, err := snap.store.Get(ctx, b.id)
+		if err != nil {
+			return BackupManifest{}, fmt.Errorf("blob %s: %w", b.id, err)
+		}
+		if sum := sha256.Sum256(ct); len(b.sum) > 0 && !hmac.Equal(sum[:], b.sum) {
+			return BackupManifest{}, fmt.Errorf("%w: blob %s changed during the backup", ErrConflict, b.id)
+		}
+		if err := add(backupBlobPrefix+b.id, ct); err != nil {
+			return BackupManifest{}, err
+		}
+		man.Blobs++
+	}
+
+	manJSON, _ := json.Marshal(man)
+	if err := writeTarEntry(tw, backupManifestEntry, manJSON, man.Created); err != nil {
+		return BackupManifest{}, err
+	}
+	if err := tw.Close(); err != nil {
+		return BackupManifest{}, err
+	}
+	if err := sw.Close(); err != nil {
+		return BackupManifest{}, err
+	}
+	v.mu.Lock()
+	v.audit.Append(fmt.Sprintf("backup items=%d blobs=%d", man.Items, man.Blobs))
+	v.mu.Unlock()
+	return man, nil
+}
+
+// backupSnapshot is what Backup reads under the vault lock.
+type backupSnapshot struct {
+	header  []byte
+	version int
+	items   int
+	metas   []storage.ItemMeta
+	blobs   []backupBlob
+	store   storage.BlobStore
+}
+
+// backupBlob is a blob the key directory refers to, with the SHA-256 it
+// records for it. Blobs written before sums were kept have none.
+type backupBlob struct {
+	id  string
+	sum []byte
+}
+
+func (v *vault) backupSnapshot() (backupSnapshot, error) {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	if !v.unlocked {
+		return backupSnapshot{}, ErrNotUnlocked
+	}
+	if v.store == nil {
+		return backupSnapshot{}, fmt.Errorf("no blob store configured")
+	}
+	header, err := os.ReadFile(v.path)
+	if err != nil {
+		return backupSnapshot{}, err
+	}
+	metas := make([]storage.ItemMeta, 0, len(v.meta))
+	for _, m := range v.meta {
+		metas = append(metas, storage.ItemMeta{
+			ID: m.ID, Type: m.Type, Created: m.Created, Updated: m.Updated, Version: m.Version, Deleted: m.Deleted,
+		})
+	}
+	sort.Slice(metas, func(i, j int) bool { return metas[i].ID < metas[j].ID })
+	return backupSnapshot{
+		header:  header,
+		version: v.header.Version,
+		items:   len(v.kd.Items),
+		metas:   metas,
+		blobs:   v.backupBlobs(),
+		store:   v.store,
+	}, nil
+}
+
+// backupBlobs lists every blob the key directory refers to.
+func (v *vault) backupBlobs() []backupBlob {
+	var out []backupBlob
+	for id, ki := range v.kd.Items {
+		var sum []byte
+		if len(ki.MetaMAC) > 0 {
+			sum = ki.BlobSum
+		}
+		out = append(out, backupBlob{id: id, sum: sum})
+		for _, rev := range ki.History {
+			out = append(out, backupBlob{id: revisionBlobID(id, rev.Version), sum: rev.Sum})
+		}
+		for attID, a := range ki.Attachments {
+			out = append(out, backupBlob{id: attachmentBlobID(id, attID), sum: a.Sum})
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].id < out[j].id })
+	return out
+}
+
+func writeTarEntry(tw *tar.Writer, name string, data []byte, mtime int64) error {
+	hdr := &tar.Header{
+		Name:    name,
+		Mode:    0o600,
+		Size:    int64(len(data)),
+		ModTime: time.Unix(mtime, 0),
+		Format:  tar.FormatPAX,
+	}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	_, err := tw.Write(data)
+	return err
+}
+
+func newBackupKey(passphrase []byte) ([]byte, [32]byte) {
+	kdf := defaultKDF()
+	prefix := backupPrefix(KDFHeader{Algo: "argon2id", M: kdf.M, T: kdf.T, P: kdf.P, Salt: kdf.Salt})
+	return prefix, cr.DeriveKEK(passphrase, kdf)
+}
+
+func backupPrefix(k KDFHeader) []byte {
+	enc := encodeKDF(k)
+	var prefix bytes.Buffer
+	prefix.Write(backupMagic)
+	_ = binary.Write(&prefix, binary.BigEndian, uint16(backupVersion))
+	_ = binary.Write(&prefix, binary.BigEndian, uint16(len(enc)))
+	prefix.Write(enc)
+	return prefix.Bytes()
+}
+
+// ReadBackup decrypts an archive and checks it against its manifest. It
+// returns the manifest and the entries by name; nothing is written.
+func ReadBackup(r io.Reader, passphrase []byte) (BackupManifest, map[string][]byte, error) {
+	fixed := make([]byte, len(backupMagic)+4)
+	if _, err := io.ReadFull(r, fixed); err != nil {
+		return BackupManifest{}, nil, fmt.Errorf("%w: %v", ErrBadBackup, err)
+	}
+	if !bytes.HasPrefix(fixed, backupMagic) {
+		return BackupManifest{}, nil, fmt.Errorf("%w: not a vault backup", ErrBadBackup)
+	}
+	if ver := binary.BigEndian.Uint16(fixed[4:6]); ver != backupVersion {
+		return BackupManifest{}, nil, fmt.Errorf("%w: unsupported archive version %d", ErrBadBackup, ver)
+	}
+	enc := make([]byte, binary.BigEndian.Uint16(fixed[6:8]))
+	if _, err := io.ReadFull(r, enc); err != nil {
+		return BackupManifest{}, nil, fmt.Errorf("%w: %v", ErrBadBackup, err)
+	}
+	k, err := decodeKDF(enc)
+	if err != nil || k.Algo != "argon2id" {
+		return BackupManifest{}, nil, fmt.Errorf("%w: bad kdf", ErrBadBackup)
+	}
+	if k.M < backupMinKDFM || k.M > backupMaxKDFM || k.T < 1 || k.T > backupMaxKDFT ||
+		k.P < 1 || k.P > backupMaxKDFP || len(k.Salt) < backupMinKDFSalt {
+		return BackupManifest{}, nil, fmt.Errorf("%w: kdf parameters m=%d,t=%d,p=%d out of range", ErrBadBackup, k.M, k.T, k.P)
+	}
+	key := cr.DeriveKEK(passphrase, cr.KDFParams{M: k.M, T: k.T, P: k.P, Salt: k.Salt})
+	defer zero32(&key)
+
+	sr, err := cr.NewStreamReader(r, key[:], append(fixed, enc...))
+	if err != nil {
+		return BackupManifest{}, nil, fmt.Errorf("%w: %v", ErrBadBackup, err)
+	}
+	entries := map[string][]byte{}
+	var total int64
+	tr := tar.NewReader(sr)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return BackupManifest{}, nil, fmt.Errorf("%w: wrong passphrase or damaged archive: %v", ErrBadBackup, err)
+		}
+		if _, dup := entries[hdr.Name]; dup {
+			return BackupManifest{}, nil, fmt.Errorf("%w: duplicate entry %s", ErrBadBackup, hdr.Name)
+		}
+		if hdr.Size < 0 || hdr.Size > backupMaxEntry {
+			return BackupManifest{}, nil, fmt.Errorf("%w: entry %s is too large", ErrBadBackup, hdr.Name)
+		}
+		if total += hdr.Size + 512; total > backupMaxTotal {
+			return BackupManifest{}, nil, fmt.Errorf("%w: archive is too large", ErrBadBackup)
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			return BackupManifest{}, nil, fmt.Errorf("%w: %v", ErrBadBackup, err)
+		}
+		entries[hdr.Name] = data
+	}
+	// Reading on to the final STREAM chunk proves nothing was cut off.
+	if _, err := io.Copy(io.Discard, sr); err != nil {
+		return BackupManifest{}, nil, fmt.Errorf("%w: %v", ErrBadBackup, err)
+	}
+
+	var man BackupManifest
+	if err := json.Unmarshal(entries[backupManifestEntry], &man); err != nil {
+		return BackupManifest{}, nil, fmt.Errorf("%w: bad manifest", ErrBadBackup)
+	}
+	delete(entries, backupManifestEntry)
+	if err := checkManifest(man, entries); err != nil {
+		return BackupManifest{}, nil, err
+	}
+	return man, entries, nil
+}
+
+// checkManifest requires entries to be exactly the ones the manifest
+// lists, with matching sizes and hashes, and to include a readable header.
+func checkManifest(man BackupManifest, entries map[string][]byte) error {
+	if man.Version != backupVersion {
+		return fmt.Errorf("%w: manifest version %d", ErrBadBackup, man.Version)
+	}
+	if len(man.Entries) != len(entries) {
+		return fmt.Errorf("%w: manifest lists %d entries, archive has %d", ErrBadBackup, len(man.Entries), len(entries))
+	}
+	blobs := 0
+	for _, e := range man.Entries {
+		data, ok := entries[e.Name]
+		if !ok {
+			return fmt.Errorf("%w: %s is missing", ErrBadBackup, e.Name)
+		}
+		sum := sha256.Sum256(data)
+		if int64(len(data)) != e.Size || !hmac.Equal(sum[:], e.SHA256) {
+			return fmt.Errorf("%w: %s does not match the manifest", ErrBadBackup, e.Name)
+		}
+		if id, ok := strings.CutPrefix(e.Name, backupBlobPrefix); ok {
+			if id == "" || strings.ContainsAny(id, "/\\") || strings.HasPrefix(id, ".") {
+				return fmt.Errorf("%w: bad blob name %q", ErrBadBackup, e.Name)
+			}
+			blobs++
+		}
+	}
+	if blobs != man.Blobs {
+		return fmt.Errorf("%w: manifest counts %d blobs, lists %d", ErrBadBackup, man.Blobs, blobs)
+	}
+	if _, ok := entries[backupMetaEntry]; !ok {
+		return fmt.Errorf("%w: no metadata", ErrBadBackup)
+	}
+	h, err := decodeHeader(entries[backupHeaderEntry])
+	if err != nil {
+		return fmt.Errorf("%w: header: %v", ErrBadBackup, err)
+	}
+	if h.Version != man.FormatVersion {
+		return fmt.Errorf("%w: header is format version %d, manifest says %d", ErrBadBackup, h.Version, man.FormatVersion)
+	}
+	return nil
+}
+
+// Restore checks an archive and writes it out as the vault at path, with
+// its blobs and metadata in the given stores. Nothing is written unless
+// the whole archive checks out. An existing vault file is only replaced
+// when overwrite is set; the header goes last, so an interrupted restore
+// leaves any previous vault file in place.
+func Restore(ctx context.Context, r io.Reader, passphrase []byte, path string, blobs storage.BlobStore, meta storage.MetaStore, overwrite bool) (BackupManifest, error) {
+	if !overwrite {
+		if _, err := os.Stat(path); err == nil {
+			return BackupManifest{}, fmt.Errorf("vault: %s already exists", path)
+		}
+	}
+	if blobs == nil {
+		return BackupManifest{}, fmt.Errorf("no blob store configured")
+	}
+	man, entries, err := ReadBackup(r, passphrase)
+	if err != nil {
+		return BackupManifest{}, err
+	}
+	var metas []storage.ItemMeta
+	if err := json.Unmarshal(entries[backupMetaEntry], &metas); err != nil {
+		return BackupManifest{}, fmt.Errorf("%w: metadata: %v", ErrBadBackup, err)
+	}
+
+	for _, e := range man.Entries {
+		if id, ok := strings.CutPrefix(e.Name, backupBlobPrefix); ok {
+			if err := blobs.Put(ctx, id, entries[e.Name]); err != nil {
+				return BackupManifest{}, fmt.Errorf("restore blob %s: %w", id, err)
+			}
+		}
+	}
+	if meta != nil {
+		for _, m := range metas {
+			if err := meta.PutMeta(ctx, m); err != nil {
+				return BackupManifest{}, fmt.Errorf("restore meta %s: %w", m.ID, err)
+			}
+		}
+	}
+	// A journal left by the vault being replaced would be applied over
+	// the restored header on the next unlock.
+	if err := os.Remove(journalPath(path)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return BackupManifest{}, err
+	}
+	if err := writeFileAtomic(path, entries[backupHeaderEntry]); err != nil {
+		return BackupManifest{}, err
+	}
+	return man, nil
+}
@@ -0,0 +1,190 @@
+package vault
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// Version 3 and later vault files are a binary container:
+//
+//	magic "VLT3" | format version u16 | section count u16
+//	section table: count × (id u16, offset u32, length u32)
+//	section data
+//
+// All integers are big-endian and offsets are from the start of the file.
+// Readers skip section ids they do not know. Version 2 files are the
+// indented JSON encoding of Header and are still read and written.
+// Version 4 changed nothing in the container; it marks that item ids are
+// random rather than creation timestamps.
+
+const (
+	formatVersionJSON         = 2
+	formatVersionTimestampIDs = 3
+	formatVersion             = 4
+)
+
+var containerMagic = []byte("VLT3")
+
+var ErrBadContainer = errors.New("vault: malformed vault file")
+
+const (
+	sectionKDF      uint16 = 1
+	sectionVRKWrap  uint16 = 2
+	sectionKDCipher uint16 = 3
+	sectionPadding  uint16 = 4
+)
+
+var sectionNames = map[uint16]string{
+	sectionKDF:      "kdf",
+	sectionVRKWrap:  "vrk_wrap",
+	sectionKDCipher: "kd_cipher",
+	sectionPadding:  "padding",
+}
+
+const (
+	containerPrefixLen = 8
+	sectionEntryLen    = 10
+)
+
+type section struct {
+	ID     uint16
+	Offset uint32
+	Length uint32
+}
+
+func encodeHeader(h Header) ([]byte, error) {
+	if h.Version <= formatVersionJSON {
+		return json.MarshalIndent(h, "", "  ")
+	}
+	if h.Version > formatVersion {
+		return nil, fmt.Errorf("vault: cannot write format version %d", h.Version)
+	}
+
+	type part struct {
+		id   uint16
+		data []byte
+	}
+	parts := []part{
+		{sectionKDF, encodeKDF(h.KDF)},
+		{sectionVRKWrap, h.VRKWrap},
+		{sectionKDCipher, h.KDCipher},
+	}
+	if len(h.Padding) > 0 {
+		parts = append(parts, part{sectionPadding, h.Padding})
+	}
+
+	var buf bytes.Buffer
+	buf.Write(containerMagic)
+	_ = binary.Write(&buf, binary.BigEndian, uint16(h.Version))
+	_ = binary.Write(&buf, binary.BigEndian, uint16(len(parts)))
+	off := containerPrefixLen + sectionEntryLen*len(parts)
+	for _, p := range parts {
+		_ = binary.Write(&buf, binary.BigEndian, section{ID: p.id, Offset: uint32(off), Length: uint32(len(p.data))})
+		off += len(p.data)
+	}
+	for _, p := range parts {
+		buf.Write(p.data)
+	}
+	return buf.Bytes(), nil
+}
+
+func decodeHeader(b []byte) (Header, error) {
+	if !bytes.HasPrefix(b, containerMagic) {
+		var h Header
+		if err := json.Unmarshal(b, &h); err != nil {
+			return h, err
+		}
+		if h.Version == 0 {
+			h.Version = formatVersionJSON
+		}
+		return h, nil
+	}
+
+	version, sections, err := readSectionTable(b)
+	if err != nil {
+		return Header{}, err
+	}
+	h := Header{Version: int(version)}
+	for _, s := range sections {
+		data := b[s.Offset : s.Offset+s.Length]
+		switch s.ID {
+		case sectionKDF:
+			if h.KDF, err = decodeKDF(data); err != nil {
+				return Header{}, err
+			}
+		case sectionVRKWrap:
+			h.VRKWrap = append([]byte(nil), data...)
+		case sectionKDCipher:
+			h.KDCipher = append([]byte(nil), data...)
+		case sectionPadding:
+			h.Padding = append([]byte(nil), data...)
+		}
+	}
+	if h.KDF.Algo == "" || len(h.VRKWrap) == 0 || len(h.KDCipher) == 0 {
+		return Header{}, fmt.Errorf("%w: missing required section", ErrBadContainer)
+	}
+	return h, nil
+}
+
+func readSectionTable(b []byte) (uint16, []section, error) {
+	if len(b) < containerPrefixLen {
+		return 0, nil, fmt.Errorf("%w: short prefix", ErrBadContainer)
+	}
+	version := binary.BigEndian.Uint16(b[4:6])
+	count := int(binary.BigEndian.Uint16(b[6:8]))
+	if version > formatVersion {
+		return 0, nil, fmt.Errorf("vault: format version %d is newer than this build supports", version)
+	}
+	tableEnd := containerPrefixLen + sectionEntryLen*count
+	if len(b) < tableEnd {
+		return 0, nil, fmt.Errorf("%w: short section table", ErrBadContainer)
+	}
+	sections := make([]section, count)
+	for i := range sections {
+		e := b[containerPrefixLen+sectionEntryLen*i:]
+		s := section{
+			ID:     binary.BigEndian.Uint16(e[0:2]),
+			Offset: binary.BigEndian.Uint32(e[2:6]),
+			Length: binary.BigEndian.Uint32(e[6:10]),
+		}
+		if int(s.Offset) < tableEnd || uint64(s.Offset)+uint64(s.Length) > uint64(len(b)) {
+			return 0, nil, fmt.Errorf("%w: section %d out of bounds", ErrBadContainer, s.ID)
+		}
+		sections[i] = s
+	}
+	return version, sections, nil
+}
+
+func encodeKDF(k KDFHeader) []byte {
+	var buf bytes.Buffer
+	buf.WriteByte(byte(len(k.Algo)))
+	buf.WriteString(k.Algo)
+	_ = binary.Write(&buf, binary.BigEndian, k.M)
+	_ = binary.Write(&buf, binary.BigEndian, k.T)
+	buf.WriteByte(k.P)
+	_ = binary.Write(&buf, binary.BigEndian, uint16(len(k.Salt)))
+	buf.Write(k.Salt)
+	return buf.Bytes()
+}
+
+func decodeKDF(b []byte) (KDFHeader, error) {
+	bad := fmt.Errorf("%w: bad kdf section", ErrBadContainer)
+	if len(b) < 1 || len(b) < 1+int(b[0])+11 {
+		return KDFHeader{}, bad
+	}
+	n := int(b[0])
+	k := KDFHeader{Algo: string(b[1 : 1+n])}
+	b = b[1+n:]
+	k.M = binary.BigEndian.Uint32(b[0:4])
+	k.T = binary.BigEndian.Uint32(b[4:8])
+	k.P = b[8]
+	saltLen := int(binary.BigEndian.Uint16(b[9:11]))
+	if len(b) != 11+saltLen {
+		return KDFHeader{}, bad
+	}
+	k.Salt = append([]byte(nil), b[11:]...)
+	return k, nil
+}
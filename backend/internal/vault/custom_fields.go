@@ -0,0 +1,92 @@
+package vault
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"project-crypto/internal/totp"
+)
+
+type FieldKind string
+
+const (
+	KindText      FieldKind = "text"
+	KindHidden    FieldKind = "hidden"
+	KindURL       FieldKind = "url"
+	KindEmail     FieldKind = "email"
+	KindTOTP      FieldKind = "totp"
+	KindDate      FieldKind = "date"
+	KindMultiline FieldKind = "multiline"
+)
+
+// CustomField is a user-defined field kept, in order, next to the schema
+// fields of an item. Hidden and TOTP fields are always sensitive.
+type CustomField struct {
+	Name      string    `json:"name"`
+	Kind      FieldKind `json:"kind"`
+	Value     string    `json:"value"`
+	Sensitive bool      `json:"sensitive,omitempty"`
+}
+
+var customKinds = map[FieldKind]func(string) error{
+	KindText:      nil,
+	KindHidden:    nil,
+	KindURL:       validateURL,
+	KindEmail:     validateEmail,
+	KindTOTP:      validateTOTPSecret,
+	KindDate:      validateDate,
+	KindMultiline: nil,
+}
+
+func validateCustomFields(typ string, fields []CustomField) ([]CustomField, error) {
+	if fields == nil {
+		return nil, nil
+	}
+	out := make([]CustomField, 0, len(fields))
+	seen := map[string]bool{}
+	for _, f := range fields {
+		f.Name = strings.TrimSpace(f.Name)
+		field := "custom." + f.Name
+		if f.Name == "" {
+			return nil, &ValidationError{Type: typ, Field: "custom", Reason: "has a field without a name"}
+		}
+		if seen[f.Name] {
+			return nil, &ValidationError{Type: typ, Field: field, Reason: "is defined twice"}
+		}
+		seen[f.Name] = true
+		if f.Kind == "" {
+			f.Kind = KindText
+		}
+		validate, ok := customKinds[f.Kind]
+		if !ok {
+			return nil, &ValidationError{Type: typ, Field: field, Reason: fmt.Sprintf("has unknown kind %q", f.Kind)}
+		}
+		if f.Value != "" && validate != nil {
+			if err := validate(f.Value); err != nil {
+				return nil, &ValidationError{Type: typ, Field: field, Reason: err.Error()}
+			}
+		}
+		if f.Kind == KindHidden || f.Kind == KindTOTP {
+			f.Sensitive = true
+		}
+		out = append(out, f)
+	}
+	return out, nil
+}
+
+func validateURL(s string) error {
+	u, err := url.Parse(s)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return errors.New("must be an absolute URL")
+	}
+	return nil
+}
+
+func validateTOTPSecret(s string) error {
+	if _, err := totp.ParseKey(s); err != nil {
+		return errors.New("must be a base32 secret or a valid otpauth:// URI")
+	}
+	return nil
+}
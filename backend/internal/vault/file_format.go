@@ -17,14 +17,57 @@ type KDFHeader struct {
 }
 
 type KeyDirectory struct {
-	Items   map[string]KDItem `json:"items"`
-	Devices map[string]Device `json:"devices"`
-	Policy  Policy            `json:"policy"`
+	Items   map[string]KDItem   `json:"items"`
+	Devices map[string]Device   `json:"devices"`
+	Policy  Policy              `json:"policy"`
+	Index   map[string]ItemMeta `json:"index,omitempty"`
+	Rekey   *RekeyState         `json:"rekey,omitempty"`
+	Folders map[string]Folder   `json:"folders,omitempty"`
+	Stale   *StaleState         `json:"stale,omitempty"`
+}
+
+// StaleState lists what a migration left to delete once the key directory
+// stopped referencing it: blob ids and metadata documents by item id. It
+// is written together with the change that made them stale, so a crash
+// before the deletes only delays them to the next unlock.
+type StaleState struct {
+	Blobs []string `json:"blobs,omitempty"`
+	Meta  []string `json:"meta,omitempty"`
+}
+
+type RekeyState struct {
+	VRK   []byte            `json:"vrk"`
+	Items map[string]KDItem `json:"items"`
 }
 
 type KDItem struct {
+	DekWrap []byte     `json:"dek_wrap"`
+	MetaMAC []byte     `json:"meta_mac,omitempty"`
+	BlobSum []byte     `json:"blob_sum,omitempty"`
+	History []Revision `json:"history,omitempty"`
+
+	Attachments map[string]Attachment `json:"attachments,omitempty"`
+
+	Folder   string   `json:"folder,omitempty"`
+	Tags     []string `json:"tags,omitempty"`
+	Favorite bool     `json:"favorite,omitempty"`
+}
+
+type Attachment struct {
+	Name    string `json:"name"`
+	MIME    string `json:"mime,omitempty"`
+	Size    int64  `json:"size"`
+	Created int64  `json:"created"`
 	DekWrap []byte `json:"dek_wrap"`
-	MetaMAC []byte `json:"meta_mac,omitempty"`
+	Sum     []byte `json:"sum"`
+	Chunked bool   `json:"chunked,omitempty"`
+}
+
+type Revision struct {
+	Version int    `json:"version"`
+	Type    string `json:"type"`
+	Updated int64  `json:"updated"`
+	Sum     []byte `json:"sum,omitempty"`
 }
 
 type Device struct {
@@ -36,6 +79,11 @@ type Device struct {
 type Item struct {
 	Type   string            `json:"type"`
 	Fields map[string]string `json:"fields"`
+	Custom []CustomField     `json:"custom,omitempty"`
+
+	// Version is the version an item was read at. UpdateItem treats a
+	// non-zero Version as the version being replaced.
+	Version int `json:"version,omitempty"`
 }
 
 type ItemMeta struct {
@@ -44,8 +92,35 @@ type ItemMeta struct {
 	Created int64  `json:"created"`
 	Updated int64  `json:"updated"`
 	Version int    `json:"version"`
+	Deleted int64  `json:"deleted,omitempty"`
+
+	// Title is kept in the encrypted index only, for sorting by title.
+	Title string `json:"title,omitempty"`
+
+	// Filled in by List from the KeyDirectory; never stored in the index.
+	Folder   string   `json:"folder,omitempty"`
+	Tags     []string `json:"tags,omitempty"`
+	Favorite bool     `json:"favorite,omitempty"`
 }
 
+// Query filters List. Folder matches items filed directly in that folder,
+// or anywhere below it with Subfolders set; Tags must all be present.
+// Times are unix seconds and a zero bound is ignored.
 type Query struct {
-	Type string
+	Type       string
+	Folder     string
+	Subfolders bool
+	Tags       []string
+	Favorite   bool
+
+	UpdatedSince  int64 // inclusive
+	CreatedBefore int64 // exclusive
+
+	Sort SortKey // defaults to SortUpdated
+	Desc bool
+
+	// Limit caps the number of items returned; Cursor is Page.Next from
+	// the previous call with the same query.
+	Limit  int
+	Cursor string
 }
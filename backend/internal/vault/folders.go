@@ -0,0 +1,234 @@
+package vault
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+var ErrFolderNotFound = errors.New("vault: folder not found")
+
+// Folder is a node in the folder tree. Folders, like the folder, tags and
+// favorite flag of each item, live in the encrypted KeyDirectory and are
+// never written to the metadata store.
+type Folder struct {
+	ID     string `json:"id"`
+	Name   string `json:"name"`
+	Parent string `json:"parent,omitempty"`
+}
+
+// Organization is where an item is filed. A nil field in an update leaves
+// that part unchanged.
+type Organization struct {
+	Folder   *string  `json:"folder,omitempty"`
+	Tags     []string `json:"tags,omitempty"`
+	Favorite *bool    `json:"favorite,omitempty"`
+}
+
+func (v *vault) CreateFolder(ctx context.Context, name, parent string) (Folder, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if !v.unlocked {
+		return Folder{}, ErrNotUnlocked
+	}
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return Folder{}, errors.New("vault: folder name required")
+	}
+	if parent != "" {
+		if _, ok := v.kd.Folders[parent]; !ok {
+			return Folder{}, fmt.Errorf("%w: %s", ErrFolderNotFound, parent)
+		}
+	}
+	id, err := newShortID()
+	if err != nil {
+		return Folder{}, err
+	}
+	f := Folder{ID: id, Name: name, Parent: parent}
+	if v.kd.Folders == nil {
+		v.kd.Folders = map[string]Folder{}
+	}
+	v.kd.Folders[id] = f
+	return f, v.flushKD()
+}
+
+// ListFolders returns all folders sorted by path.
+func (v *vault) ListFolders(ctx context.Context) ([]Folder, error) {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	if !v.unlocked {
+		return nil, ErrNotUnlocked
+	}
+	out := make([]Folder, 0, len(v.kd.Folders))
+	paths := make(map[string]string, len(v.kd.Folders))
+	for id, f := range v.kd.Folders {
+		out = append(out, f)
+		paths[id] = v.folderPath(id)
+	}
+	sort.Slice(out, func(i, j int) bool { return paths[out[i].ID] < paths[out[j].ID] })
+	return out, nil
+}
+
+// UpdateFolder renames a folder and moves it under parent. An empty name
+// or nil parent keeps the current one; an empty parent moves the folder to
+// the top level.
+func (v *vault) UpdateFolder(ctx context.Context, id, name string, parent *string) (Folder, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if !v.unlocked {
+		return Folder{}, ErrNotUnlocked
+	}
+	f, ok := v.kd.Folders[id]
+	if !ok {
+		return Folder{}, fmt.Errorf("%w: %s", ErrFolderNotFound, id)
+	}
+	if name = strings.TrimSpace(name); name != "" {
+		f.Name = name
+	}
+	if parent != nil {
+		if *parent != "" {
+			if _, ok := v.kd.Folders[*parent]; !ok {
+				return Folder{}, fmt.Errorf("%w: %s", ErrFolderNotFound, *parent)
+			}
+			if v.inFolder(*parent, id, true) {
+				return Folder{}, errors.New("vault: folder cannot be moved into itself")
+			}
+		}
+		f.Parent = *parent
+	}
+	v.kd.Folders[id] = f
+	return f, v.flushKD()
+}
+
+// DeleteFolder removes a folder. Its items and subfolders move up to the
+// folder's parent.
+func (v *vault) DeleteFolder(ctx context.Context, id string) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if !v.unlocked {
+		return ErrNotUnlocked
+	}
+	f, ok := v.kd.Folders[id]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrFolderNotFound, id)
+	}
+	for cid, c := range v.kd.Folders {
+		if c.Parent == id {
+			c.Parent = f.Parent
+			v.kd.Folders[cid] = c
+		}
+	}
+	for iid, ki := range v.kd.Items {
+		if ki.Folder == id {
+			ki.Folder = f.Parent
+			v.kd.Items[iid] = ki
+		}
+	}
+	delete(v.kd.Folders, id)
+	return v.flushKD()
+}
+
+// Organize files an item into a folder and sets its tags and favorite
+// flag. Tags are trimmed, deduplicated and sorted. Organizing does not
+// change the item's version, but a non-zero version must match it, as for
+// UpdateItem.
+func (v *vault) Organize(ctx context.Context, id string, o Organization, version int) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if !v.unlocked {
+		return ErrNotUnlocked
+	}
+	if _, ok := v.kd.Items[id]; !ok {
+		return fmt.Errorf("%w: %s", ErrItemNotFound, id)
+	}
+	if err := v.checkVersion(id, version); err != nil {
+		return err
+	}
+	if err := v.checkOrganization(o); err != nil {
+		return err
+	}
+	v.file(id, o)
+	return v.flushKD()
+}
+
+// checkOrganization reports whether o names a folder that does not exist.
+func (v *vault) checkOrganization(o Organization) error {
+	if o.Folder != nil && *o.Folder != "" {
+		if _, ok := v.kd.Folders[*o.Folder]; !ok {
+			return fmt.Errorf("%w: %s", ErrFolderNotFound, *o.Folder)
+		}
+	}
+	return nil
+}
+
+// file applies a checked o to the key directory entry of id.
+func (v *vault) file(id string, o Organization) {
+	ki := v.kd.Items[id]
+	if o.Folder != nil {
+		ki.Folder = *o.Folder
+	}
+	if o.Tags != nil {
+		ki.Tags = normalizeTags(o.Tags)
+	}
+	if o.Favorite != nil {
+		ki.Favorite = *o.Favorite
+	}
+	v.kd.Items[id] = ki
+}
+
+func (v *vault) folderPath(id string) string {
+	var parts []string
+	for seen := 0; id != "" && seen <= len(v.kd.Folders); seen++ {
+		f, ok := v.kd.Folders[id]
+		if !ok {
+			break
+		}
+		parts = append([]string{f.Name}, parts...)
+		id = f.Parent
+	}
+	return strings.Join(parts, "/")
+}
+
+// inFolder reports whether folder is root or, with sub set, one of its
+// descendants.
+func (v *vault) inFolder(folder, root string, sub bool) bool {
+	if folder == root {
+		return true
+	}
+	if !sub {
+		return false
+	}
+	for seen := 0; folder != "" && seen <= len(v.kd.Folders); seen++ {
+		folder = v.kd.Folders[folder].Parent
+		if folder == root {
+			return true
+		}
+	}
+	return false
+}
+
+func normalizeTags(tags []string) []string {
+	seen := map[string]bool{}
+	out := []string{}
+	for _, t := range tags {
+		t = strings.TrimSpace(t)
+		if t == "" || seen[t] {
+			continue
+		}
+		seen[t] = true
+		out = append(out, t)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// organize copies the item's filing from the KeyDirectory into m.
+func (v *vault) organize(m ItemMeta) ItemMeta {
+	ki := v.kd.Items[m.ID]
+	m.Folder = ki.Folder
+	m.Tags = ki.Tags
+	m.Favorite = ki.Favorite
+	return m
+}
@@ -0,0 +1,111 @@
+package vault
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"errors"
+	"sort"
+	"time"
+
+	cr "project-crypto/internal/crypto"
+	"project-crypto/internal/strength"
+)
+
+// weakScore is the highest strength.Estimate score Health reports as weak.
+const weakScore = 2
+
+// HealthItem identifies an item in a HealthReport. It never carries the
+// password itself.
+type HealthItem struct {
+	ID      string `json:"id"`
+	Type    string `json:"type"`
+	Title   string `json:"title,omitempty"`
+	Updated int64  `json:"updated"`
+
+	Score   int    `json:"score,omitempty"`
+	Warning string `json:"warning,omitempty"`
+	AgeDays int    `json:"age_days,omitempty"`
+}
+
+// HealthReport lists items whose passwords are weak, shared with another
+// item, or older than Policy.PasswordMaxAge.
+type HealthReport struct {
+	Generated int64          `json:"generated"`
+	Checked   int            `json:"checked"`
+	Weak      []HealthItem   `json:"weak"`
+	Reused    [][]HealthItem `json:"reused"`
+	Stale     []HealthItem   `json:"stale"`
+}
+
+// Health decrypts every item password in memory and reports on it.
+// Reuse is found by comparing HMACs under a key derived from the VRK, so
+// no plaintext outlives the item being checked and the grouping keys mean
+// nothing outside this vault.
+func (v *vault) Health(ctx context.Context) (HealthReport, error) {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	if !v.unlocked {
+		return HealthReport{}, ErrNotUnlocked
+	}
+	key, err := cr.DeriveSubkey(v.vrk[:], "vault/health/v1")
+	if err != nil {
+		return HealthReport{}, err
+	}
+	defer cr.Zero(key)
+
+	now := time.Now()
+	report := HealthReport{Generated: now.Unix(), Weak: []HealthItem{}, Reused: [][]HealthItem{}, Stale: []HealthItem{}}
+	maxAge := time.Duration(v.kd.Policy.PasswordMaxAge) * time.Millisecond
+	groups := map[string][]HealthItem{}
+
+	ids := make([]string, 0, len(v.meta))
+	for id, m := range v.meta {
+		if m.Deleted == 0 {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		m := v.meta[id]
+		payload, err := v.openPayload(ctx, id)
+		if errors.Is(err, ErrIntegrity) {
+			return HealthReport{}, err
+		}
+		if err != nil {
+			continue
+		}
+		it := payload.item()
+		pw := it.Fields["password"]
+		if pw == "" {
+			continue
+		}
+		hi := HealthItem{ID: id, Type: m.Type, Title: m.Title, Updated: m.Updated}
+		report.Checked++
+
+		est := strength.Estimate(pw, it.Fields["username"], it.Fields["site"])
+		if est.Score <= weakScore {
+			w := hi
+			w.Score, w.Warning = est.Score, est.Warning
+			report.Weak = append(report.Weak, w)
+		}
+
+		mac := hmac.New(sha256.New, key)
+		mac.Write([]byte(pw))
+		sum := string(mac.Sum(nil))
+		groups[sum] = append(groups[sum], hi)
+
+		if age := now.Sub(time.Unix(m.Updated, 0)); maxAge > 0 && age > maxAge {
+			s := hi
+			s.AgeDays = int(age / (24 * time.Hour))
+			report.Stale = append(report.Stale, s)
+		}
+	}
+	for _, g := range groups {
+		if len(g) > 1 {
+			report.Reused = append(report.Reused, g)
+		}
+	}
+	sort.Slice(report.Reused, func(i, j int) bool { return report.Reused[i][0].ID < report.Reused[j][0].ID })
+	return report, nil
+}
@@ -0,0 +1,169 @@
+package vault
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+type FieldChange struct {
+	Field string `json:"field"`
+	Old   string `json:"old,omitempty"`
+	New   string `json:"new,omitempty"`
+}
+
+func revisionBlobID(id string, version int) string {
+	return id + ".v" + strconv.Itoa(version)
+}
+
+// recordRevision copies the current ciphertext of id aside before it is
+// overwritten. Revisions stay sealed under the item's DEK, so no
+// re-encryption is needed to keep or restore them.
+func (v *vault) recordRevision(ctx context.Context, id string, ki *KDItem) error {
+	max := v.kd.Policy.HistoryMaxRevisions
+	if max < 0 {
+		return nil
+	}
+	cur, ok := v.meta[id]
+	if !ok {
+		return nil
+	}
+	ct, err := v.store.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	if err := v.verifyItemBlob(id, ct); err != nil {
+		return err
+	}
+	sum := sha256.Sum256(ct)
+	if err := v.store.Put(ctx, revisionBlobID(id, cur.Version), ct); err != nil {
+		return err
+	}
+	ki.History = append(ki.History, Revision{
+		Version: cur.Version,
+		Type:    cur.Type,
+		Updated: cur.Updated,
+		Sum:     sum[:],
+	})
+	for len(ki.History) > max {
+		_ = v.store.Delete(ctx, revisionBlobID(id, ki.History[0].Version))
+		ki.History = ki.History[1:]
+	}
+	return nil
+}
+
+func (v *vault) History(ctx context.Context, id string) ([]Revision, error) {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	if !v.unlocked {
+		return nil, ErrNotUnlocked
+	}
+	ki, ok := v.kd.Items[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrItemNotFound, id)
+	}
+	out := append([]Revision(nil), ki.History...)
+	if m, ok := v.meta[id]; ok {
+		out = append(out, Revision{Version: m.Version, Type: m.Type, Updated: m.Updated})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Version > out[j].Version })
+	return out, nil
+}
+
+func (v *vault) GetRevision(ctx context.Context, id string, version int) (Item, error) {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	return v.getRevision(ctx, id, version)
+}
+
+func (v *vault) getRevision(ctx context.Context, id string, version int) (Item, error) {
+	if !v.unlocked {
+		return Item{}, ErrNotUnlocked
+	}
+	ki, ok := v.kd.Items[id]
+	if !ok {
+		return Item{}, fmt.Errorf("%w: %s", ErrItemNotFound, id)
+	}
+	if m, ok := v.meta[id]; ok && m.Version == version {
+		return v.getItem(ctx, id)
+	}
+	var rev *Revision
+	for i := range ki.History {
+		if ki.History[i].Version == version {
+			rev = &ki.History[i]
+			break
+		}
+	}
+	if rev == nil {
+		return Item{}, fmt.Errorf("revision %d not found for item %s", version, id)
+	}
+	payload, err := v.openPayloadBlob(ctx, id, revisionBlobID(id, version), func(ct []byte) error {
+		return verifyRevisionBlob(id, *rev, ct)
+	})
+	if err != nil {
+		return Item{}, err
+	}
+	return payload.item(), nil
+}
+
+// RestoreRevision writes the contents of an older revision as a new
+// version, so the restore itself shows up in the history. Revisions are
+// restored as they were stored, even if written before schemas existed.
+func (v *vault) RestoreRevision(ctx context.Context, id string, version int) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	it, err := v.getRevision(ctx, id, version)
+	if err != nil {
+		return err
+	}
+	return v.updateItem(ctx, id, it)
+}
+
+func Diff(from, to Item) []FieldChange {
+	names := map[string]struct{}{}
+	for k := range from.Fields {
+		names[k] = struct{}{}
+	}
+	for k := range to.Fields {
+		names[k] = struct{}{}
+	}
+	keys := make([]string, 0, len(names))
+	for k := range names {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var out []FieldChange
+	if from.Type != to.Type {
+		out = append(out, FieldChange{Field: "type", Old: from.Type, New: to.Type})
+	}
+	for _, k := range keys {
+		oldVal, inOld := from.Fields[k]
+		newVal, inNew := to.Fields[k]
+		if inOld && inNew && oldVal == newVal {
+			continue
+		}
+		out = append(out, FieldChange{Field: "fields." + k, Old: oldVal, New: newVal})
+	}
+
+	oldCustom := map[string]CustomField{}
+	for _, f := range from.Custom {
+		oldCustom[f.Name] = f
+	}
+	for _, f := range to.Custom {
+		prev, ok := oldCustom[f.Name]
+		delete(oldCustom, f.Name)
+		if ok && prev == f {
+			continue
+		}
+		out = append(out, FieldChange{Field: "custom." + f.Name, Old: prev.Value, New: f.Value})
+	}
+	for _, f := range from.Custom {
+		if _, removed := oldCustom[f.Name]; removed {
+			out = append(out, FieldChange{Field: "custom." + f.Name, Old: f.Value})
+		}
+	}
+	return out
+}
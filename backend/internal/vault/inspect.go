@@ -0,0 +1,76 @@
+package vault
+
+import (
+	"bytes"
+	"os"
+)
+
+type SectionInfo struct {
+	ID     uint16 `json:"id"`
+	Name   string `json:"name"`
+	Offset uint32 `json:"offset"`
+	Length uint32 `json:"length"`
+}
+
+type KDFInfo struct {
+	Algo    string `json:"algo"`
+	M       uint32 `json:"m"`
+	T       uint32 `json:"t"`
+	P       uint8  `json:"p"`
+	SaltLen int    `json:"salt_len"`
+}
+
+// HeaderInfo is the non-secret structure of a vault file. Ciphertexts are
+// reported by length only.
+type HeaderInfo struct {
+	Path           string        `json:"path"`
+	Size           int           `json:"size"`
+	Encoding       string        `json:"encoding"`
+	Version        int           `json:"version"`
+	KDF            KDFInfo       `json:"kdf"`
+	VRKWrapLen     int           `json:"vrk_wrap_len"`
+	KDCipherLen    int           `json:"kd_cipher_len"`
+	PaddingLen     int           `json:"padding_len"`
+	Sections       []SectionInfo `json:"sections,omitempty"`
+	PendingJournal bool          `json:"pending_journal"`
+}
+
+// Inspect reads the vault file at path without unlocking it.
+func Inspect(path string) (HeaderInfo, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return HeaderInfo{}, err
+	}
+	h, err := decodeHeader(b)
+	if err != nil {
+		return HeaderInfo{}, err
+	}
+	info := HeaderInfo{
+		Path:        path,
+		Size:        len(b),
+		Encoding:    "json",
+		Version:     h.Version,
+		KDF:         KDFInfo{Algo: h.KDF.Algo, M: h.KDF.M, T: h.KDF.T, P: h.KDF.P, SaltLen: len(h.KDF.Salt)},
+		VRKWrapLen:  len(h.VRKWrap),
+		KDCipherLen: len(h.KDCipher),
+		PaddingLen:  len(h.Padding),
+	}
+	if bytes.HasPrefix(b, containerMagic) {
+		info.Encoding = "container"
+		_, sections, err := readSectionTable(b)
+		if err != nil {
+			return HeaderInfo{}, err
+		}
+		for _, s := range sections {
+			name := sectionNames[s.ID]
+			if name == "" {
+				name = "unknown"
+			}
+			info.Sections = append(info.Sections, SectionInfo{ID: s.ID, Name: name, Offset: s.Offset, Length: s.Length})
+		}
+	}
+	if _, err := os.Stat(journalPath(path)); err == nil {
+		info.PendingJournal = true
+	}
+	return info, nil
+}
@@ -12,27 +12,77 @@ import (
 )
 
 func (v *vault) AddItem(ctx context.Context, item Item) (string, error) {
+	ids, err := v.AddItems(ctx, []NewItem{{Item: item}})
+	if err != nil {
+		return "", err
+	}
+	return ids[0], nil
+}
+
+// NewItem is an item to add together with where it is filed.
+type NewItem struct {
+	Item
+	Organization
+}
+
+// AddItems adds items and files them. Every item and its organization is
+// validated before anything is written, and the key directory is flushed
+// once for the whole batch. If writing an item fails, the ids of the items
+// added before it are returned with the error.
+func (v *vault) AddItems(ctx context.Context, items []NewItem) ([]string, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
 	if !v.unlocked {
-		return "", ErrNotUnlocked
+		return nil, ErrNotUnlocked
+	}
+	if v.store == nil {
+		return nil, fmt.Errorf("no blob store configured")
 	}
+	valid := make([]Item, len(items))
+	for i, n := range items {
+		it, err := ValidateItem(n.Item)
+		if err != nil {
+			return nil, err
+		}
+		if err := v.checkOrganization(n.Organization); err != nil {
+			return nil, err
+		}
+		valid[i] = it
+	}
+	ids := make([]string, 0, len(items))
+	for i, it := range valid {
+		id, err := v.addItem(ctx, it)
+		if err != nil {
+			if len(ids) > 0 {
+				if ferr := v.flushKD(); ferr != nil {
+					return nil, ferr
+				}
+			}
+			return ids, err
+		}
+		v.file(id, items[i].Organization)
+		ids = append(ids, id)
+	}
+	return ids, v.flushKD()
+}
+
+// addItem writes a validated item and adds it to the key directory and
+// index. The caller flushes the key directory.
+func (v *vault) addItem(ctx context.Context, item Item) (string, error) {
 	dek := make([]byte, 32)
 	_, _ = rand.Read(dek)
 	defer cr.Zero(dek)
 
-	payload := struct {
-		Type    string            `json:"type"`
-		Fields  map[string]string `json:"fields"`
-		Created int64             `json:"created"`
-		Updated int64             `json:"updated"`
-		Version int               `json:"version"`
-	}{
+	payload := itemPayload{
 		Type:    item.Type,
 		Fields:  item.Fields,
+		Custom:  item.Custom,
 		Created: time.Now().Unix(),
 		Updated: time.Now().Unix(),
 		Version: 1,
 	}
 	pt, _ := json.Marshal(payload)
+	pt = pad(pt, v.kd.Policy.PadBucket)
 
 	id := v.newID()
 	aad := []byte(fmt.Sprintf("item:%s", id))
@@ -45,77 +95,136 @@ func (v *vault) AddItem(ctx context.Context, item Item) (string, error) {
 		return "", err
 	}
 
-	v.kd.Items[id] = KDItem{DekWrap: dekWrap}
-
-	if v.store == nil {
-		return "", fmt.Errorf("no blob store configured")
-	}
 	if err := v.store.Put(ctx, id, ct); err != nil {
 		return "", err
 	}
+	ki := KDItem{DekWrap: dekWrap}
+	v.stampItem(&ki, id, item.Type, payload.Version, ct)
+	v.kd.Items[id] = ki
 
-	m := ItemMeta{
+	v.putMeta(ctx, ItemMeta{
 		ID:      id,
 		Type:    item.Type,
+		Title:   itemTitle(item),
 		Created: payload.Created,
 		Updated: payload.Updated,
 		Version: payload.Version,
-	}
-	v.meta[id] = m
-
-	if v.metaStore != nil {
-		_ = v.metaStore.PutMeta(ctx, storage.ItemMeta{
-			ID:      m.ID,
-			Type:    m.Type,
-			Created: m.Created,
-			Updated: m.Updated,
-			Version: m.Version,
-		})
-	}
-
-	return id, v.flushKD()
+	})
+	return id, nil
 }
 
 func (v *vault) GetItem(ctx context.Context, id string) (Item, error) {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	return v.getItem(ctx, id)
+}
+
+func (v *vault) getItem(ctx context.Context, id string) (Item, error) {
 	if !v.unlocked {
 		return Item{}, ErrNotUnlocked
 	}
+	payload, err := v.openPayload(ctx, id)
+	if err != nil {
+		return Item{}, err
+	}
+	return payload.item(), nil
+}
+
+type itemPayload struct {
+	Type    string            `json:"type"`
+	Fields  map[string]string `json:"fields"`
+	Custom  []CustomField     `json:"custom,omitempty"`
+	Created int64             `json:"created"`
+	Updated int64             `json:"updated"`
+	Version int               `json:"version"`
+}
+
+func (p itemPayload) item() Item {
+	return Item{Type: p.Type, Fields: p.Fields, Custom: p.Custom, Version: p.Version}
+}
+
+func (v *vault) openPayload(ctx context.Context, id string) (itemPayload, error) {
+	return v.openPayloadBlob(ctx, id, id, func(ct []byte) error {
+		return v.verifyItemBlob(id, ct)
+	})
+}
+
+func (v *vault) openPayloadBlob(ctx context.Context, id, blobID string, verify func(ct []byte) error) (itemPayload, error) {
+	var payload itemPayload
 	ki, ok := v.kd.Items[id]
 	if !ok {
-		return Item{}, fmt.Errorf("item not found: %s", id)
+		return payload, fmt.Errorf("%w: %s", ErrItemNotFound, id)
 	}
 	dek, err := cr.OpenAny(v.vrk[:], ki.DekWrap, []byte("dek-wrap:"+id))
 	if err != nil {
-		return Item{}, err
+		return payload, err
 	}
 	defer cr.Zero(dek)
 
-	ct, err := v.store.Get(ctx, id)
+	ct, err := v.store.Get(ctx, blobID)
 	if err != nil {
-		return Item{}, err
+		return payload, err
+	}
+	if err := verify(ct); err != nil {
+		return payload, err
 	}
 	aad := []byte("item:" + id)
 	pt, err := cr.OpenAny(v.dekKey(dek), ct, aad)
 	if err != nil {
-		return Item{}, err
+		return payload, err
 	}
-	var payload struct {
-		Type   string            `json:"type"`
-		Fields map[string]string `json:"fields"`
+	defer cr.Zero(pt)
+	body, err := unpad(pt)
+	if err != nil {
+		return payload, err
 	}
-	if err := json.Unmarshal(pt, &payload); err != nil {
-		return Item{}, err
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return payload, err
 	}
-	return Item{Type: payload.Type, Fields: payload.Fields}, nil
+	return payload, nil
 }
 
+// UpdateItem replaces the contents of id. An empty upd.Type keeps the
+// item's current type and nil upd.Custom keeps its custom fields; pass an
+// empty slice to remove them. A non-zero upd.Version is the version the
+// caller read: if the item has moved on since, ErrConflict is returned and
+// nothing is written.
 func (v *vault) UpdateItem(ctx context.Context, id string, upd Item) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
 	if !v.unlocked {
 		return ErrNotUnlocked
 	}
+	if _, ok := v.kd.Items[id]; !ok {
+		return fmt.Errorf("%w: %s", ErrItemNotFound, id)
+	}
+	if err := v.checkVersion(id, upd.Version); err != nil {
+		return err
+	}
+	if upd.Type == "" {
+		upd.Type = v.meta[id].Type
+	}
+	cur, err := v.openPayload(ctx, id)
+	if err != nil {
+		return err
+	}
+	if upd.Custom == nil {
+		upd.Custom = cur.Custom
+	}
+	upd, err = validateItem(upd, cur.Fields)
+	if err != nil {
+		return err
+	}
+	return v.updateItem(ctx, id, upd)
+}
+
+func (v *vault) updateItem(ctx context.Context, id string, upd Item) error {
 	ki, ok := v.kd.Items[id]
 	if !ok {
-		return fmt.Errorf("item not found: %s", id)
+		return fmt.Errorf("%w: %s", ErrItemNotFound, id)
+	}
+	if v.meta[id].Deleted != 0 {
+		return fmt.Errorf("%w: %s", ErrInTrash, id)
 	}
 	dek, err := cr.OpenAny(v.vrk[:], ki.DekWrap, []byte("dek-wrap:"+id))
 	if err != nil {
@@ -123,44 +232,91 @@ func (v *vault) UpdateItem(ctx context.Context, id string, upd Item) error {
 	}
 	defer cr.Zero(dek)
 
-	payload := struct {
-		Type    string            `json:"type"`
-		Fields  map[string]string `json:"fields"`
-		Created int64             `json:"created"`
-		Updated int64             `json:"updated"`
-		Version int               `json:"version"`
-	}{
+	payload := itemPayload{
 		Type:    upd.Type,
 		Fields:  upd.Fields,
+		Custom:  upd.Custom,
 		Created: v.meta[id].Created,
 		Updated: time.Now().Unix(),
 		Version: v.meta[id].Version + 1,
 	}
 	pt, _ := json.Marshal(payload)
+	pt = pad(pt, v.kd.Policy.PadBucket)
 	aad := []byte("item:" + id)
 	ct, err := cr.Seal(v.dekKey(dek), pt, aad)
 	if err != nil {
 		return err
 	}
+	if err := v.recordRevision(ctx, id, &ki); err != nil {
+		return err
+	}
 	if err := v.store.Put(ctx, id, ct); err != nil {
 		return err
 	}
-	v.meta[id] = ItemMeta{
+	v.stampItem(&ki, id, upd.Type, payload.Version, ct)
+	v.kd.Items[id] = ki
+	v.putMeta(ctx, ItemMeta{
 		ID:      id,
 		Type:    upd.Type,
+		Title:   itemTitle(upd),
 		Created: payload.Created,
 		Updated: payload.Updated,
 		Version: payload.Version,
+	})
+	return v.flushKD()
+}
+
+// rewriteItem seals payload in place of the current blob of id. Unlike
+// updateItem it records no revision and keeps the version and timestamps,
+// for bookkeeping that is not an edit of the item, such as advancing an
+// HOTP counter.
+func (v *vault) rewriteItem(ctx context.Context, id string, payload itemPayload) error {
+	ki, ok := v.kd.Items[id]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrItemNotFound, id)
+	}
+	if v.meta[id].Deleted != 0 {
+		return fmt.Errorf("%w: %s", ErrInTrash, id)
+	}
+	dek, err := cr.OpenAny(v.vrk[:], ki.DekWrap, []byte("dek-wrap:"+id))
+	if err != nil {
+		return err
 	}
+	defer cr.Zero(dek)
 
+	pt, _ := json.Marshal(payload)
+	pt = pad(pt, v.kd.Policy.PadBucket)
+	ct, err := cr.Seal(v.dekKey(dek), pt, []byte("item:"+id))
+	if err != nil {
+		return err
+	}
+	if err := v.store.Put(ctx, id, ct); err != nil {
+		return err
+	}
+	v.stampItem(&ki, id, payload.Type, payload.Version, ct)
+	v.kd.Items[id] = ki
+	return v.flushKD()
+}
+
+// checkVersion returns ErrConflict unless version is zero or the current
+// version of id.
+func (v *vault) checkVersion(id string, version int) error {
+	if cur := v.meta[id].Version; version != 0 && version != cur {
+		return fmt.Errorf("%w: %s is at version %d, not %d", ErrConflict, id, cur, version)
+	}
+	return nil
+}
+
+func (v *vault) putMeta(ctx context.Context, m ItemMeta) {
+	v.meta[m.ID] = m
 	if v.metaStore != nil {
 		_ = v.metaStore.PutMeta(ctx, storage.ItemMeta{
-			ID:      id,
-			Type:    upd.Type,
-			Created: payload.Created,
-			Updated: payload.Updated,
-			Version: payload.Version,
+			ID:      m.ID,
+			Type:    m.Type,
+			Created: m.Created,
+			Updated: m.Updated,
+			Version: m.Version,
+			Deleted: m.Deleted,
 		})
 	}
-	return v.flushKD()
 }
@@ -0,0 +1,112 @@
+package vault
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"os"
+	"path/filepath"
+)
+
+// Header writes go through a write-ahead journal next to the vault file:
+// the complete new header is written and synced to <path>.journal, then
+// swapped in with temp file + fsync + rename, and the journal is removed.
+// A crash leaves either a torn journal, which fails its checksum and is
+// dropped, or a complete one, which Unlock replays over the header.
+
+// renameFile is swapped out by tests to simulate a crash between the
+// journal write and the header replace.
+var renameFile = os.Rename
+
+type headerJournal struct {
+	Sum    []byte `json:"sum"`
+	Header []byte `json:"header"`
+}
+
+func journalPath(path string) string { return path + ".journal" }
+
+func writeJournal(path string, header []byte) error {
+	sum := sha256.Sum256(header)
+	b, err := json.Marshal(headerJournal{Sum: sum[:], Header: header})
+	if err != nil {
+		return err
+	}
+	if err := writeSynced(journalPath(path), b); err != nil {
+		_ = os.Remove(journalPath(path))
+		return err
+	}
+	return syncDir(path)
+}
+
+// recoverHeader finishes or discards a header write interrupted by a
+// crash. It reports whether the journal was replayed.
+func recoverHeader(path string) (bool, error) {
+	_ = os.Remove(path + ".tmp")
+	b, err := os.ReadFile(journalPath(path))
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	var j headerJournal
+	if err := json.Unmarshal(b, &j); err != nil || !journalIntact(j) {
+		return false, os.Remove(journalPath(path))
+	}
+	if cur, err := os.ReadFile(path); err == nil && bytes.Equal(cur, j.Header) {
+		return false, os.Remove(journalPath(path))
+	}
+	if err := writeFileAtomic(path, j.Header); err != nil {
+		return false, err
+	}
+	return true, os.Remove(journalPath(path))
+}
+
+func journalIntact(j headerJournal) bool {
+	sum := sha256.Sum256(j.Header)
+	if !bytes.Equal(sum[:], j.Sum) {
+		return false
+	}
+	_, err := decodeHeader(j.Header)
+	return err == nil
+}
+
+func writeFileAtomic(path string, b []byte) error {
+	tmp := path + ".tmp"
+	if err := writeSynced(tmp, b); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	if err := renameFile(tmp, path); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	return syncDir(path)
+}
+
+func writeSynced(path string, b []byte) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// syncDir makes a rename or create durable. Directories cannot be synced
+// on every platform, so failures to open or sync are not reported.
+func syncDir(path string) error {
+	d, err := os.Open(filepath.Dir(path))
+	if err != nil {
+		return nil
+	}
+	_ = d.Sync()
+	return d.Close()
+}
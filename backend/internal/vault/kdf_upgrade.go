@@ -0,0 +1,59 @@
+package vault
+
+import (
+	"fmt"
+
+	cr "project-crypto/internal/crypto"
+)
+
+type UnlockReport struct {
+	Recovered    bool      `json:"recovered"`
+	MigratedFrom int       `json:"migrated_from,omitempty"`
+	KDFUpgraded  bool      `json:"kdf_upgraded"`
+	OldKDF       KDFHeader `json:"old_kdf"`
+	NewKDF       KDFHeader `json:"new_kdf"`
+	// SkippedItems lists items a migration could not convert; they are
+	// kept as they were.
+	SkippedItems []string `json:"skipped_items,omitempty"`
+}
+
+func kdfWeakerThan(h KDFHeader, p Policy) bool {
+	return h.M < p.RehashTargetM || h.T < p.RehashTargetT || h.P < p.RehashTargetP
+}
+
+// upgradeKDF re-wraps the VRK under a KEK derived with the policy's
+// Argon2id targets when the header was written with weaker parameters.
+// Parameters are only ever raised; the new header is written in a single
+// write and only adopted in memory once that write succeeded.
+func (v *vault) upgradeKDF(master []byte) error {
+	p := v.kd.Policy
+	old := v.header.KDF
+	if !kdfWeakerThan(old, p) {
+		return nil
+	}
+
+	params := defaultKDF()
+	params.M, params.T, params.P = max(old.M, p.RehashTargetM), max(old.T, p.RehashTargetT), max(old.P, p.RehashTargetP)
+	kek := cr.DeriveKEK(master, params)
+	defer zero32(&kek)
+
+	vrkWrap, err := cr.Seal(kek[:], v.vrk[:], []byte("vrk-wrap"))
+	if err != nil {
+		return err
+	}
+	h := v.header
+	h.KDF = KDFHeader{Algo: "argon2id", M: params.M, T: params.T, P: params.P, Salt: params.Salt}
+	h.VRKWrap = vrkWrap
+	if err := writeHeader(v.path, h); err != nil {
+		return err
+	}
+
+	v.header = h
+	v.kek = kek
+	v.report.KDFUpgraded = true
+	v.report.OldKDF = old
+	v.report.NewKDF = h.KDF
+	v.audit.Append(fmt.Sprintf("kdf-upgrade m=%d,t=%d,p=%d -> m=%d,t=%d,p=%d",
+		old.M, old.T, old.P, h.KDF.M, h.KDF.T, h.KDF.P))
+	return nil
+}
@@ -0,0 +1,322 @@
+package vault
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+
+	cr "project-crypto/internal/crypto"
+)
+
+// A migration upgrades an unlocked vault from the format version it is
+// registered under to the next one. Migrations change the key directory
+// in memory; migrate writes the header once all of them have run. One that
+// must also move blobs writes the copies first and flushes the key
+// directory itself, so that an interrupted run can simply be repeated.
+//
+// A migration that returns errMigrationIncomplete has saved what it could;
+// the vault stays at its version so the next unlock runs it again.
+type migration func(ctx context.Context, v *vault) error
+
+var errMigrationIncomplete = errors.New("vault: migration incomplete")
+
+var migrations = map[int]migration{
+	formatVersionJSON:         migrateToContainer,
+	formatVersionTimestampIDs: migrateItemIDs,
+}
+
+func (v *vault) migrate(ctx context.Context) error {
+	from := v.header.Version
+	if from == formatVersion {
+		return nil
+	}
+	if from > formatVersion {
+		return fmt.Errorf("vault: format version %d is newer than this build supports", from)
+	}
+	for v.header.Version < formatVersion {
+		m, ok := migrations[v.header.Version]
+		if !ok {
+			return fmt.Errorf("vault: no migration from format version %d", v.header.Version)
+		}
+		err := m(ctx, v)
+		if errors.Is(err, errMigrationIncomplete) {
+			break
+		}
+		if err != nil {
+			// Formatted with %v: the cause is often a decode error from a
+			// single blob and must not read as a corrupt vault to callers.
+			return fmt.Errorf("migrate from format version %d: %v", v.header.Version, err)
+		}
+		v.header.Version++
+	}
+	if err := v.flushKD(); err != nil {
+		return err
+	}
+	if v.header.Version == from {
+		return nil
+	}
+	v.report.MigratedFrom = from
+	v.audit.Append(fmt.Sprintf("migrate v%d -> v%d", from, v.header.Version))
+	return nil
+}
+
+// migrateToContainer moves a JSON header into the binary container. The
+// header fields are unchanged, so bumping the version is enough for the
+// next write to use the new encoding.
+func migrateToContainer(ctx context.Context, v *vault) error {
+	return nil
+}
+
+// isLegacyID reports whether id is a creation timestamp in nanoseconds, as
+// item ids were before format version 4.
+func isLegacyID(id string) bool {
+	if id == "" {
+		return false
+	}
+	for _, c := range id {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// migrateItemIDs gives every item with a timestamp id a random one. The
+// item's DEK stays the same, but it is wrapped again and every blob of the
+// item is sealed again, because the id is part of their AADs. Copies under
+// the new ids are written first; the old blobs and metadata documents are
+// removed only once the key directory points at the copies. A run that is
+// interrupted before then leaves unreferenced copies behind and starts
+// over with fresh ids. An item that cannot be read keeps its legacy id and
+// is reported in UnlockReport.SkippedItems, so that one damaged blob does
+// not keep the whole vault locked; the vault then stays at version 3 and
+// the next unlock retries those items.
+func migrateItemIDs(ctx context.Context, v *vault) error {
+	v.dropStale(ctx)
+	if v.kd.Rekey != nil {
+		// A rekey in progress keys its state by the old ids.
+		if err := v.rekey(ctx); err != nil {
+			return err
+		}
+	}
+	var legacy []string
+	for id := range v.kd.Items {
+		if isLegacyID(id) {
+			legacy = append(legacy, id)
+		}
+	}
+	if len(legacy) == 0 {
+		return nil
+	}
+	if v.store == nil {
+		return fmt.Errorf("no blob store configured")
+	}
+	sort.Strings(legacy)
+
+	stale := &StaleState{}
+	skipped := 0
+	for _, old := range legacy {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		id := v.newID()
+		blobs, err := v.renameItem(ctx, old, id)
+		if err != nil {
+			v.report.SkippedItems = append(v.report.SkippedItems, old)
+			v.audit.Append(fmt.Sprintf("migrate skip item=%s: %v", old, err))
+			skipped++
+			continue
+		}
+		stale.Blobs = append(stale.Blobs, blobs...)
+		stale.Meta = append(stale.Meta, old)
+	}
+	if len(stale.Meta) > 0 {
+		v.kd.Stale = stale
+		if err := v.flushKD(); err != nil {
+			return err
+		}
+		v.dropStale(ctx)
+		v.audit.Append(fmt.Sprintf("migrate ids=%d", len(stale.Meta)))
+	}
+	if skipped > 0 {
+		return errMigrationIncomplete
+	}
+	return nil
+}
+
+// dropStale deletes what kd.Stale lists. Deletes are best effort and may
+// repeat; the list is cleared in memory and goes with the next flush.
+func (v *vault) dropStale(ctx context.Context) {
+	if v.kd.Stale == nil {
+		return
+	}
+	if v.store != nil {
+		for _, blobID := range v.kd.Stale.Blobs {
+			_ = v.store.Delete(ctx, blobID)
+		}
+	}
+	if v.metaStore != nil {
+		for _, id := range v.kd.Stale.Meta {
+			_ = v.metaStore.DeleteMeta(ctx, id)
+		}
+	}
+	v.kd.Stale = nil
+}
+
+// renameItem copies the blobs of old to id, sealed for the new id, and
+// moves its key directory and index entries. It returns the blob ids
+// left to delete. On failure the key directory is left untouched and the
+// copies written so far are removed.
+func (v *vault) renameItem(ctx context.Context, old, id string) (_ []string, err error) {
+	ki := v.kd.Items[old]
+	var written []string
+	defer func() {
+		if err != nil {
+			for _, blobID := range written {
+				_ = v.store.Delete(ctx, blobID)
+			}
+		}
+	}()
+	dek, err := cr.OpenAny(v.vrk[:], ki.DekWrap, []byte("dek-wrap:"+old))
+	if err != nil {
+		return nil, err
+	}
+	defer cr.Zero(dek)
+
+	ct, err := v.store.Get(ctx, old)
+	if err != nil {
+		return nil, err
+	}
+	if err := v.verifyItemBlob(old, ct); err != nil {
+		return nil, err
+	}
+	pt, err := cr.OpenAny(v.dekKey(dek), ct, []byte("item:"+old))
+	if err != nil {
+		return nil, err
+	}
+	defer cr.Zero(pt)
+	var payload itemPayload
+	body, err := unpad(pt)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, err
+	}
+	nct, err := cr.Seal(v.dekKey(dek), pt, []byte("item:"+id))
+	if err != nil {
+		return nil, err
+	}
+	if err := v.store.Put(ctx, id, nct); err != nil {
+		return nil, err
+	}
+	written = append(written, id)
+	stale := []string{old}
+
+	next := ki
+	if next.DekWrap, err = cr.Seal(v.vrk[:], dek, []byte("dek-wrap:"+id)); err != nil {
+		return nil, err
+	}
+	stampItem(v.vrk[:], &next, id, payload.Type, payload.Version, nct)
+
+	next.History = make([]Revision, len(ki.History))
+	for i, rev := range ki.History {
+		from, to := revisionBlobID(old, rev.Version), revisionBlobID(id, rev.Version)
+		rct, err := v.resealBlob(ctx, from, to, dek, []byte("item:"+old), []byte("item:"+id), false, func(ct []byte) error {
+			return verifyRevisionBlob(old, rev, ct)
+		})
+		if err != nil {
+			return nil, err
+		}
+		written = append(written, to)
+		sum := sha256.Sum256(rct)
+		rev.Sum = sum[:]
+		next.History[i] = rev
+		stale = append(stale, from)
+	}
+
+	if len(ki.Attachments) > 0 {
+		next.Attachments = make(map[string]Attachment, len(ki.Attachments))
+	}
+	for attID, a := range ki.Attachments {
+		adek, err := cr.OpenAny(v.vrk[:], a.DekWrap, attachmentWrapAAD(old, attID))
+		if err != nil {
+			return nil, err
+		}
+		from, to := attachmentBlobID(old, attID), attachmentBlobID(id, attID)
+		act, err := v.resealBlob(ctx, from, to, adek, attachmentAAD(old, attID), attachmentAAD(id, attID), a.Chunked, func(ct []byte) error {
+			return verifyAttachmentBlob(old, a, ct)
+		})
+		if err == nil {
+			written = append(written, to)
+			a.DekWrap, err = cr.Seal(v.vrk[:], adek, attachmentWrapAAD(id, attID))
+		}
+		cr.Zero(adek)
+		if err != nil {
+			return nil, err
+		}
+		sum := sha256.Sum256(act)
+		a.Sum = sum[:]
+		next.Attachments[attID] = a
+		stale = append(stale, from)
+	}
+
+	delete(v.kd.Items, old)
+	v.kd.Items[id] = next
+	if m, ok := v.meta[old]; ok {
+		delete(v.meta, old)
+		m.ID = id
+		v.putMeta(ctx, m)
+	}
+	return stale, nil
+}
+
+// resealBlob decrypts blob from under fromAAD and stores it as blob to,
+// sealed with the same key under toAAD. It returns the new ciphertext.
+func (v *vault) resealBlob(ctx context.Context, from, to string, dek, fromAAD, toAAD []byte, chunked bool, verify func(ct []byte) error) ([]byte, error) {
+	ct, err := v.store.Get(ctx, from)
+	if err != nil {
+		return nil, err
+	}
+	if err := verify(ct); err != nil {
+		return nil, err
+	}
+	var nct []byte
+	if chunked {
+		sr, err := cr.NewStreamReader(bytes.NewReader(ct), v.dekKey(dek), fromAAD)
+		if err != nil {
+			return nil, err
+		}
+		var buf bytes.Buffer
+		sw, err := cr.NewStreamWriter(&buf, v.dekKey(dek), toAAD)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := io.Copy(sw, sr); err != nil {
+			return nil, err
+		}
+		if err := sw.Close(); err != nil {
+			return nil, err
+		}
+		nct = buf.Bytes()
+	} else {
+		pt, err := cr.OpenAny(v.dekKey(dek), ct, fromAAD)
+		if err != nil {
+			return nil, err
+		}
+		nct, err = cr.Seal(v.dekKey(dek), pt, toAAD)
+		cr.Zero(pt)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := v.store.Put(ctx, to, nct); err != nil {
+		return nil, err
+	}
+	return nct, nil
+}
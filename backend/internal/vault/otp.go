@@ -0,0 +1,111 @@
+package vault
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"project-crypto/internal/totp"
+)
+
+var (
+	ErrNoOTP = errors.New("vault: item has no one-time code secret")
+	// ErrOTPAdvance is returned for an HOTP seed when the caller did not
+	// ask to advance its counter.
+	ErrOTPAdvance = errors.New("vault: HOTP codes advance the counter and must be requested explicitly")
+)
+
+// otpField is the schema field that holds a one-time code seed.
+const otpField = "totp"
+
+// OTPCode is a one-time code generated from a seed stored in an item.
+type OTPCode struct {
+	Code      string         `json:"code"`
+	Type      string         `json:"type"`
+	Algorithm totp.Algorithm `json:"algorithm"`
+	Digits    int            `json:"digits"`
+	Period    int            `json:"period,omitempty"`
+	Remaining int            `json:"remaining,omitempty"` // seconds, TOTP only
+	Counter   uint64         `json:"counter,omitempty"`   // HOTP only
+}
+
+// OTP generates the current code for the seed in field, which names the
+// "totp" schema field or a custom field of kind totp. An empty field picks
+// the "totp" field, then the first custom field of kind totp. Items in the
+// trash have no codes.
+//
+// For HOTP seeds the code is for the stored counter, and the item is
+// rewritten with the counter advanced so the same code is never handed
+// out twice. That only happens when advance is set; otherwise
+// ErrOTPAdvance is returned. Advancing the counter is not an edit: it adds
+// no revision and leaves the item's version and timestamps alone.
+func (v *vault) OTP(ctx context.Context, id, field string, advance bool) (OTPCode, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if !v.unlocked {
+		return OTPCode{}, ErrNotUnlocked
+	}
+	if v.meta[id].Deleted != 0 {
+		return OTPCode{}, fmt.Errorf("%w: %s", ErrInTrash, id)
+	}
+	payload, err := v.openPayload(ctx, id)
+	if err != nil {
+		return OTPCode{}, err
+	}
+	it := payload.item()
+	seed, set := otpSeed(&it, field)
+	if seed == "" {
+		return OTPCode{}, fmt.Errorf("%w: %s", ErrNoOTP, id)
+	}
+	key, err := totp.ParseKey(seed)
+	if err != nil {
+		return OTPCode{}, err
+	}
+	if key.Type == totp.TypeHOTP && !advance {
+		return OTPCode{}, ErrOTPAdvance
+	}
+	now := time.Now()
+	code, err := key.Code(now)
+	if err != nil {
+		return OTPCode{}, err
+	}
+	out := OTPCode{
+		Code:      code,
+		Type:      key.Type,
+		Algorithm: key.Algorithm,
+		Digits:    key.Digits,
+		Period:    key.Period,
+		Remaining: int(key.Remaining(now) / time.Second),
+		Counter:   key.Counter,
+	}
+	if key.Type == totp.TypeHOTP {
+		key.Counter++
+		set(key.URI())
+		payload.Fields, payload.Custom = it.Fields, it.Custom
+		if err := v.rewriteItem(ctx, id, payload); err != nil {
+			return OTPCode{}, err
+		}
+	}
+	return out, nil
+}
+
+// otpSeed finds the seed for field in it and returns it with a setter
+// that replaces it in place. Only the "totp" schema field and custom
+// fields of kind totp hold seeds.
+func otpSeed(it *Item, field string) (string, func(string)) {
+	if field == "" || field == otpField {
+		if s := it.Fields[otpField]; s != "" {
+			return s, func(s string) { it.Fields[otpField] = s }
+		}
+	}
+	for i, f := range it.Custom {
+		if f.Kind != KindTOTP || f.Value == "" {
+			continue
+		}
+		if field == "" || f.Name == field {
+			return f.Value, func(s string) { it.Custom[i].Value = s }
+		}
+	}
+	return "", nil
+}
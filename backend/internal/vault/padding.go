@@ -0,0 +1,71 @@
+package vault
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// Plaintexts are padded before sealing so ciphertext lengths only reveal
+// a size bucket. A padded plaintext is
+//
+//	padMarker | content length u32 | content | zero fill
+//
+// and is rounded up to a multiple of Policy.PadBucket. Unpadded payloads
+// written by older builds are JSON objects and always start with '{', so
+// unpad passes them through unchanged.
+
+const padMarker = 0x01
+
+var errBadPadding = errors.New("vault: bad padding")
+
+func padBucketLen(n, bucket int) int {
+	if bucket <= 0 {
+		return n
+	}
+	return (n + bucket - 1) / bucket * bucket
+}
+
+func pad(pt []byte, bucket int) []byte {
+	if bucket <= 0 {
+		return pt
+	}
+	out := make([]byte, padBucketLen(5+len(pt), bucket))
+	out[0] = padMarker
+	binary.BigEndian.PutUint32(out[1:5], uint32(len(pt)))
+	copy(out[5:], pt)
+	return out
+}
+
+func unpad(pt []byte) ([]byte, error) {
+	if len(pt) == 0 || pt[0] != padMarker {
+		return pt, nil
+	}
+	if len(pt) < 5 {
+		return nil, errBadPadding
+	}
+	n := binary.BigEndian.Uint32(pt[1:5])
+	if uint64(n) > uint64(len(pt)-5) {
+		return nil, errBadPadding
+	}
+	return pt[5 : 5+n], nil
+}
+
+// headerPadding returns filler that brings the encoded header to a
+// multiple of bucket bytes. JSON headers are left alone; they are
+// migrated to the container on the first unlock.
+func headerPadding(h Header, bucket int) ([]byte, error) {
+	if bucket <= 0 || h.Version <= formatVersionJSON {
+		return nil, nil
+	}
+	h.Padding = nil
+	b, err := encodeHeader(h)
+	if err != nil {
+		return nil, err
+	}
+	n := len(b) + sectionEntryLen
+	fill := padBucketLen(n, bucket) - n
+	if fill == 0 {
+		fill = bucket
+	}
+	return make([]byte, fill), nil
+}
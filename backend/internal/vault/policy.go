@@ -6,6 +6,16 @@ type Policy struct {
 	RehashTargetM    uint32 `json:"rehash_target_m"`
 	RehashTargetT    uint32 `json:"rehash_target_t"`
 	RehashTargetP    uint8  `json:"rehash_target_p"`
+
+	HistoryMaxRevisions int   `json:"history_max_revisions"`
+	TrashRetention      int64 `json:"trash_retention_ms"`
+	MaxUnlocked         int64 `json:"max_unlocked_ms"`
+	PadBucket           int   `json:"pad_bucket"`
+
+	MaxAttachmentSize      int64 `json:"max_attachment_bytes"`
+	MaxItemAttachmentBytes int64 `json:"max_item_attachment_bytes"`
+
+	PasswordMaxAge int64 `json:"password_max_age_ms"`
 }
 
 func DefaultPolicy() Policy {
@@ -15,5 +25,63 @@ func DefaultPolicy() Policy {
 		RehashTargetM:    1024 * 1024,
 		RehashTargetT:    3,
 		RehashTargetP:    4,
+
+		HistoryMaxRevisions: 10,
+		TrashRetention:      30 * 24 * 60 * 60 * 1000,
+		MaxUnlocked:         12 * 60 * 60 * 1000,
+		PadBucket:           256,
+
+		MaxAttachmentSize:      10 << 20,
+		MaxItemAttachmentBytes: 50 << 20,
+
+		PasswordMaxAge: 365 * 24 * 60 * 60 * 1000,
+	}
+}
+
+// withDefaults fills settings missing from older KeyDirectories. A
+// negative HistoryMaxRevisions disables history, a negative
+// TrashRetention keeps trashed items until they are purged by hand, and a
+// negative LockTimeout or MaxUnlocked turns that auto-lock limit off. A
+// negative PadBucket writes unpadded ciphertexts, and negative attachment
+// limits leave attachment sizes unbounded. A negative PasswordMaxAge stops
+// Health from reporting stale passwords.
+func (p Policy) withDefaults() Policy {
+	d := DefaultPolicy()
+	if p.LockTimeout == 0 {
+		p.LockTimeout = d.LockTimeout
+	}
+	if p.ClipboardTimeout == 0 {
+		p.ClipboardTimeout = d.ClipboardTimeout
+	}
+	if p.RehashTargetM == 0 {
+		p.RehashTargetM = d.RehashTargetM
+	}
+	if p.RehashTargetT == 0 {
+		p.RehashTargetT = d.RehashTargetT
+	}
+	if p.RehashTargetP == 0 {
+		p.RehashTargetP = d.RehashTargetP
+	}
+	if p.HistoryMaxRevisions == 0 {
+		p.HistoryMaxRevisions = d.HistoryMaxRevisions
+	}
+	if p.TrashRetention == 0 {
+		p.TrashRetention = d.TrashRetention
+	}
+	if p.MaxUnlocked == 0 {
+		p.MaxUnlocked = d.MaxUnlocked
+	}
+	if p.PadBucket == 0 {
+		p.PadBucket = d.PadBucket
+	}
+	if p.MaxAttachmentSize == 0 {
+		p.MaxAttachmentSize = d.MaxAttachmentSize
+	}
+	if p.MaxItemAttachmentBytes == 0 {
+		p.MaxItemAttachmentBytes = d.MaxItemAttachmentBytes
+	}
+	if p.PasswordMaxAge == 0 {
+		p.PasswordMaxAge = d.PasswordMaxAge
 	}
+	return p
 }
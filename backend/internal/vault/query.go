@@ -0,0 +1,291 @@
+package vault
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"project-crypto/internal/storage"
+)
+
+var ErrBadCursor = errors.New("vault: invalid cursor")
+
+type SortKey string
+
+const (
+	SortUpdated SortKey = "updated"
+	SortCreated SortKey = "created"
+	SortTitle   SortKey = "title"
+)
+
+// Page is one page of a listing. Total counts every item matching the
+// query, ignoring Limit and Cursor; Next is empty on the last page.
+type Page struct {
+	Items []ItemMeta `json:"items"`
+	Total int        `json:"total"`
+	Next  string     `json:"next,omitempty"`
+}
+
+// cursor marks the last item of a page. Title cursors carry only the id
+// and look the title up again, so titles never end up in URLs or logs.
+type cursor struct {
+	Sort  SortKey `json:"s"`
+	Desc  bool    `json:"d,omitempty"`
+	Value int64   `json:"v,omitempty"`
+	ID    string  `json:"i"`
+}
+
+func (v *vault) ListPage(ctx context.Context, q Query) (Page, error) {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	if !v.unlocked {
+		return Page{}, ErrNotUnlocked
+	}
+	if q.Sort == "" {
+		q.Sort = SortUpdated
+	}
+	switch q.Sort {
+	case SortUpdated, SortCreated, SortTitle:
+	default:
+		return Page{}, fmt.Errorf("vault: unknown sort key %q", q.Sort)
+	}
+	var after *ItemMeta
+	if q.Cursor != "" {
+		m, err := v.decodeCursor(q)
+		if err != nil {
+			return Page{}, err
+		}
+		after = &m
+	}
+	var page Page
+	for _, m := range v.meta {
+		if m.Deleted == 0 && v.matches(v.organize(m), q) {
+			page.Total++
+		}
+	}
+
+	var items []ItemMeta
+	var err error
+	if v.metaStore != nil && q.Sort != SortTitle {
+		items, err = v.listFromStore(ctx, q, after)
+	} else {
+		items, err = v.listFromIndex(q, after)
+	}
+	if err != nil {
+		return Page{}, err
+	}
+	if q.Limit > 0 && len(items) > q.Limit {
+		items = items[:q.Limit]
+		page.Next = encodeCursor(q, items[len(items)-1])
+	}
+	page.Items = items
+	return page, nil
+}
+
+func (v *vault) listFromIndex(q Query, after *ItemMeta) ([]ItemMeta, error) {
+	out := make([]ItemMeta, 0, len(v.meta))
+	for _, m := range v.meta {
+		if m.Deleted != 0 {
+			continue
+		}
+		m = v.organize(m)
+		if !v.matches(m, q) {
+			continue
+		}
+		if after != nil && !follows(q, m, *after) {
+			continue
+		}
+		if err := v.verifyMeta(m); err != nil {
+			return nil, err
+		}
+		out = append(out, m)
+	}
+	sort.Slice(out, func(i, j int) bool { return follows(q, out[j], out[i]) })
+	return out, nil
+}
+
+// listFromStore pushes the type, time range, order and cursor down to the
+// metadata store and fetches batches until Limit+1 items survive the
+// filters that only the key directory can answer.
+func (v *vault) listFromStore(ctx context.Context, q Query, after *ItemMeta) ([]ItemMeta, error) {
+	mq := storage.MetaQuery{
+		Types:         typeSpellings(q.Type),
+		UpdatedSince:  q.UpdatedSince,
+		CreatedBefore: q.CreatedBefore,
+		Sort:          string(q.Sort),
+		Desc:          q.Desc,
+	}
+	if q.Limit > 0 {
+		mq.Limit = int64(q.Limit) + 1
+	}
+	if after != nil {
+		mq.AfterValue, mq.AfterID = sortValue(q.Sort, *after), after.ID
+	}
+
+	var out []ItemMeta
+	for {
+		smetas, err := v.metaStore.ListMeta(ctx, mq)
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range smetas {
+			// Documents left behind by items deleted before purges cleaned
+			// up the meta collection have no key and nothing to decrypt.
+			if _, ok := v.kd.Items[m.ID]; !ok {
+				continue
+			}
+			if v.meta[m.ID].Deleted != 0 {
+				continue
+			}
+			im := v.organize(ItemMeta{
+				ID:      m.ID,
+				Type:    m.Type,
+				Created: m.Created,
+				Updated: m.Updated,
+				Version: m.Version,
+				Title:   v.meta[m.ID].Title,
+			})
+			if !v.matches(im, q) {
+				continue
+			}
+			if err := v.verifyMeta(im); err != nil {
+				return nil, err
+			}
+			out = append(out, im)
+		}
+		if mq.Limit == 0 || int64(len(smetas)) < mq.Limit || len(out) > q.Limit {
+			return out, nil
+		}
+		last := smetas[len(smetas)-1]
+		mq.AfterID = last.ID
+		mq.AfterValue = last.Updated
+		if q.Sort == SortCreated {
+			mq.AfterValue = last.Created
+		}
+	}
+}
+
+func (v *vault) matches(m ItemMeta, q Query) bool {
+	if q.Type != "" && CanonicalType(q.Type) != CanonicalType(m.Type) {
+		return false
+	}
+	if q.UpdatedSince != 0 && m.Updated < q.UpdatedSince {
+		return false
+	}
+	if q.CreatedBefore != 0 && m.Created >= q.CreatedBefore {
+		return false
+	}
+	if q.Favorite && !m.Favorite {
+		return false
+	}
+	if q.Folder != "" && !v.inFolder(m.Folder, q.Folder, q.Subfolders) {
+		return false
+	}
+	for _, want := range q.Tags {
+		found := false
+		for _, t := range m.Tags {
+			if t == want {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// follows reports whether m comes after prev in the order q asks for.
+// Ties on the sort key are broken by id.
+func follows(q Query, m, prev ItemMeta) bool {
+	var c int
+	if q.Sort == SortTitle {
+		c = strings.Compare(strings.ToLower(m.Title), strings.ToLower(prev.Title))
+	} else {
+		a, b := sortValue(q.Sort, m), sortValue(q.Sort, prev)
+		if a < b {
+			c = -1
+		} else if a > b {
+			c = 1
+		}
+	}
+	if c == 0 {
+		c = strings.Compare(m.ID, prev.ID)
+	}
+	if q.Desc {
+		return c < 0
+	}
+	return c > 0
+}
+
+func sortValue(key SortKey, m ItemMeta) int64 {
+	if key == SortCreated {
+		return m.Created
+	}
+	return m.Updated
+}
+
+func encodeCursor(q Query, last ItemMeta) string {
+	c := cursor{Sort: q.Sort, Desc: q.Desc, ID: last.ID}
+	if q.Sort != SortTitle {
+		c.Value = sortValue(q.Sort, last)
+	}
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// decodeCursor returns a stand-in for the last item of the previous page.
+func (v *vault) decodeCursor(q Query) (ItemMeta, error) {
+	b, err := base64.RawURLEncoding.DecodeString(q.Cursor)
+	if err != nil {
+		return ItemMeta{}, ErrBadCursor
+	}
+	var c cursor
+	if err := json.Unmarshal(b, &c); err != nil || c.ID == "" {
+		return ItemMeta{}, ErrBadCursor
+	}
+	if c.Sort != q.Sort || c.Desc != q.Desc {
+		return ItemMeta{}, fmt.Errorf("%w: cursor is for a different order", ErrBadCursor)
+	}
+	m := ItemMeta{ID: c.ID, Updated: c.Value, Created: c.Value}
+	if c.Sort == SortTitle {
+		cur, ok := v.meta[c.ID]
+		if !ok {
+			return ItemMeta{}, fmt.Errorf("%w: item %s is gone", ErrBadCursor, c.ID)
+		}
+		m.Title = cur.Title
+	}
+	return m, nil
+}
+
+// fillTitles adds titles to index entries written before the index kept
+// them. Unlock runs it so listing never writes; the titles are saved with
+// the next key directory write.
+func (v *vault) fillTitles(ctx context.Context) {
+	for id, m := range v.meta {
+		if m.Title != "" || m.Deleted != 0 {
+			continue
+		}
+		payload, err := v.openPayload(ctx, id)
+		if err != nil {
+			continue
+		}
+		m.Title = itemTitle(payload.item())
+		v.meta[id] = m
+	}
+}
+
+// itemTitle is the name an item is listed under.
+func itemTitle(it Item) string {
+	for _, k := range []string{"title", "site", "name", "username"} {
+		if t := strings.TrimSpace(it.Fields[k]); t != "" {
+			return t
+		}
+	}
+	return ""
+}
@@ -0,0 +1,276 @@
+package vault
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"sort"
+
+	cr "project-crypto/internal/crypto"
+)
+
+// Rekey replaces the VRK and every item DEK and re-encrypts all blobs.
+//
+// Progress is journaled in KeyDirectory.Rekey, which holds the new VRK
+// (sealed under the old one) and the new entry for every item whose blobs
+// are being moved. An item's new DEK is recorded before any of its blobs
+// are rewritten, and each blob is tried under the new DEK before the old
+// one, so an interrupted run can be resumed from any point. Unlock resumes
+// an unfinished rekey before handing the vault out.
+func (v *vault) Rekey(ctx context.Context) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.rekey(ctx)
+}
+
+func (v *vault) rekey(ctx context.Context) error {
+	if !v.unlocked {
+		return ErrNotUnlocked
+	}
+
+	if v.kd.Rekey == nil {
+		newVRK := make([]byte, 32)
+		if _, err := rand.Read(newVRK); err != nil {
+			return err
+		}
+		sealed, err := cr.Seal(v.vrk[:], newVRK, []byte("rekey-vrk"))
+		cr.Zero(newVRK)
+		if err != nil {
+			return err
+		}
+		v.kd.Rekey = &RekeyState{VRK: sealed, Items: map[string]KDItem{}}
+		if err := v.flushKD(); err != nil {
+			return err
+		}
+	}
+	state := v.kd.Rekey
+	if state.Items == nil {
+		state.Items = map[string]KDItem{}
+	}
+
+	newVRK, err := cr.OpenAny(v.vrk[:], state.VRK, []byte("rekey-vrk"))
+	if err != nil {
+		return err
+	}
+	defer cr.Zero(newVRK)
+
+	ids := make([]string, 0, len(v.kd.Items))
+	for id := range v.kd.Items {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		if err := v.rekeyItem(ctx, id, newVRK, state); err != nil {
+			return err
+		}
+	}
+
+	vrkWrap, err := cr.Seal(v.kek[:], newVRK, []byte("vrk-wrap"))
+	if err != nil {
+		return err
+	}
+	v.header.VRKWrap = vrkWrap
+	v.kd.Items = state.Items
+	v.kd.Rekey = nil
+	copy(v.vrk[:], newVRK)
+	if err := v.flushKD(); err != nil {
+		return err
+	}
+	v.audit.Append(fmt.Sprintf("rekey items=%d", len(v.kd.Items)))
+	return nil
+}
+
+func (v *vault) rekeyItem(ctx context.Context, id string, newVRK []byte, state *RekeyState) error {
+	ki := v.kd.Items[id]
+	oldDEK, err := cr.OpenAny(v.vrk[:], ki.DekWrap, []byte("dek-wrap:"+id))
+	if err != nil {
+		return err
+	}
+	defer cr.Zero(oldDEK)
+
+	var newDEK []byte
+	entry, started := state.Items[id]
+	if started {
+		newDEK, err = cr.OpenAny(newVRK, entry.DekWrap, []byte("dek-wrap:"+id))
+		if err != nil {
+			return err
+		}
+	} else {
+		newDEK = make([]byte, 32)
+		if _, err := rand.Read(newDEK); err != nil {
+			return err
+		}
+		entry = ki
+		entry.History = append([]Revision(nil), ki.History...)
+		entry.DekWrap, err = cr.Seal(newVRK, newDEK, []byte("dek-wrap:"+id))
+		if err != nil {
+			cr.Zero(newDEK)
+			return err
+		}
+		if entry.Attachments, err = newAttachmentKeys(id, ki.Attachments, newVRK); err != nil {
+			cr.Zero(newDEK)
+			return err
+		}
+		state.Items[id] = entry
+		if err := v.flushKD(); err != nil {
+			cr.Zero(newDEK)
+			return err
+		}
+	}
+	defer cr.Zero(newDEK)
+
+	aad := []byte("item:" + id)
+	ct, err := v.rekeyBlob(ctx, id, aad, oldDEK, newDEK, func(ct []byte) error {
+		return v.verifyItemBlob(id, ct)
+	})
+	if err != nil {
+		return err
+	}
+	if m, ok := v.meta[id]; ok {
+		stampItem(newVRK, &entry, id, m.Type, m.Version, ct)
+	} else {
+		entry.MetaMAC, entry.BlobSum = nil, nil
+	}
+
+	for i, rev := range ki.History {
+		rct, err := v.rekeyBlob(ctx, revisionBlobID(id, rev.Version), aad, oldDEK, newDEK, func(ct []byte) error {
+			return verifyRevisionBlob(id, rev, ct)
+		})
+		if err != nil {
+			return err
+		}
+		sum := sha256.Sum256(rct)
+		entry.History[i].Sum = sum[:]
+	}
+
+	for attID, a := range ki.Attachments {
+		if err := v.rekeyAttachment(ctx, id, attID, a, newVRK, &entry); err != nil {
+			return err
+		}
+	}
+
+	state.Items[id] = entry
+	return nil
+}
+
+// newAttachmentKeys gives every attachment a fresh DEK wrapped under
+// newVRK. Sums are left as they are until the blob has been moved.
+func newAttachmentKeys(id string, atts map[string]Attachment, newVRK []byte) (map[string]Attachment, error) {
+	if len(atts) == 0 {
+		return nil, nil
+	}
+	out := make(map[string]Attachment, len(atts))
+	for attID, a := range atts {
+		dek := make([]byte, 32)
+		if _, err := rand.Read(dek); err != nil {
+			return nil, err
+		}
+		wrap, err := cr.Seal(newVRK, dek, attachmentWrapAAD(id, attID))
+		cr.Zero(dek)
+		if err != nil {
+			return nil, err
+		}
+		a.DekWrap = wrap
+		out[attID] = a
+	}
+	return out, nil
+}
+
+func (v *vault) rekeyAttachment(ctx context.Context, id, attID string, old Attachment, newVRK []byte, entry *KDItem) error {
+	next, ok := entry.Attachments[attID]
+	if !ok {
+		return fmt.Errorf("rekey: no new key for attachment %s/%s", id, attID)
+	}
+	oldDEK, err := cr.OpenAny(v.vrk[:], old.DekWrap, attachmentWrapAAD(id, attID))
+	if err != nil {
+		return err
+	}
+	defer cr.Zero(oldDEK)
+	newDEK, err := cr.OpenAny(newVRK, next.DekWrap, attachmentWrapAAD(id, attID))
+	if err != nil {
+		return err
+	}
+	defer cr.Zero(newDEK)
+
+	verify := func(ct []byte) error { return verifyAttachmentBlob(id, old, ct) }
+	rekey := v.rekeyBlob
+	if old.Chunked {
+		rekey = v.rekeyStreamBlob
+	}
+	ct, err := rekey(ctx, attachmentBlobID(id, attID), attachmentAAD(id, attID), oldDEK, newDEK, verify)
+	if err != nil {
+		return err
+	}
+	sum := sha256.Sum256(ct)
+	next.Sum = sum[:]
+	entry.Attachments[attID] = next
+	return nil
+}
+
+// rekeyBlob moves one blob from oldDEK to newDEK and returns the stored
+// ciphertext. A blob that already opens under newDEK was moved by an
+// earlier, interrupted run and is left alone.
+func (v *vault) rekeyBlob(ctx context.Context, blobID string, aad, oldDEK, newDEK []byte, verify func(ct []byte) error) ([]byte, error) {
+	ct, err := v.store.Get(ctx, blobID)
+	if err != nil {
+		return nil, err
+	}
+	if pt, err := cr.Open(v.dekKey(newDEK), ct, aad); err == nil {
+		cr.Zero(pt)
+		return ct, nil
+	}
+	if err := verify(ct); err != nil {
+		return nil, err
+	}
+	pt, err := cr.OpenAny(v.dekKey(oldDEK), ct, aad)
+	if err != nil {
+		return nil, err
+	}
+	defer cr.Zero(pt)
+	nct, err := cr.Seal(v.dekKey(newDEK), pt, aad)
+	if err != nil {
+		return nil, err
+	}
+	if err := v.store.Put(ctx, blobID, nct); err != nil {
+		return nil, err
+	}
+	return nct, nil
+}
+
+// rekeyStreamBlob is rekeyBlob for blobs written with cr.NewStreamWriter.
+func (v *vault) rekeyStreamBlob(ctx context.Context, blobID string, aad, oldDEK, newDEK []byte, verify func(ct []byte) error) ([]byte, error) {
+	ct, err := v.store.Get(ctx, blobID)
+	if err != nil {
+		return nil, err
+	}
+	if sr, err := cr.NewStreamReader(bytes.NewReader(ct), v.dekKey(newDEK), aad); err == nil {
+		if _, err := io.Copy(io.Discard, sr); err == nil {
+			return ct, nil
+		}
+	}
+	if err := verify(ct); err != nil {
+		return nil, err
+	}
+	sr, err := cr.NewStreamReader(bytes.NewReader(ct), v.dekKey(oldDEK), aad)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	sw, err := cr.NewStreamWriter(&buf, v.dekKey(newDEK), aad)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(sw, sr); err != nil {
+		return nil, err
+	}
+	if err := sw.Close(); err != nil {
+		return nil, err
+	}
+	if err := v.store.Put(ctx, blobID, buf.Bytes()); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
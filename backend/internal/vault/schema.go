@@ -0,0 +1,295 @@
+package vault
+
+import (
+	"errors"
+	"fmt"
+	"net/mail"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrInvalidItem = errors.New("vault: invalid item")
+
+type ValidationError struct {
+	Type   string
+	Field  string
+	Reason string
+}
+
+func (e *ValidationError) Error() string {
+	if e.Field == "" {
+		return fmt.Sprintf("%v: %s", ErrInvalidItem, e.Reason)
+	}
+	return fmt.Sprintf("%v: %s.%s %s", ErrInvalidItem, e.Type, e.Field, e.Reason)
+}
+
+func (e *ValidationError) Unwrap() error { return ErrInvalidItem }
+
+type FieldSpec struct {
+	Name     string                   `json:"name"`
+	Label    string                   `json:"label"`
+	Required bool                     `json:"required"`
+	Secret   bool                     `json:"secret"`
+	Validate func(value string) error `json:"-"`
+}
+
+type Schema struct {
+	Type    string      `json:"type"`
+	Label   string      `json:"label"`
+	Fields  []FieldSpec `json:"fields"`
+	Aliases []string    `json:"-"`
+}
+
+func (s Schema) Field(name string) (FieldSpec, bool) {
+	for _, f := range s.Fields {
+		if f.Name == name {
+			return f, true
+		}
+	}
+	return FieldSpec{}, false
+}
+
+// IsSecret reports whether a field of this type should be hidden unless
+// explicitly revealed.
+func (s Schema) IsSecret(name string) bool {
+	f, ok := s.Field(name)
+	return ok && f.Secret
+}
+
+var (
+	schemas = map[string]Schema{}
+	aliases = map[string]string{}
+)
+
+// RegisterSchema adds or replaces the schema for s.Type.
+func RegisterSchema(s Schema) {
+	schemas[s.Type] = s
+	for _, a := range s.Aliases {
+		aliases[a] = s.Type
+	}
+}
+
+func LookupSchema(typ string) (Schema, bool) {
+	s, ok := schemas[CanonicalType(typ)]
+	return s, ok
+}
+
+func Schemas() []Schema {
+	out := make([]Schema, 0, len(schemas))
+	for _, s := range schemas {
+		out = append(out, s)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Type < out[j].Type })
+	return out
+}
+
+// CanonicalType lowercases typ and resolves registered aliases such as
+// "secure note" for "note".
+func CanonicalType(typ string) string {
+	t := strings.ToLower(strings.TrimSpace(typ))
+	if c, ok := aliases[t]; ok {
+		return c
+	}
+	return t
+}
+
+// typeSpellings returns the canonical form of typ and every alias of it:
+// the types items stored before aliases were resolved on write may carry.
+// It returns nil for an empty typ.
+func typeSpellings(typ string) []string {
+	if typ == "" {
+		return nil
+	}
+	c := CanonicalType(typ)
+	out := []string{c}
+	for a, t := range aliases {
+		if t == c {
+			out = append(out, a)
+		}
+	}
+	sort.Strings(out[1:])
+	return out
+}
+
+// ValidateItem checks it against the schema of its type and returns it
+// with the type canonicalized. Empty optional fields are dropped and
+// custom fields get their default kind and sensitivity.
+func ValidateItem(it Item) (Item, error) {
+	return validateItem(it, nil)
+}
+
+// validateItem is ValidateItem for an update: a field the schema does not
+// know is still accepted if cur, the item's current fields, already has
+// it, so items written before the schema existed stay editable.
+func validateItem(it Item, cur map[string]string) (Item, error) {
+	typ := CanonicalType(it.Type)
+	s, ok := schemas[typ]
+	if !ok {
+		return it, &ValidationError{Type: typ, Reason: fmt.Sprintf("unknown item type %q", it.Type)}
+	}
+	fields := make(map[string]string, len(it.Fields))
+	for name, val := range it.Fields {
+		spec, ok := s.Field(name)
+		if _, legacy := cur[name]; !ok && !legacy {
+			return it, &ValidationError{Type: typ, Field: name, Reason: "is not a field of this type"}
+		}
+		if strings.TrimSpace(val) == "" {
+			continue
+		}
+		if spec.Validate != nil {
+			if err := spec.Validate(val); err != nil {
+				return it, &ValidationError{Type: typ, Field: name, Reason: err.Error()}
+			}
+		}
+		fields[name] = val
+	}
+	for _, spec := range s.Fields {
+		if spec.Required && fields[spec.Name] == "" {
+			return it, &ValidationError{Type: typ, Field: spec.Name, Reason: "is required"}
+		}
+	}
+	custom, err := validateCustomFields(typ, it.Custom)
+	if err != nil {
+		return it, err
+	}
+	return Item{Type: typ, Fields: fields, Custom: custom}, nil
+}
+
+func init() {
+	notes := FieldSpec{Name: "notes", Label: "Notes", Secret: true}
+	title := FieldSpec{Name: "title", Label: "Title"}
+
+	RegisterSchema(Schema{Type: "login", Label: "Login", Fields: []FieldSpec{
+		{Name: "site", Label: "Website"},
+		{Name: "username", Label: "Username"},
+		{Name: "password", Label: "Password", Required: true, Secret: true},
+		{Name: otpField, Label: "One-time code secret", Secret: true, Validate: validateTOTPSecret},
+		title, notes,
+	}})
+	RegisterSchema(Schema{Type: "card", Label: "Payment card", Fields: []FieldSpec{
+		{Name: "cardholder", Label: "Cardholder"},
+		{Name: "number", Label: "Number", Required: true, Secret: true, Validate: validateCardNumber},
+		{Name: "exp_month", Label: "Expiry month", Validate: intRange(1, 12)},
+		{Name: "exp_year", Label: "Expiry year", Validate: validateYear},
+		{Name: "cvv", Label: "Security code", Secret: true, Validate: digits(3, 4)},
+		{Name: "network", Label: "Network"},
+		title, notes,
+	}})
+	RegisterSchema(Schema{Type: "note", Label: "Secure note", Aliases: []string{"secure note", "secure-note", "secure_note"}, Fields: []FieldSpec{
+		title,
+		{Name: "notes", Label: "Note", Required: true, Secret: true},
+	}})
+	RegisterSchema(Schema{Type: "identity", Label: "Identity", Fields: []FieldSpec{
+		{Name: "name", Label: "Full name", Required: true},
+		{Name: "email", Label: "Email", Validate: validateEmail},
+		{Name: "phone", Label: "Phone"},
+		{Name: "address", Label: "Address"},
+		{Name: "birth_date", Label: "Date of birth", Validate: validateDate},
+		{Name: "passport_number", Label: "Passport number", Secret: true},
+		{Name: "national_id", Label: "National ID", Secret: true},
+		title, notes,
+	}})
+	RegisterSchema(Schema{Type: "ssh_key", Label: "SSH key", Aliases: []string{"ssh", "ssh key", "ssh-key"}, Fields: []FieldSpec{
+		{Name: "private_key", Label: "Private key", Required: true, Secret: true, Validate: validatePrivateKey},
+		{Name: "public_key", Label: "Public key"},
+		{Name: "passphrase", Label: "Passphrase", Secret: true},
+		{Name: "fingerprint", Label: "Fingerprint"},
+		title, notes,
+	}})
+	RegisterSchema(Schema{Type: "api_credential", Label: "API credential", Aliases: []string{"api", "api credential", "api-credential", "api_key"}, Fields: []FieldSpec{
+		{Name: "key", Label: "Key", Required: true, Secret: true},
+		{Name: "secret", Label: "Secret", Secret: true},
+		{Name: "url", Label: "Endpoint"},
+		{Name: "expires", Label: "Expires", Validate: validateDate},
+		title, notes,
+	}})
+	RegisterSchema(Schema{Type: "database", Label: "Database credential", Aliases: []string{"db", "database credential", "database-credential", "database_credential"}, Fields: []FieldSpec{
+		{Name: "engine", Label: "Engine"},
+		{Name: "host", Label: "Host", Required: true},
+		{Name: "port", Label: "Port", Validate: intRange(1, 65535)},
+		{Name: "database", Label: "Database"},
+		{Name: "username", Label: "Username"},
+		{Name: "password", Label: "Password", Secret: true},
+		title, notes,
+	}})
+}
+
+func intRange(lo, hi int) func(string) error {
+	return func(s string) error {
+		n, err := strconv.Atoi(strings.TrimSpace(s))
+		if err != nil || n < lo || n > hi {
+			return fmt.Errorf("must be a number from %d to %d", lo, hi)
+		}
+		return nil
+	}
+}
+
+func digits(lo, hi int) func(string) error {
+	return func(s string) error {
+		if len(s) < lo || len(s) > hi || strings.Trim(s, "0123456789") != "" {
+			return fmt.Errorf("must be %d to %d digits", lo, hi)
+		}
+		return nil
+	}
+}
+
+func validateYear(s string) error {
+	if len(s) != 2 && len(s) != 4 {
+		return errors.New("must be a 2 or 4 digit year")
+	}
+	return digits(2, 4)(s)
+}
+
+func validateCardNumber(s string) error {
+	var ds []int
+	for _, r := range s {
+		switch {
+		case r >= '0' && r <= '9':
+			ds = append(ds, int(r-'0'))
+		case r == ' ' || r == '-':
+		default:
+			return errors.New("must contain only digits")
+		}
+	}
+	if len(ds) < 12 || len(ds) > 19 {
+		return errors.New("must be 12 to 19 digits")
+	}
+	sum := 0
+	for i := range ds {
+		d := ds[len(ds)-1-i]
+		if i%2 == 1 {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+	}
+	if sum%10 != 0 {
+		return errors.New("fails the Luhn check")
+	}
+	return nil
+}
+
+func validateEmail(s string) error {
+	if _, err := mail.ParseAddress(s); err != nil {
+		return errors.New("must be an email address")
+	}
+	return nil
+}
+
+func validateDate(s string) error {
+	if _, err := time.Parse("2006-01-02", s); err != nil {
+		return errors.New("must be a date (YYYY-MM-DD)")
+	}
+	return nil
+}
+
+func validatePrivateKey(s string) error {
+	if !strings.Contains(s, "-----BEGIN") || !strings.Contains(s, "PRIVATE KEY-----") {
+		return errors.New("must be a PEM or OpenSSH private key")
+	}
+	return nil
+}
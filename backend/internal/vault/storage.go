@@ -1,30 +1,38 @@
 package vault
 
 import (
-	"encoding/json"
 	"errors"
 	"os"
 )
 
 func readHeader(path string) (Header, error) {
-	var h Header
 	b, err := os.ReadFile(path)
 	if err != nil {
-		return h, err
+		return Header{}, err
 	}
-	if err := json.Unmarshal(b, &h); err != nil {
-		return h, err
-	}
-	return h, nil
+	return decodeHeader(b)
 }
 
+// writeHeader replaces the header through the journal in journal.go. If
+// the replace fails after the journal was written, the new header is
+// applied by the next Unlock.
 func writeHeader(path string, h Header) error {
-	b, err := json.MarshalIndent(h, "", "  ")
+	b, err := encodeHeader(h)
 	if err != nil {
 		return err
 	}
-
-	return os.WriteFile(path, b, 0600)
+	if err := writeJournal(path, b); err != nil {
+		return err
+	}
+	if err := writeFileAtomic(path, b); err != nil {
+		return err
+	}
+	return os.Remove(journalPath(path))
 }
 
-var ErrNotUnlocked = errors.New("vault: not unlocked")
+var (
+	ErrNotUnlocked  = errors.New("vault: not unlocked")
+	ErrItemNotFound = errors.New("vault: item not found")
+	ErrInTrash      = errors.New("vault: item is in trash")
+	ErrConflict     = errors.New("vault: item was changed by someone else")
+)
@@ -0,0 +1,135 @@
+package vault
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// DeleteItem moves an item to the trash. Its DEK and blobs are kept until
+// the item is purged, either explicitly or once Policy.TrashRetention has
+// passed. A non-zero version must match the item's current version, as
+// for UpdateItem.
+func (v *vault) DeleteItem(ctx context.Context, id string, version int) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if !v.unlocked {
+		return ErrNotUnlocked
+	}
+	m, ok := v.meta[id]
+	if _, inKD := v.kd.Items[id]; !inKD || !ok {
+		return fmt.Errorf("%w: %s", ErrItemNotFound, id)
+	}
+	if err := v.checkVersion(id, version); err != nil {
+		return err
+	}
+	if m.Deleted != 0 {
+		return nil
+	}
+	m.Deleted = time.Now().Unix()
+	v.putMeta(ctx, m)
+	return v.flushKD()
+}
+
+func (v *vault) ListTrash(ctx context.Context) ([]ItemMeta, error) {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	if !v.unlocked {
+		return nil, ErrNotUnlocked
+	}
+	out := []ItemMeta{}
+	for _, m := range v.meta {
+		if m.Deleted != 0 {
+			out = append(out, m)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Deleted > out[j].Deleted })
+	return out, nil
+}
+
+func (v *vault) Restore(ctx context.Context, id string) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if !v.unlocked {
+		return ErrNotUnlocked
+	}
+	m, ok := v.meta[id]
+	if !ok || m.Deleted == 0 {
+		return fmt.Errorf("%w: %s not in trash", ErrItemNotFound, id)
+	}
+	m.Deleted = 0
+	v.putMeta(ctx, m)
+	return v.flushKD()
+}
+
+// Purge crypto-shreds an item: once the KeyDirectory no longer holds its
+// wrapped DEK, any blob copies left behind in storage are unreadable.
+// Only items already in the trash can be purged.
+func (v *vault) Purge(ctx context.Context, id string) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if !v.unlocked {
+		return ErrNotUnlocked
+	}
+	if m, ok := v.meta[id]; !ok || m.Deleted == 0 {
+		return fmt.Errorf("%w: %s not in trash", ErrItemNotFound, id)
+	}
+	if err := v.purge(ctx, id); err != nil {
+		return err
+	}
+	return v.flushKD()
+}
+
+func (v *vault) PurgeExpired(ctx context.Context) (int, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.purgeExpired(ctx)
+}
+
+func (v *vault) purgeExpired(ctx context.Context) (int, error) {
+	if !v.unlocked {
+		return 0, ErrNotUnlocked
+	}
+	retention := v.kd.Policy.TrashRetention
+	if retention < 0 {
+		return 0, nil
+	}
+	cutoff := time.Now().Add(-time.Duration(retention) * time.Millisecond).Unix()
+	n := 0
+	for id, m := range v.meta {
+		if m.Deleted == 0 || m.Deleted > cutoff {
+			continue
+		}
+		if err := v.purge(ctx, id); err != nil {
+			return n, err
+		}
+		n++
+	}
+	if n == 0 {
+		return 0, nil
+	}
+	return n, v.flushKD()
+}
+
+func (v *vault) purge(ctx context.Context, id string) error {
+	ki, ok := v.kd.Items[id]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrItemNotFound, id)
+	}
+	delete(v.kd.Items, id)
+	delete(v.meta, id)
+	if v.store != nil {
+		_ = v.store.Delete(ctx, id)
+		for _, rev := range ki.History {
+			_ = v.store.Delete(ctx, revisionBlobID(id, rev.Version))
+		}
+		for attID := range ki.Attachments {
+			_ = v.store.Delete(ctx, attachmentBlobID(id, attID))
+		}
+	}
+	if v.metaStore != nil {
+		_ = v.metaStore.DeleteMeta(ctx, id)
+	}
+	return nil
+}
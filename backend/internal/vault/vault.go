@@ -3,11 +3,15 @@ package vault
 import (
 	"context"
 	"crypto/rand"
+	"encoding/base32"
 	"encoding/json"
 	"fmt"
+	"io"
 	"path/filepath"
-	"time"
+	"strings"
+	"sync"
 
+	"project-crypto/internal/audit"
 	cr "project-crypto/internal/crypto"
 	"project-crypto/internal/storage"
 )
@@ -17,14 +21,44 @@ type Vault interface {
 	Unlock(ctx context.Context, master []byte) error
 	Lock()
 	AddItem(ctx context.Context, item Item) (string, error)
+	AddItems(ctx context.Context, items []NewItem) ([]string, error)
 	GetItem(ctx context.Context, id string) (Item, error)
 	UpdateItem(ctx context.Context, id string, upd Item) error
 	List(ctx context.Context, q Query) ([]ItemMeta, error)
+	ListPage(ctx context.Context, q Query) (Page, error)
+	OTP(ctx context.Context, id, field string, advance bool) (OTPCode, error)
+	Health(ctx context.Context) (HealthReport, error)
+	Backup(ctx context.Context, w io.Writer, passphrase []byte) (BackupManifest, error)
 	RotateMaster(ctx context.Context, newMaster []byte) error
-	DeleteItem(ctx context.Context, id string) error
+	LastUnlock() UnlockReport
+	AuditLog() *audit.Log
+	DeleteItem(ctx context.Context, id string, version int) error
+	ListTrash(ctx context.Context) ([]ItemMeta, error)
+	Restore(ctx context.Context, id string) error
+	Purge(ctx context.Context, id string) error
+	PurgeExpired(ctx context.Context) (int, error)
+	History(ctx context.Context, id string) ([]Revision, error)
+	GetRevision(ctx context.Context, id string, version int) (Item, error)
+	RestoreRevision(ctx context.Context, id string, version int) error
+	AddAttachment(ctx context.Context, id, name, mime string, r io.Reader) (AttachmentMeta, error)
+	ListAttachments(ctx context.Context, id string) ([]AttachmentMeta, error)
+	ReadAttachment(ctx context.Context, id, attID string, w io.Writer) (AttachmentMeta, error)
+	DeleteAttachment(ctx context.Context, id, attID string) error
+	CreateFolder(ctx context.Context, name, parent string) (Folder, error)
+	ListFolders(ctx context.Context) ([]Folder, error)
+	UpdateFolder(ctx context.Context, id, name string, parent *string) (Folder, error)
+	DeleteFolder(ctx context.Context, id string) error
+	Organize(ctx context.Context, id string, o Organization, version int) error
+	Rekey(ctx context.Context) error
+	Policy() Policy
+	SetPolicy(ctx context.Context, p Policy) error
 }
 
 type vault struct {
+	// mu guards everything below. Exported methods take it and call only
+	// unexported helpers, so one vault can be shared between requests.
+	mu sync.RWMutex
+
 	path     string
 	header   Header
 	kd       KeyDirectory
@@ -37,8 +71,13 @@ type vault struct {
 	metaStore storage.MetaStore
 
 	meta map[string]ItemMeta
+
+	report UnlockReport
+	audit  *audit.Log
 }
 
+var defaultKDF = cr.DefaultDesktopKDF
+
 func New(path string) Vault {
 	blobDir := "." + filepath.Base(path) + ".blobs"
 	return NewWithStores(path, storage.NewFileBlobStore(blobDir), nil)
@@ -50,12 +89,15 @@ func NewWithStores(path string, blobs storage.BlobStore, meta storage.MetaStore)
 		store:     blobs,
 		metaStore: meta,
 		meta:      make(map[string]ItemMeta),
+		audit:     audit.New(),
 	}
 }
 
 func (v *vault) Create(ctx context.Context, master []byte) error {
-	v.header.Version = 2
-	kdf := cr.DefaultDesktopKDF()
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.header.Version = formatVersion
+	kdf := defaultKDF()
 	v.header.KDF = KDFHeader{
 		Algo: "argon2id",
 		M:    kdf.M,
@@ -64,7 +106,6 @@ func (v *vault) Create(ctx context.Context, master []byte) error {
 		Salt: kdf.Salt,
 	}
 	v.kek = cr.DeriveKEK(master, kdf)
-	defer zero32(&v.kek)
 
 	_, _ = rand.Read(v.vrk[:])
 
@@ -86,12 +127,26 @@ func (v *vault) Create(ctx context.Context, master []byte) error {
 	return nil
 }
 
-func (v *vault) Unlock(ctx context.Context, master []byte) error {
+func (v *vault) Unlock(ctx context.Context, master []byte) (err error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	// The steps after decryption need an unlocked vault; should any of them
+	// fail, the caller gets a locked vault back rather than partial state.
+	defer func() {
+		if err != nil {
+			v.lock()
+		}
+	}()
+	recovered, err := recoverHeader(v.path)
+	if err != nil {
+		return fmt.Errorf("recover header: %w", err)
+	}
 	h, err := readHeader(v.path)
 	if err != nil {
 		return err
 	}
 	v.header = h
+	v.report = UnlockReport{Recovered: recovered}
 	kdf := cr.KDFParams{M: h.KDF.M, T: h.KDF.T, P: h.KDF.P, Salt: h.KDF.Salt}
 	v.kek = cr.DeriveKEK(master, kdf)
 
@@ -106,62 +161,112 @@ func (v *vault) Unlock(ctx context.Context, master []byte) error {
 	if err != nil {
 		return err
 	}
-	if err := json.Unmarshal(kdBytes, &v.kd); err != nil {
+	kdBody, err := unpad(kdBytes)
+	if err != nil {
+		return err
+	}
+	var kd KeyDirectory
+	if err := json.Unmarshal(kdBody, &kd); err != nil {
 		return err
 	}
+	v.kd = kd
+	v.kd.Policy = kd.Policy.withDefaults()
+	v.meta = kd.Index
+	if v.meta == nil {
+		v.meta = make(map[string]ItemMeta)
+	}
 	v.unlocked = true
-	return nil
+	if recovered {
+		v.audit.Append("header-recovered")
+	}
+	if err := v.migrate(ctx); err != nil {
+		return err
+	}
+	if err := v.upgradeKDF(master); err != nil {
+		return fmt.Errorf("kdf upgrade: %w", err)
+	}
+	if v.kd.Rekey != nil {
+		if err := v.rekey(ctx); err != nil {
+			return fmt.Errorf("resume rekey: %w", err)
+		}
+	}
+	if err := v.rebuildIndex(ctx); err != nil {
+		return err
+	}
+	v.fillTitles(ctx)
+	_, err = v.purgeExpired(ctx)
+	return err
 }
 
+func (v *vault) LastUnlock() UnlockReport {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	return v.report
+}
+
+func (v *vault) AuditLog() *audit.Log { return v.audit }
+
 func (v *vault) Lock() {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.lock()
+}
+
+func (v *vault) lock() {
 	v.unlocked = false
 	zero32(&v.kek)
 	zero32(&v.vrk)
+	v.meta = make(map[string]ItemMeta)
 }
 
-func (v *vault) List(ctx context.Context, q Query) ([]ItemMeta, error) {
-	if !v.unlocked {
-		return nil, ErrNotUnlocked
+// rebuildIndex restores index entries for items written before the
+// index was kept in the KeyDirectory, reading them back from their blobs.
+func (v *vault) rebuildIndex(ctx context.Context) error {
+	if v.store == nil {
+		return nil
 	}
-
-	if v.metaStore != nil {
-		filter := map[string]interface{}{}
-		if q.Type != "" {
-			filter["type"] = q.Type
+	added := 0
+	for id := range v.kd.Items {
+		if _, ok := v.meta[id]; ok {
+			continue
 		}
-		smetas, err := v.metaStore.ListMeta(ctx, filter)
+		payload, err := v.openPayload(ctx, id)
 		if err != nil {
-			return nil, err
+			continue
 		}
-
-		out := make([]ItemMeta, 0, len(smetas))
-		for _, m := range smetas {
-			out = append(out, ItemMeta{
-				ID:      m.ID,
-				Type:    m.Type,
-				Created: m.Created,
-				Updated: m.Updated,
-				Version: m.Version,
-			})
+		m := ItemMeta{
+			ID:      id,
+			Type:    payload.Type,
+			Title:   itemTitle(payload.item()),
+			Created: payload.Created,
+			Updated: payload.Updated,
+			Version: payload.Version,
 		}
-		return out, nil
-	}
-
-	out := make([]ItemMeta, 0, len(v.meta))
-	for _, m := range v.meta {
-		if q.Type == "" || q.Type == m.Type {
-			out = append(out, m)
+		if v.verifyMeta(m) != nil {
+			continue
 		}
+		v.meta[id] = m
+		added++
 	}
-	return out, nil
+	if added == 0 {
+		return nil
+	}
+	return v.flushKD()
+}
+
+func (v *vault) List(ctx context.Context, q Query) ([]ItemMeta, error) {
+	page, err := v.ListPage(ctx, q)
+	return page.Items, err
 }
 
 func (v *vault) RotateMaster(ctx context.Context, newMaster []byte) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
 	if !v.unlocked {
 		return ErrNotUnlocked
 	}
 
-	newKDF := cr.DefaultDesktopKDF()
+	newKDF := defaultKDF()
 	newKEK := cr.DeriveKEK(newMaster, newKDF)
 	defer zero32(&newKEK)
 
@@ -179,20 +284,47 @@ func (v *vault) RotateMaster(ctx context.Context, newMaster []byte) error {
 	return writeHeader(v.path, v.header)
 }
 
+func (v *vault) Policy() Policy {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	return v.kd.Policy
+}
+
+func (v *vault) SetPolicy(ctx context.Context, p Policy) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if !v.unlocked {
+		return ErrNotUnlocked
+	}
+	v.kd.Policy = p.withDefaults()
+	return v.flushKD()
+}
+
 func (v *vault) flushKD() error {
+	v.kd.Index = v.meta
 	kdBytes, _ := json.Marshal(v.kd)
-	ct, err := cr.Seal(v.vrk[:], kdBytes, []byte("kd"))
+	bucket := v.kd.Policy.PadBucket
+	ct, err := cr.Seal(v.vrk[:], pad(kdBytes, bucket), []byte("kd"))
 	if err != nil {
 		return err
 	}
 	v.header.KDCipher = ct
+	if v.header.Padding, err = headerPadding(v.header, bucket); err != nil {
+		return err
+	}
 	return writeHeader(v.path, v.header)
 }
 
+// newID returns a random 128-bit item id in lower-case base32. Ids carry
+// no information about the item, and are safe as blob names and in URLs.
 func (v *vault) newID() string {
-	return fmt.Sprintf("%d", time.Now().UnixNano())
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return strings.ToLower(idEncoding.EncodeToString(b))
 }
 
+var idEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
 func (v *vault) dekKey(dek []byte) []byte { return dek }
 
 func zero32(x *[32]byte) {
@@ -200,15 +332,3 @@ func zero32(x *[32]byte) {
 		x[i] = 0
 	}
 }
-
-func (v *vault) DeleteItem(ctx context.Context, id string) error {
-	if !v.unlocked {
-		return ErrNotUnlocked
-	}
-	delete(v.kd.Items, id)
-	if v.store != nil {
-		_ = v.store.Delete(ctx, id)
-	}
-	delete(v.meta, id)
-	return v.flushKD()
-}
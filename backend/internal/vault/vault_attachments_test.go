@@ -0,0 +1,145 @@
+package vault
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"path/filepath"
+	"testing"
+
+	"project-crypto/internal/storage"
+)
+
+func TestAttachmentLifecycle(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	blobs := storage.NewFileBlobStore(filepath.Join(dir, "blobs"))
+	vpath := filepath.Join(dir, "vault.vlt")
+	master := randomBytes(t, 32)
+	v := createFastVault(t, vpath, blobs, master)
+
+	id, err := v.AddItem(ctx, Item{Type: "login", Fields: map[string]string{"password": "p"}})
+	if err != nil {
+		t.Fatalf("add item: %v", err)
+	}
+	data := randomBytes(t, 4096)
+	att, err := v.AddAttachment(ctx, id, "recovery.pdf", "application/pdf", bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("add attachment: %v", err)
+	}
+	if att.Size != int64(len(data)) || att.Name != "recovery.pdf" {
+		t.Fatalf("unexpected attachment meta: %+v", att)
+	}
+	if !v.(*vault).kd.Items[id].Attachments[att.ID].Chunked {
+		t.Fatal("expected attachment to use the chunked stream format")
+	}
+	stored, _ := blobs.Get(ctx, attachmentBlobID(id, att.ID))
+	if bytes.Contains(stored, data[:64]) {
+		t.Fatal("attachment stored in plaintext")
+	}
+
+	if err := v.Rekey(ctx); err != nil {
+		t.Fatalf("rekey: %v", err)
+	}
+	v.Lock()
+	v = NewWithStores(vpath, blobs, nil)
+	if err := v.Unlock(ctx, master); err != nil {
+		t.Fatalf("unlock: %v", err)
+	}
+
+	atts, err := v.ListAttachments(ctx, id)
+	if err != nil || len(atts) != 1 || atts[0].ID != att.ID {
+		t.Fatalf("list attachments = %+v, %v", atts, err)
+	}
+	var out bytes.Buffer
+	if _, err := v.ReadAttachment(ctx, id, att.ID, &out); err != nil {
+		t.Fatalf("read attachment: %v", err)
+	}
+	if !bytes.Equal(out.Bytes(), data) {
+		t.Fatal("attachment contents changed")
+	}
+
+	if err := v.DeleteAttachment(ctx, id, att.ID); err != nil {
+		t.Fatalf("delete attachment: %v", err)
+	}
+	if _, err := v.ReadAttachment(ctx, id, att.ID, &out); !errors.Is(err, ErrAttachmentNotFound) {
+		t.Fatalf("expected ErrAttachmentNotFound, got %v", err)
+	}
+	if _, err := blobs.Get(ctx, attachmentBlobID(id, att.ID)); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("expected attachment blob to be deleted, got %v", err)
+	}
+}
+
+func TestAttachmentLimits(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	blobs := storage.NewFileBlobStore(filepath.Join(dir, "blobs"))
+	v := createFastVault(t, filepath.Join(dir, "vault.vlt"), blobs, randomBytes(t, 32))
+
+	p := v.Policy()
+	p.MaxAttachmentSize = 100
+	p.MaxItemAttachmentBytes = 150
+	if err := v.SetPolicy(ctx, p); err != nil {
+		t.Fatalf("set policy: %v", err)
+	}
+	id, err := v.AddItem(ctx, Item{Type: "login", Fields: map[string]string{"password": "p"}})
+	if err != nil {
+		t.Fatalf("add item: %v", err)
+	}
+	if _, err := v.AddAttachment(ctx, id, "big", "", bytes.NewReader(make([]byte, 101))); !errors.Is(err, ErrAttachmentTooLarge) {
+		t.Fatalf("expected ErrAttachmentTooLarge, got %v", err)
+	}
+	if _, err := v.AddAttachment(ctx, id, "a", "", bytes.NewReader(make([]byte, 100))); err != nil {
+		t.Fatalf("add attachment: %v", err)
+	}
+	if _, err := v.AddAttachment(ctx, id, "b", "", bytes.NewReader(make([]byte, 60))); !errors.Is(err, ErrAttachmentTooLarge) {
+		t.Fatalf("expected per-item limit, got %v", err)
+	}
+
+	att, err := v.AddAttachment(ctx, id, "c", "", bytes.NewReader(make([]byte, 50)))
+	if err != nil {
+		t.Fatalf("add attachment within limit: %v", err)
+	}
+	if err := v.DeleteItem(ctx, id, 0); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if err := v.Purge(ctx, id); err != nil {
+		t.Fatalf("purge: %v", err)
+	}
+	if _, err := blobs.Get(ctx, attachmentBlobID(id, att.ID)); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("expected purge to delete attachment blobs, got %v", err)
+	}
+}
+
+func TestAddAttachmentDoesNotHoldLockWhileReading(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	blobs := storage.NewFileBlobStore(filepath.Join(dir, "blobs"))
+	v := createFastVault(t, filepath.Join(dir, "vault.vlt"), blobs, randomBytes(t, 32))
+	id, err := v.AddItem(ctx, Item{Type: "login", Fields: map[string]string{"password": "p"}})
+	if err != nil {
+		t.Fatalf("add item: %v", err)
+	}
+
+	pr, pw := io.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		_, err := v.AddAttachment(ctx, id, "slow.bin", "", pr)
+		done <- err
+	}()
+	if _, err := pw.Write([]byte("first part")); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	// The upload is still open; other calls, writes included, go ahead.
+	if err := v.UpdateItem(ctx, id, Item{Fields: map[string]string{"password": "q"}}); err != nil {
+		t.Fatalf("update during upload: %v", err)
+	}
+	_ = pw.Close()
+	if err := <-done; err != nil {
+		t.Fatalf("add attachment: %v", err)
+	}
+	if atts, _ := v.ListAttachments(ctx, id); len(atts) != 1 || atts[0].Size != int64(len("first part")) {
+		t.Fatalf("unexpected attachments: %+v", atts)
+	}
+}
@@ -0,0 +1,182 @@
+package vault
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	cr "project-crypto/internal/crypto"
+	"project-crypto/internal/storage"
+)
+
+func TestBackupRestore(t *testing.T) {
+	useFastKDF(t)
+	ctx := context.Background()
+	dir := t.TempDir()
+	master := randomBytes(t, 32)
+	metas := memMetaStore{}
+	v := NewWithStores(filepath.Join(dir, "vault.vlt"), storage.NewFileBlobStore(filepath.Join(dir, "blobs")), metas)
+	if err := v.Create(ctx, master); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	id, err := v.AddItem(ctx, Item{Type: "login", Fields: map[string]string{"site": "a.example", "password": "one"}})
+	if err != nil {
+		t.Fatalf("add item: %v", err)
+	}
+	if err := v.UpdateItem(ctx, id, Item{Type: "login", Fields: map[string]string{"site": "a.example", "password": "two"}}); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	att, err := v.AddAttachment(ctx, id, "key.pem", "text/plain", strings.NewReader("attached"))
+	if err != nil {
+		t.Fatalf("attach: %v", err)
+	}
+	trashed, err := v.AddItem(ctx, Item{Type: "note", Fields: map[string]string{"notes": "old"}})
+	if err != nil {
+		t.Fatalf("add item: %v", err)
+	}
+	if err := v.DeleteItem(ctx, trashed, 0); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+
+	passphrase := []byte("separate backup passphrase")
+	var archive bytes.Buffer
+	man, err := v.Backup(ctx, &archive, passphrase)
+	if err != nil {
+		t.Fatalf("backup: %v", err)
+	}
+	if man.Items != 2 || man.Blobs != 4 {
+		t.Fatalf("manifest counts items=%d blobs=%d, want 2 and 4", man.Items, man.Blobs)
+	}
+	if bytes.Contains(archive.Bytes(), []byte("a.example")) || bytes.Contains(archive.Bytes(), []byte(id)) {
+		t.Fatal("archive is not encrypted")
+	}
+
+	if _, _, err := ReadBackup(bytes.NewReader(archive.Bytes()), []byte("wrong")); !errors.Is(err, ErrBadBackup) {
+		t.Fatalf("wrong passphrase: %v", err)
+	}
+	damaged := append([]byte(nil), archive.Bytes()...)
+	damaged[len(damaged)/2] ^= 1
+	if _, _, err := ReadBackup(bytes.NewReader(damaged), passphrase); !errors.Is(err, ErrBadBackup) {
+		t.Fatalf("damaged archive: %v", err)
+	}
+	if _, _, err := ReadBackup(bytes.NewReader(archive.Bytes()[:archive.Len()-20]), passphrase); !errors.Is(err, ErrBadBackup) {
+		t.Fatalf("truncated archive: %v", err)
+	}
+
+	rdir := t.TempDir()
+	rpath := filepath.Join(rdir, "vault.vlt")
+	rblobs := storage.NewFileBlobStore(filepath.Join(rdir, "blobs"))
+	rmetas := memMetaStore{}
+	if _, err := Restore(ctx, bytes.NewReader(archive.Bytes()), passphrase, rpath, rblobs, rmetas, false); err != nil {
+		t.Fatalf("restore: %v", err)
+	}
+	if _, err := Restore(ctx, bytes.NewReader(archive.Bytes()), passphrase, rpath, rblobs, rmetas, false); err == nil {
+		t.Fatal("restore over an existing vault without overwrite")
+	}
+	if len(rmetas) != 2 {
+		t.Fatalf("restored %d meta documents, want 2", len(rmetas))
+	}
+
+	r := NewWithStores(rpath, rblobs, rmetas)
+	if err := r.Unlock(ctx, master); err != nil {
+		t.Fatalf("unlock restored vault: %v", err)
+	}
+	if it, err := r.GetItem(ctx, id); err != nil || it.Fields["password"] != "two" {
+		t.Fatalf("restored item: %+v, %v", it, err)
+	}
+	if prev, err := r.GetRevision(ctx, id, 1); err != nil || prev.Fields["password"] != "one" {
+		t.Fatalf("restored revision: %+v, %v", prev, err)
+	}
+	var buf bytes.Buffer
+	if _, err := r.ReadAttachment(ctx, id, att.ID, &buf); err != nil || buf.String() != "attached" {
+		t.Fatalf("restored attachment: %q, %v", buf.String(), err)
+	}
+	if trash, _ := r.ListTrash(ctx); len(trash) != 1 || trash[0].ID != trashed {
+		t.Fatalf("restored trash: %+v", trash)
+	}
+}
+
+func TestCheckManifest(t *testing.T) {
+	useFastKDF(t)
+	ctx := context.Background()
+	dir := t.TempDir()
+	v := createFastVault(t, filepath.Join(dir, "vault.vlt"), storage.NewFileBlobStore(filepath.Join(dir, "blobs")), randomBytes(t, 32))
+	if _, err := v.AddItem(ctx, Item{Type: "note", Fields: map[string]string{"notes": "x"}}); err != nil {
+		t.Fatal(err)
+	}
+	var archive bytes.Buffer
+	if _, err := v.Backup(ctx, &archive, []byte("pw")); err != nil {
+		t.Fatal(err)
+	}
+	man, entries, err := ReadBackup(&archive, []byte("pw"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	extra := map[string][]byte{"blobs/extra": nil}
+	for k, b := range entries {
+		extra[k] = b
+	}
+	if err := checkManifest(man, extra); !errors.Is(err, ErrBadBackup) {
+		t.Fatalf("unlisted entry: %v", err)
+	}
+	for name := range entries {
+		if !strings.HasPrefix(name, backupBlobPrefix) {
+			continue
+		}
+		entries[name] = append(entries[name], 0)
+		if err := checkManifest(man, entries); !errors.Is(err, ErrBadBackup) {
+			t.Fatalf("modified %s: %v", name, err)
+		}
+	}
+	man.Entries[len(man.Entries)-1].Name = "blobs/../escape"
+	if err := checkManifest(man, entries); !errors.Is(err, ErrBadBackup) {
+		t.Fatalf("bad name: %v", err)
+	}
+}
+
+func TestReadBackupBounds(t *testing.T) {
+	useFastKDF(t)
+	fast := defaultKDF()
+	k := KDFHeader{Algo: "argon2id", M: fast.M, T: fast.T, P: fast.P, Salt: fast.Salt}
+
+	for name, mod := range map[string]func(*KDFHeader){
+		"memory":  func(k *KDFHeader) { k.M = backupMaxKDFM + 1 },
+		"weak":    func(k *KDFHeader) { k.M = 64 },
+		"passes":  func(k *KDFHeader) { k.T = backupMaxKDFT + 1 },
+		"lanes":   func(k *KDFHeader) { k.P = 0 },
+		"no salt": func(k *KDFHeader) { k.Salt = nil },
+	} {
+		bad := k
+		mod(&bad)
+		archive := append(backupPrefix(bad), make([]byte, 64)...)
+		if _, _, err := ReadBackup(bytes.NewReader(archive), []byte("pw")); !errors.Is(err, ErrBadBackup) || !strings.Contains(err.Error(), "out of range") {
+			t.Fatalf("%s: expected the kdf to be refused, got %v", name, err)
+		}
+	}
+
+	// Only the tar header of the entry is written: the reader must refuse
+	// it before looking for the body.
+	var archive bytes.Buffer
+	prefix := backupPrefix(k)
+	archive.Write(prefix)
+	key := cr.DeriveKEK([]byte("pw"), fast)
+	sw, err := cr.NewStreamWriter(&archive, key[:], prefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	huge := &tar.Header{Name: backupHeaderEntry, Mode: 0o600, Size: backupMaxEntry + 1}
+	if err := tar.NewWriter(sw).WriteHeader(huge); err != nil {
+		t.Fatal(err)
+	}
+	if err := sw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := ReadBackup(&archive, []byte("pw")); !errors.Is(err, ErrBadBackup) || !strings.Contains(err.Error(), "too large") {
+		t.Fatalf("expected an oversized entry to be refused, got %v", err)
+	}
+}
@@ -0,0 +1,105 @@
+package vault
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"project-crypto/internal/storage"
+)
+
+func TestConcurrentUpdates(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	vpath := filepath.Join(dir, "vault.vlt")
+	blobs := storage.NewFileBlobStore(filepath.Join(dir, "blobs"))
+	master := randomBytes(t, 32)
+	v := createFastVault(t, vpath, blobs, master)
+
+	const n = 8
+	ids := make([]string, n)
+	for i := range ids {
+		id, err := v.AddItem(ctx, Item{Type: "login", Fields: map[string]string{"password": "p0"}})
+		if err != nil {
+			t.Fatalf("add item: %v", err)
+		}
+		ids[i] = id
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 4*n)
+	for i := 0; i < n; i++ {
+		for round := 1; round <= 3; round++ {
+			wg.Add(1)
+			go func(id string, round int) {
+				defer wg.Done()
+				errs <- v.UpdateItem(ctx, id, Item{Type: "login", Fields: map[string]string{"password": fmt.Sprintf("p%d", round)}})
+			}(ids[i], round)
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := v.List(ctx, Query{})
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("concurrent op: %v", err)
+		}
+	}
+
+	v.Lock()
+	if err := v.Unlock(ctx, master); err != nil {
+		t.Fatalf("unlock: %v", err)
+	}
+	for _, id := range ids {
+		it, err := v.GetItem(ctx, id)
+		if err != nil {
+			t.Fatalf("get %s after reopen: %v", id, err)
+		}
+		if it.Version != 4 {
+			t.Fatalf("item %s at version %d, want 4", id, it.Version)
+		}
+	}
+}
+
+func TestVersionConflict(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	blobs := storage.NewFileBlobStore(filepath.Join(dir, "blobs"))
+	v := createFastVault(t, filepath.Join(dir, "vault.vlt"), blobs, randomBytes(t, 32))
+
+	id, err := v.AddItem(ctx, Item{Type: "login", Fields: map[string]string{"password": "one"}})
+	if err != nil {
+		t.Fatalf("add item: %v", err)
+	}
+	a, _ := v.GetItem(ctx, id)
+	b, _ := v.GetItem(ctx, id)
+	if a.Version != 1 {
+		t.Fatalf("version %d, want 1", a.Version)
+	}
+
+	a.Fields["password"] = "two"
+	if err := v.UpdateItem(ctx, id, a); err != nil {
+		t.Fatalf("first update: %v", err)
+	}
+	b.Fields["password"] = "three"
+	if err := v.UpdateItem(ctx, id, b); !errors.Is(err, ErrConflict) {
+		t.Fatalf("stale update: %v, want ErrConflict", err)
+	}
+	if err := v.DeleteItem(ctx, id, 1); !errors.Is(err, ErrConflict) {
+		t.Fatalf("stale delete: %v, want ErrConflict", err)
+	}
+	if got, _ := v.GetItem(ctx, id); got.Fields["password"] != "two" || got.Version != 2 {
+		t.Fatalf("item after conflicts = %+v", got)
+	}
+	if err := v.DeleteItem(ctx, id, 2); err != nil {
+		t.Fatalf("delete at current version: %v", err)
+	}
+}
@@ -0,0 +1,81 @@
+package vault
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"project-crypto/internal/storage"
+)
+
+func TestCustomFields(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	blobs := storage.NewFileBlobStore(filepath.Join(dir, "blobs"))
+	v := createFastVault(t, filepath.Join(dir, "vault.vlt"), blobs, randomBytes(t, 32))
+
+	bad := []CustomField{
+		{Name: "", Value: "x"},
+		{Name: "a", Kind: "color", Value: "red"},
+		{Name: "site", Kind: KindURL, Value: "example.com"},
+		{Name: "due", Kind: KindDate, Value: "tomorrow"},
+		{Name: "otp", Kind: KindTOTP, Value: "not base32!"},
+	}
+	for _, f := range bad {
+		it := Item{Type: "login", Fields: map[string]string{"password": "pw"}, Custom: []CustomField{f}}
+		if _, err := v.AddItem(ctx, it); !errors.Is(err, ErrInvalidItem) {
+			t.Errorf("%+v: expected ErrInvalidItem, got %v", f, err)
+		}
+	}
+	dup := Item{Type: "login", Fields: map[string]string{"password": "pw"}, Custom: []CustomField{{Name: "a"}, {Name: "a"}}}
+	if _, err := v.AddItem(ctx, dup); !errors.Is(err, ErrInvalidItem) {
+		t.Errorf("duplicate names: expected ErrInvalidItem, got %v", err)
+	}
+
+	custom := []CustomField{
+		{Name: "pin", Kind: KindHidden, Value: "1234"},
+		{Name: "portal", Kind: KindURL, Value: "https://example.com/login"},
+		{Name: "otp", Kind: KindTOTP, Value: "JBSWY3DPEHPK3PXP"},
+		{Name: "memo", Value: "plain"},
+	}
+	id, err := v.AddItem(ctx, Item{Type: "login", Fields: map[string]string{"password": "pw"}, Custom: custom})
+	if err != nil {
+		t.Fatalf("add item: %v", err)
+	}
+	it, err := v.GetItem(ctx, id)
+	if err != nil {
+		t.Fatalf("get item: %v", err)
+	}
+	if len(it.Custom) != 4 || it.Custom[0].Name != "pin" || it.Custom[3].Name != "memo" {
+		t.Fatalf("custom fields lost their order: %+v", it.Custom)
+	}
+	if !it.Custom[0].Sensitive || !it.Custom[2].Sensitive || it.Custom[1].Sensitive || it.Custom[3].Kind != KindText {
+		t.Fatalf("unexpected kinds or sensitivity: %+v", it.Custom)
+	}
+
+	if err := v.UpdateItem(ctx, id, Item{Fields: map[string]string{"password": "pw2"}}); err != nil {
+		t.Fatalf("update without custom: %v", err)
+	}
+	it, _ = v.GetItem(ctx, id)
+	if len(it.Custom) != 4 {
+		t.Fatalf("nil Custom should keep custom fields, got %+v", it.Custom)
+	}
+
+	if err := v.UpdateItem(ctx, id, Item{Fields: map[string]string{"password": "pw2"}, Custom: []CustomField{}}); err != nil {
+		t.Fatalf("update clearing custom: %v", err)
+	}
+	it, _ = v.GetItem(ctx, id)
+	if len(it.Custom) != 0 {
+		t.Fatalf("empty Custom should clear custom fields, got %+v", it.Custom)
+	}
+
+	prev, err := v.GetRevision(ctx, id, 2)
+	if err != nil {
+		t.Fatalf("get revision: %v", err)
+	}
+	changes := Diff(prev, it)
+	if len(changes) != 4 || changes[0].Field != "custom.pin" || changes[0].Old != "1234" {
+		t.Fatalf("unexpected diff: %+v", changes)
+	}
+}
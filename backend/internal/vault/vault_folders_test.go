@@ -0,0 +1,165 @@
+package vault
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"project-crypto/internal/storage"
+)
+
+func TestFoldersTagsAndFavorites(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	blobs := storage.NewFileBlobStore(filepath.Join(dir, "blobs"))
+	vpath := filepath.Join(dir, "vault.vlt")
+	master := randomBytes(t, 32)
+	v := createFastVault(t, vpath, blobs, master)
+
+	work, err := v.CreateFolder(ctx, "Work", "")
+	if err != nil {
+		t.Fatalf("create folder: %v", err)
+	}
+	infra, err := v.CreateFolder(ctx, "Infra", work.ID)
+	if err != nil {
+		t.Fatalf("create subfolder: %v", err)
+	}
+	if _, err := v.CreateFolder(ctx, "Orphan", "missing"); !errors.Is(err, ErrFolderNotFound) {
+		t.Fatalf("expected ErrFolderNotFound, got %v", err)
+	}
+	if _, err := v.UpdateFolder(ctx, work.ID, "", &infra.ID); err == nil {
+		t.Fatal("moving a folder under its own child should fail")
+	}
+
+	add := func(o Organization) string {
+		id, err := v.AddItem(ctx, Item{Type: "login", Fields: map[string]string{"password": "pw"}})
+		if err != nil {
+			t.Fatalf("add item: %v", err)
+		}
+		if err := v.Organize(ctx, id, o, 0); err != nil {
+			t.Fatalf("organize: %v", err)
+		}
+		return id
+	}
+	yes := true
+	a := add(Organization{Folder: &work.ID, Tags: []string{"prod", " team ", "prod"}})
+	b := add(Organization{Folder: &infra.ID, Tags: []string{"prod"}, Favorite: &yes})
+	c := add(Organization{})
+
+	ids := func(q Query) []string {
+		metas, err := v.List(ctx, q)
+		if err != nil {
+			t.Fatalf("list %+v: %v", q, err)
+		}
+		var out []string
+		for _, m := range metas {
+			out = append(out, m.ID)
+		}
+		return out
+	}
+	check := func(q Query, want ...string) {
+		t.Helper()
+		got := ids(q)
+		if len(got) != len(want) {
+			t.Fatalf("%+v: got %v, want %v", q, got, want)
+		}
+		set := map[string]bool{}
+		for _, id := range got {
+			set[id] = true
+		}
+		for _, id := range want {
+			if !set[id] {
+				t.Fatalf("%+v: got %v, want %v", q, got, want)
+			}
+		}
+	}
+	check(Query{}, a, b, c)
+	check(Query{Folder: work.ID}, a)
+	check(Query{Folder: work.ID, Subfolders: true}, a, b)
+	check(Query{Tags: []string{"prod"}}, a, b)
+	check(Query{Tags: []string{"prod", "team"}}, a)
+	check(Query{Favorite: true}, b)
+
+	metas, _ := v.List(ctx, Query{Folder: work.ID})
+	if got := metas[0].Tags; len(got) != 2 || got[0] != "prod" || got[1] != "team" {
+		t.Fatalf("tags not normalized: %v", got)
+	}
+
+	// Organization lives in the encrypted key directory only.
+	raw, err := os.ReadFile(vpath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{"Work", "Infra", "prod"} {
+		if bytes.Contains(raw, []byte(s)) {
+			t.Fatalf("%q found in plaintext header", s)
+		}
+	}
+
+	v.Lock()
+	v = NewWithStores(vpath, blobs, nil)
+	if err := v.Unlock(ctx, master); err != nil {
+		t.Fatalf("unlock: %v", err)
+	}
+	check(Query{Folder: work.ID, Subfolders: true}, a, b)
+
+	if err := v.DeleteFolder(ctx, work.ID); err != nil {
+		t.Fatalf("delete folder: %v", err)
+	}
+	folders, _ := v.ListFolders(ctx)
+	if len(folders) != 1 || folders[0].ID != infra.ID || folders[0].Parent != "" {
+		t.Fatalf("subfolder not reparented: %+v", folders)
+	}
+	check(Query{Folder: infra.ID}, b)
+	metas, _ = v.List(ctx, Query{})
+	for _, m := range metas {
+		if m.ID == a && m.Folder != "" {
+			t.Fatalf("item not moved to parent: %+v", m)
+		}
+	}
+
+	if err := v.Rekey(ctx); err != nil {
+		t.Fatalf("rekey: %v", err)
+	}
+	check(Query{Favorite: true, Folder: infra.ID}, b)
+}
+
+func TestAddItemsAndOrganizeChecks(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	blobs := storage.NewFileBlobStore(filepath.Join(dir, "blobs"))
+	v := createFastVault(t, filepath.Join(dir, "vault.vlt"), blobs, randomBytes(t, 32))
+
+	work, err := v.CreateFolder(ctx, "Work", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	missing := "missing"
+	login := Item{Type: "login", Fields: map[string]string{"password": "pw"}}
+	batch := []NewItem{{Item: login, Organization: Organization{Folder: &work.ID}}, {Item: login, Organization: Organization{Folder: &missing}}}
+	if _, err := v.AddItems(ctx, batch); !errors.Is(err, ErrFolderNotFound) {
+		t.Fatalf("expected ErrFolderNotFound, got %v", err)
+	}
+	if metas, _ := v.List(ctx, Query{}); len(metas) != 0 {
+		t.Fatalf("a rejected batch left items behind: %+v", metas)
+	}
+
+	ids, err := v.AddItems(ctx, batch[:1])
+	if err != nil || len(ids) != 1 {
+		t.Fatalf("add items: %v, %v", ids, err)
+	}
+	if metas, _ := v.List(ctx, Query{Folder: work.ID}); len(metas) != 1 || metas[0].ID != ids[0] {
+		t.Fatalf("added item not filed: %+v", metas)
+	}
+
+	yes := true
+	if err := v.Organize(ctx, ids[0], Organization{Favorite: &yes}, 2); !errors.Is(err, ErrConflict) {
+		t.Fatalf("expected ErrConflict for a stale version, got %v", err)
+	}
+	if err := v.Organize(ctx, ids[0], Organization{Favorite: &yes}, 1); err != nil {
+		t.Fatalf("organize at the current version: %v", err)
+	}
+}
@@ -0,0 +1,90 @@
+package vault
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"project-crypto/internal/storage"
+)
+
+func TestContainerRoundTrip(t *testing.T) {
+	h := Header{
+		Version:  formatVersion,
+		KDF:      KDFHeader{Algo: "argon2id", M: 64 * 1024, T: 3, P: 4, Salt: []byte("0123456789abcdef")},
+		VRKWrap:  []byte("wrapped-vrk"),
+		KDCipher: []byte("sealed-kd"),
+		Padding:  []byte{0, 0, 0},
+	}
+	b, err := encodeHeader(h)
+	if err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	if !bytes.HasPrefix(b, containerMagic) {
+		t.Fatal("expected container magic")
+	}
+	got, err := decodeHeader(b)
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if got.Version != h.Version || got.KDF.M != h.KDF.M || !bytes.Equal(got.KDF.Salt, h.KDF.Salt) ||
+		!bytes.Equal(got.VRKWrap, h.VRKWrap) || !bytes.Equal(got.KDCipher, h.KDCipher) || !bytes.Equal(got.Padding, h.Padding) {
+		t.Fatalf("round trip mismatch: %+v", got)
+	}
+
+	for _, n := range []int{5, containerPrefixLen + 4, len(b) - 1} {
+		if _, err := decodeHeader(b[:n]); !errors.Is(err, ErrBadContainer) {
+			t.Fatalf("truncated to %d: expected ErrBadContainer, got %v", n, err)
+		}
+	}
+}
+
+func TestUnlockMigratesJSONHeader(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	blobs := storage.NewFileBlobStore(filepath.Join(dir, "blobs"))
+	vpath := filepath.Join(dir, "vault.vlt")
+	master := randomBytes(t, 32)
+	v := createFastVault(t, vpath, blobs, master)
+	id, err := v.AddItem(ctx, Item{Type: "login", Fields: map[string]string{"password": "p"}})
+	if err != nil {
+		t.Fatalf("add item: %v", err)
+	}
+
+	// Rewrite the file the way version 2 builds stored it.
+	h, err := readHeader(vpath)
+	if err != nil {
+		t.Fatalf("read header: %v", err)
+	}
+	h.Version = formatVersionJSON
+	legacy, _ := json.MarshalIndent(h, "", "  ")
+	if err := os.WriteFile(vpath, legacy, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	v = NewWithStores(vpath, blobs, nil)
+	if err := v.Unlock(ctx, master); err != nil {
+		t.Fatalf("unlock: %v", err)
+	}
+	if got := v.LastUnlock().MigratedFrom; got != formatVersionJSON {
+		t.Fatalf("MigratedFrom = %d", got)
+	}
+	if _, err := v.GetItem(ctx, id); err != nil {
+		t.Fatalf("get item: %v", err)
+	}
+
+	info, err := Inspect(vpath)
+	if err != nil {
+		t.Fatalf("inspect: %v", err)
+	}
+	if info.Encoding != "container" || info.Version != formatVersion || len(info.Sections) < 3 {
+		t.Fatalf("unexpected inspect result: %+v", info)
+	}
+	if info.KDF.Algo != "argon2id" || info.KDF.SaltLen == 0 || info.KDCipherLen == 0 {
+		t.Fatalf("unexpected kdf info: %+v", info)
+	}
+}
@@ -0,0 +1,71 @@
+package vault
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"project-crypto/internal/storage"
+)
+
+func TestHealth(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	blobs := storage.NewFileBlobStore(filepath.Join(dir, "blobs"))
+	v := createFastVault(t, filepath.Join(dir, "vault.vlt"), blobs, randomBytes(t, 32))
+
+	add := func(site, pw string) string {
+		id, err := v.AddItem(ctx, Item{Type: "login", Fields: map[string]string{"site": site, "password": pw}})
+		if err != nil {
+			t.Fatalf("add item: %v", err)
+		}
+		return id
+	}
+	weak := add("a.example", "password1")
+	shared1 := add("b.example", "xK9#mQ2$vL7@nR4p")
+	shared2 := add("c.example", "xK9#mQ2$vL7@nR4p")
+	old := add("d.example", "Zzq8!vLm2#Rt-walrus")
+	if _, err := v.AddItem(ctx, Item{Type: "note", Fields: map[string]string{"notes": "no password here"}}); err != nil {
+		t.Fatalf("add note: %v", err)
+	}
+	trashed := add("e.example", "password1")
+	if err := v.DeleteItem(ctx, trashed, 0); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+
+	vv := v.(*vault)
+	m := vv.meta[old]
+	m.Updated = time.Now().Add(-400 * 24 * time.Hour).Unix()
+	vv.meta[old] = m
+
+	r, err := v.Health(ctx)
+	if err != nil {
+		t.Fatalf("health: %v", err)
+	}
+	if r.Checked != 4 {
+		t.Fatalf("checked %d items, want 4", r.Checked)
+	}
+	if len(r.Weak) != 1 || r.Weak[0].ID != weak || r.Weak[0].Warning == "" {
+		t.Fatalf("weak = %+v", r.Weak)
+	}
+	if len(r.Reused) != 1 || len(r.Reused[0]) != 2 {
+		t.Fatalf("reused = %+v", r.Reused)
+	}
+	got := map[string]bool{r.Reused[0][0].ID: true, r.Reused[0][1].ID: true}
+	if !got[shared1] || !got[shared2] {
+		t.Fatalf("reused group %+v, want %s and %s", r.Reused[0], shared1, shared2)
+	}
+	if len(r.Stale) != 1 || r.Stale[0].ID != old || r.Stale[0].AgeDays < 399 {
+		t.Fatalf("stale = %+v", r.Stale)
+	}
+
+	p := v.Policy()
+	p.PasswordMaxAge = -1
+	if err := v.SetPolicy(ctx, p); err != nil {
+		t.Fatal(err)
+	}
+	if r, _ := v.Health(ctx); len(r.Stale) != 0 {
+		t.Fatalf("stale check not disabled: %+v", r.Stale)
+	}
+}
@@ -0,0 +1,79 @@
+package vault
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"project-crypto/internal/storage"
+)
+
+func TestHistoryRestoreAndRetention(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	blobs := storage.NewFileBlobStore(filepath.Join(dir, "blobs"))
+	v := NewWithStores(filepath.Join(dir, "vault.vlt"), blobs, nil)
+	if err := v.Create(ctx, randomBytes(t, 32)); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	p := v.Policy()
+	p.HistoryMaxRevisions = 2
+	if err := v.SetPolicy(ctx, p); err != nil {
+		t.Fatalf("set policy: %v", err)
+	}
+
+	login := func(pw string) Item {
+		return Item{Type: "login", Fields: map[string]string{"site": "example.com", "password": pw}}
+	}
+	id, err := v.AddItem(ctx, login("one"))
+	if err != nil {
+		t.Fatalf("add item: %v", err)
+	}
+	for _, pw := range []string{"two", "three", "four"} {
+		if err := v.UpdateItem(ctx, id, login(pw)); err != nil {
+			t.Fatalf("update item: %v", err)
+		}
+	}
+
+	revs, err := v.History(ctx, id)
+	if err != nil {
+		t.Fatalf("history: %v", err)
+	}
+	if len(revs) != 3 || revs[0].Version != 4 || revs[2].Version != 2 {
+		t.Fatalf("unexpected history: %+v", revs)
+	}
+	if _, err := v.GetRevision(ctx, id, 1); err == nil {
+		t.Fatal("expected version 1 to be pruned")
+	}
+	if _, err := blobs.Get(ctx, revisionBlobID(id, 1)); err != storage.ErrNotFound {
+		t.Fatalf("expected pruned revision blob to be deleted, got %v", err)
+	}
+
+	old, err := v.GetRevision(ctx, id, 2)
+	if err != nil {
+		t.Fatalf("get revision: %v", err)
+	}
+	cur, err := v.GetItem(ctx, id)
+	if err != nil {
+		t.Fatalf("get item: %v", err)
+	}
+	changes := Diff(old, cur)
+	if len(changes) != 1 || changes[0].Field != "fields.password" || changes[0].Old != "two" || changes[0].New != "four" {
+		t.Fatalf("unexpected diff: %+v", changes)
+	}
+
+	if err := v.RestoreRevision(ctx, id, 2); err != nil {
+		t.Fatalf("restore: %v", err)
+	}
+	got, err := v.GetItem(ctx, id)
+	if err != nil {
+		t.Fatalf("get item after restore: %v", err)
+	}
+	if got.Fields["password"] != "two" {
+		t.Fatalf("expected restored password, got %q", got.Fields["password"])
+	}
+	revs, _ = v.History(ctx, id)
+	if revs[0].Version != 5 {
+		t.Fatalf("expected restore to create version 5, got %+v", revs)
+	}
+}
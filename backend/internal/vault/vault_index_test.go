@@ -0,0 +1,80 @@
+package vault
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"project-crypto/internal/storage"
+)
+
+func TestListSurvivesReopen(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	blobs := storage.NewFileBlobStore(filepath.Join(dir, "blobs"))
+	vpath := filepath.Join(dir, "vault.vlt")
+	master := randomBytes(t, 32)
+
+	v := NewWithStores(vpath, blobs, nil)
+	if err := v.Create(ctx, master); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	id, err := v.AddItem(ctx, Item{Type: "login", Fields: map[string]string{"password": "secret"}})
+	if err != nil {
+		t.Fatalf("add item: %v", err)
+	}
+	if err := v.UpdateItem(ctx, id, Item{Type: "login", Fields: map[string]string{"password": "secret2"}}); err != nil {
+		t.Fatalf("update item: %v", err)
+	}
+	v.Lock()
+
+	v2 := NewWithStores(vpath, blobs, nil)
+	if err := v2.Unlock(ctx, master); err != nil {
+		t.Fatalf("unlock: %v", err)
+	}
+	metas, err := v2.List(ctx, Query{Type: "login"})
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	if len(metas) != 1 || metas[0].ID != id {
+		t.Fatalf("expected item %s after reopen, got %+v", id, metas)
+	}
+	if metas[0].Version != 2 || metas[0].Created == 0 {
+		t.Fatalf("unexpected meta after reopen: %+v", metas[0])
+	}
+}
+
+func TestUnlockRebuildsMissingIndex(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	blobs := storage.NewFileBlobStore(filepath.Join(dir, "blobs"))
+	vpath := filepath.Join(dir, "vault.vlt")
+	master := randomBytes(t, 32)
+
+	v := NewWithStores(vpath, blobs, nil)
+	if err := v.Create(ctx, master); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	id, err := v.AddItem(ctx, Item{Type: "login", Fields: map[string]string{"password": "secret"}})
+	if err != nil {
+		t.Fatalf("add item: %v", err)
+	}
+	typed := v.(*vault)
+	typed.meta = make(map[string]ItemMeta)
+	if err := typed.flushKD(); err != nil {
+		t.Fatalf("flush: %v", err)
+	}
+	v.Lock()
+
+	v2 := NewWithStores(vpath, blobs, nil)
+	if err := v2.Unlock(ctx, master); err != nil {
+		t.Fatalf("unlock: %v", err)
+	}
+	metas, err := v2.List(ctx, Query{})
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	if len(metas) != 1 || metas[0].ID != id || metas[0].Type != "login" {
+		t.Fatalf("expected rebuilt index entry for %s, got %+v", id, metas)
+	}
+}
@@ -0,0 +1,100 @@
+package vault
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"slices"
+	"sort"
+	"testing"
+
+	"project-crypto/internal/storage"
+)
+
+type memMetaStore map[string]storage.ItemMeta
+
+func (m memMetaStore) PutMeta(_ context.Context, meta storage.ItemMeta) error {
+	m[meta.ID] = meta
+	return nil
+}
+
+// ListMeta mirrors the Mongo query: filters, then (sort key, id) order,
+// then the keyset cursor and limit.
+func (m memMetaStore) ListMeta(_ context.Context, q storage.MetaQuery) ([]storage.ItemMeta, error) {
+	key := func(meta storage.ItemMeta) int64 {
+		if q.Sort == "created" {
+			return meta.Created
+		}
+		return meta.Updated
+	}
+	less := func(a, b storage.ItemMeta) bool {
+		if key(a) != key(b) {
+			return key(a) < key(b) != q.Desc
+		}
+		return a.ID != b.ID && a.ID < b.ID != q.Desc
+	}
+	var out []storage.ItemMeta
+	for _, meta := range m {
+		switch {
+		case meta.Deleted != 0,
+			len(q.Types) > 0 && !slices.Contains(q.Types, meta.Type),
+			q.UpdatedSince != 0 && meta.Updated < q.UpdatedSince,
+			q.CreatedBefore != 0 && meta.Created >= q.CreatedBefore,
+			q.AfterID != "" && !less(storage.ItemMeta{ID: q.AfterID, Created: q.AfterValue, Updated: q.AfterValue}, meta):
+			continue
+		}
+		out = append(out, meta)
+	}
+	sort.Slice(out, func(i, j int) bool { return less(out[i], out[j]) })
+	if q.Limit > 0 && int64(len(out)) > q.Limit {
+		out = out[:q.Limit]
+	}
+	return out, nil
+}
+
+func (m memMetaStore) DeleteMeta(_ context.Context, id string) error {
+	delete(m, id)
+	return nil
+}
+
+func TestMetaMACDetectsTampering(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	blobs := storage.NewFileBlobStore(filepath.Join(dir, "blobs"))
+	metas := memMetaStore{}
+	v := NewWithStores(filepath.Join(dir, "vault.vlt"), blobs, metas)
+	if err := v.Create(ctx, randomBytes(t, 32)); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	id, err := v.AddItem(ctx, Item{Type: "login", Fields: map[string]string{"password": "old"}})
+	if err != nil {
+		t.Fatalf("add item: %v", err)
+	}
+	oldCT, err := blobs.Get(ctx, id)
+	if err != nil {
+		t.Fatalf("get blob: %v", err)
+	}
+	if err := v.UpdateItem(ctx, id, Item{Type: "login", Fields: map[string]string{"password": "new"}}); err != nil {
+		t.Fatalf("update item: %v", err)
+	}
+	if _, err := v.List(ctx, Query{}); err != nil {
+		t.Fatalf("list before tampering: %v", err)
+	}
+
+	m := metas[id]
+	m.Version = 1
+	metas[id] = m
+	var ie *IntegrityError
+	if _, err := v.List(ctx, Query{}); !errors.As(err, &ie) || ie.ID != id {
+		t.Fatalf("expected IntegrityError for edited meta, got %v", err)
+	}
+	m.Version = 2
+	metas[id] = m
+
+	if err := blobs.Put(ctx, id, oldCT); err != nil {
+		t.Fatalf("put blob: %v", err)
+	}
+	if _, err := v.GetItem(ctx, id); !errors.Is(err, ErrIntegrity) {
+		t.Fatalf("expected ErrIntegrity for substituted blob, got %v", err)
+	}
+}
@@ -0,0 +1,144 @@
+package vault
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	cr "project-crypto/internal/crypto"
+	"project-crypto/internal/storage"
+)
+
+// useFastKDF makes vaults created by the test cheap to unlock and keeps
+// Unlock from upgrading them to the production Argon2id targets.
+func useFastKDF(t *testing.T) {
+	t.Helper()
+	prev := defaultKDF
+	defaultKDF = func() cr.KDFParams {
+		p := prev()
+		p.M, p.T, p.P = 8*1024, 1, 1
+		return p
+	}
+	t.Cleanup(func() { defaultKDF = prev })
+}
+
+func createFastVault(t *testing.T, vpath string, blobs storage.BlobStore, master []byte) Vault {
+	t.Helper()
+	useFastKDF(t)
+	ctx := context.Background()
+	v := NewWithStores(vpath, blobs, nil)
+	if err := v.Create(ctx, master); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	p := v.Policy()
+	p.RehashTargetM, p.RehashTargetT, p.RehashTargetP = 8*1024, 1, 1
+	if err := v.SetPolicy(ctx, p); err != nil {
+		t.Fatalf("set policy: %v", err)
+	}
+	return v
+}
+
+func TestInterruptedHeaderWriteIsReplayed(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	blobs := storage.NewFileBlobStore(filepath.Join(dir, "blobs"))
+	vpath := filepath.Join(dir, "vault.vlt")
+	master := randomBytes(t, 32)
+	v := createFastVault(t, vpath, blobs, master)
+
+	renameFile = func(string, string) error { return errors.New("crash") }
+	_, err := v.AddItem(ctx, Item{Type: "login", Fields: map[string]string{"password": "p"}})
+	renameFile = os.Rename
+	if err == nil {
+		t.Fatal("expected add to fail while the header cannot be replaced")
+	}
+	if _, err := os.Stat(journalPath(vpath)); err != nil {
+		t.Fatalf("expected journal to remain: %v", err)
+	}
+
+	v = NewWithStores(vpath, blobs, nil)
+	if err := v.Unlock(ctx, master); err != nil {
+		t.Fatalf("unlock: %v", err)
+	}
+	if !v.LastUnlock().Recovered {
+		t.Fatal("expected journal replay")
+	}
+	items, err := v.List(ctx, Query{})
+	if err != nil || len(items) != 1 {
+		t.Fatalf("list after replay = %v, %v", items, err)
+	}
+	if _, err := os.Stat(journalPath(vpath)); !os.IsNotExist(err) {
+		t.Fatalf("expected journal to be removed, got %v", err)
+	}
+}
+
+func TestTornJournalIsDiscarded(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	blobs := storage.NewFileBlobStore(filepath.Join(dir, "blobs"))
+	vpath := filepath.Join(dir, "vault.vlt")
+	master := randomBytes(t, 32)
+	v := createFastVault(t, vpath, blobs, master)
+	if _, err := v.AddItem(ctx, Item{Type: "login", Fields: map[string]string{"password": "p"}}); err != nil {
+		t.Fatalf("add item: %v", err)
+	}
+
+	hb, _ := os.ReadFile(vpath)
+	if err := writeJournal(vpath, hb); err != nil {
+		t.Fatalf("write journal: %v", err)
+	}
+	jb, _ := os.ReadFile(journalPath(vpath))
+	if err := os.WriteFile(journalPath(vpath), jb[:len(jb)/2], 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(vpath+".tmp", hb[:10], 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	v = NewWithStores(vpath, blobs, nil)
+	if err := v.Unlock(ctx, master); err != nil {
+		t.Fatalf("unlock with torn journal: %v", err)
+	}
+	if v.LastUnlock().Recovered {
+		t.Fatal("torn journal must not be replayed")
+	}
+	for _, p := range []string{journalPath(vpath), vpath + ".tmp"} {
+		if _, err := os.Stat(p); !os.IsNotExist(err) {
+			t.Fatalf("expected %s to be removed, got %v", p, err)
+		}
+	}
+}
+
+func TestTornHeaderIsRestoredFromJournal(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	blobs := storage.NewFileBlobStore(filepath.Join(dir, "blobs"))
+	vpath := filepath.Join(dir, "vault.vlt")
+	master := randomBytes(t, 32)
+	v := createFastVault(t, vpath, blobs, master)
+	id, err := v.AddItem(ctx, Item{Type: "login", Fields: map[string]string{"password": "p"}})
+	if err != nil {
+		t.Fatalf("add item: %v", err)
+	}
+
+	hb, _ := os.ReadFile(vpath)
+	if err := writeJournal(vpath, hb); err != nil {
+		t.Fatalf("write journal: %v", err)
+	}
+	if err := os.WriteFile(vpath, hb[:len(hb)/3], 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	v = NewWithStores(vpath, blobs, nil)
+	if err := v.Unlock(ctx, master); err != nil {
+		t.Fatalf("unlock with torn header: %v", err)
+	}
+	if !v.LastUnlock().Recovered {
+		t.Fatal("expected header to be restored from the journal")
+	}
+	if _, err := v.GetItem(ctx, id); err != nil {
+		t.Fatalf("get item: %v", err)
+	}
+}
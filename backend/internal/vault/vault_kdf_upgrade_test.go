@@ -0,0 +1,75 @@
+package vault
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"project-crypto/internal/storage"
+)
+
+func TestUnlockUpgradesWeakKDF(t *testing.T) {
+	useFastKDF(t)
+
+	ctx := context.Background()
+	dir := t.TempDir()
+	blobs := storage.NewFileBlobStore(filepath.Join(dir, "blobs"))
+	vpath := filepath.Join(dir, "vault.vlt")
+	master := randomBytes(t, 32)
+
+	v := NewWithStores(vpath, blobs, nil)
+	if err := v.Create(ctx, master); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	id, err := v.AddItem(ctx, Item{Type: "login", Fields: map[string]string{"password": "p"}})
+	if err != nil {
+		t.Fatalf("add item: %v", err)
+	}
+	p := v.Policy()
+	p.RehashTargetM, p.RehashTargetT, p.RehashTargetP = 16*1024, 2, 1
+	if err := v.SetPolicy(ctx, p); err != nil {
+		t.Fatalf("set policy: %v", err)
+	}
+	v.Lock()
+
+	v = NewWithStores(vpath, blobs, nil)
+	if err := v.Unlock(ctx, master); err != nil {
+		t.Fatalf("unlock: %v", err)
+	}
+	rep := v.LastUnlock()
+	if !rep.KDFUpgraded {
+		t.Fatal("expected KDF upgrade on unlock")
+	}
+	if rep.OldKDF.M != 8*1024 || rep.NewKDF.M != 16*1024 || rep.NewKDF.T != 2 {
+		t.Fatalf("unexpected report: %+v", rep)
+	}
+	h, err := readHeader(vpath)
+	if err != nil {
+		t.Fatalf("read header: %v", err)
+	}
+	if h.KDF.M != 16*1024 || h.KDF.T != 2 {
+		t.Fatalf("header not upgraded: %+v", h.KDF)
+	}
+	found := false
+	for _, e := range v.AuditLog().Entries() {
+		if strings.HasPrefix(e.What, "kdf-upgrade") {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatal("expected kdf-upgrade audit entry")
+	}
+	v.Lock()
+
+	v = NewWithStores(vpath, blobs, nil)
+	if err := v.Unlock(ctx, master); err != nil {
+		t.Fatalf("unlock after upgrade: %v", err)
+	}
+	if v.LastUnlock().KDFUpgraded {
+		t.Fatal("expected no second upgrade")
+	}
+	if _, err := v.GetItem(ctx, id); err != nil {
+		t.Fatalf("get item: %v", err)
+	}
+}
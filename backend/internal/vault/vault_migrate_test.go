@@ -0,0 +1,281 @@
+package vault
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"project-crypto/internal/storage"
+)
+
+func TestNewIDs(t *testing.T) {
+	v := &vault{}
+	seen := map[string]bool{}
+	for i := 0; i < 1000; i++ {
+		id := v.newID()
+		if len(id) != 26 || isLegacyID(id) || strings.ToLower(id) != id {
+			t.Fatalf("bad id %q", id)
+		}
+		if seen[id] {
+			t.Fatalf("duplicate id %q", id)
+		}
+		seen[id] = true
+	}
+}
+
+func TestMigrateTimestampIDs(t *testing.T) {
+	useFastKDF(t)
+	ctx := context.Background()
+	dir := t.TempDir()
+	vpath := filepath.Join(dir, "vault.vlt")
+	blobs := storage.NewFileBlobStore(filepath.Join(dir, "blobs"))
+	metas := memMetaStore{}
+	master := randomBytes(t, 32)
+
+	v := NewWithStores(vpath, blobs, metas)
+	if err := v.Create(ctx, master); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	id, err := v.AddItem(ctx, Item{Type: "login", Fields: map[string]string{"site": "a.example", "password": "one"}})
+	if err != nil {
+		t.Fatalf("add item: %v", err)
+	}
+	if err := v.UpdateItem(ctx, id, Item{Type: "login", Fields: map[string]string{"site": "a.example", "password": "two"}}); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	att, err := v.AddAttachment(ctx, id, "key.pem", "text/plain", strings.NewReader("attached"))
+	if err != nil {
+		t.Fatalf("attach: %v", err)
+	}
+	other, err := v.AddItem(ctx, Item{Type: "note", Fields: map[string]string{"notes": "hello"}})
+	if err != nil {
+		t.Fatalf("add item: %v", err)
+	}
+	folder, err := v.CreateFolder(ctx, "Work", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := v.Organize(ctx, id, Organization{Folder: &folder.ID, Tags: []string{"x"}}, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	// Move both items to timestamp ids and mark the file as version 3, the
+	// way older builds left it.
+	vv := v.(*vault)
+	legacy := map[string]string{}
+	for _, cur := range []string{id, other} {
+		old := strconv.FormatInt(time.Now().UnixNano(), 10)
+		stale, err := vv.renameItem(ctx, cur, old)
+		if err != nil {
+			t.Fatalf("rename: %v", err)
+		}
+		for _, b := range stale {
+			_ = blobs.Delete(ctx, b)
+		}
+		delete(metas, cur)
+		legacy[old] = cur
+	}
+	vv.header.Version = formatVersionTimestampIDs
+	if err := vv.flushKD(); err != nil {
+		t.Fatal(err)
+	}
+	v.Lock()
+
+	v = NewWithStores(vpath, blobs, metas)
+	if err := v.Unlock(ctx, master); err != nil {
+		t.Fatalf("unlock: %v", err)
+	}
+	if got := v.LastUnlock().MigratedFrom; got != formatVersionTimestampIDs {
+		t.Fatalf("MigratedFrom = %d", got)
+	}
+	if h, _ := readHeader(vpath); h.Version != formatVersion {
+		t.Fatalf("header version %d after migration", h.Version)
+	}
+
+	metasOut, err := v.List(ctx, Query{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(metasOut) != 2 {
+		t.Fatalf("listed %d items, want 2", len(metasOut))
+	}
+	var login string
+	for _, m := range metasOut {
+		if isLegacyID(m.ID) {
+			t.Fatalf("legacy id %s survived", m.ID)
+		}
+		if _, ok := metas[m.ID]; !ok {
+			t.Fatalf("meta store has no document for %s", m.ID)
+		}
+		if m.Type == "login" {
+			login = m.ID
+			if m.Folder != folder.ID || len(m.Tags) != 1 {
+				t.Fatalf("organization lost: %+v", m)
+			}
+		}
+	}
+	for old := range legacy {
+		if _, ok := metas[old]; ok {
+			t.Fatalf("meta document %s not removed", old)
+		}
+		if _, err := blobs.Get(ctx, old); err == nil {
+			t.Fatalf("blob %s not removed", old)
+		}
+	}
+
+	it, err := v.GetItem(ctx, login)
+	if err != nil || it.Fields["password"] != "two" {
+		t.Fatalf("get migrated item: %+v, %v", it, err)
+	}
+	prev, err := v.GetRevision(ctx, login, 1)
+	if err != nil || prev.Fields["password"] != "one" {
+		t.Fatalf("get migrated revision: %+v, %v", prev, err)
+	}
+	var buf bytes.Buffer
+	if _, err := v.ReadAttachment(ctx, login, att.ID, &buf); err != nil || buf.String() != "attached" {
+		t.Fatalf("read migrated attachment: %q, %v", buf.String(), err)
+	}
+	if err := v.UpdateItem(ctx, login, Item{Type: "login", Fields: map[string]string{"password": "three"}}); err != nil {
+		t.Fatalf("update migrated item: %v", err)
+	}
+}
+
+func TestMigrateTimestampIDsSkipsUnreadableItems(t *testing.T) {
+	useFastKDF(t)
+	ctx := context.Background()
+	dir := t.TempDir()
+	vpath := filepath.Join(dir, "vault.vlt")
+	blobs := storage.NewFileBlobStore(filepath.Join(dir, "blobs"))
+	metas := memMetaStore{}
+	master := randomBytes(t, 32)
+
+	v := NewWithStores(vpath, blobs, metas)
+	if err := v.Create(ctx, master); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	good, err := v.AddItem(ctx, Item{Type: "note", Fields: map[string]string{"notes": "good"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	bad, err := v.AddItem(ctx, Item{Type: "note", Fields: map[string]string{"notes": "bad"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vv := v.(*vault)
+	var badLegacy string
+	for _, cur := range []string{good, bad} {
+		old := strconv.FormatInt(time.Now().UnixNano(), 10)
+		stale, err := vv.renameItem(ctx, cur, old)
+		if err != nil {
+			t.Fatalf("rename: %v", err)
+		}
+		for _, b := range stale {
+			_ = blobs.Delete(ctx, b)
+		}
+		delete(metas, cur)
+		if cur == bad {
+			badLegacy = old
+		}
+	}
+	if err := blobs.Put(ctx, badLegacy, []byte("{not a blob")); err != nil {
+		t.Fatal(err)
+	}
+	vv.header.Version = formatVersionTimestampIDs
+	if err := vv.flushKD(); err != nil {
+		t.Fatal(err)
+	}
+	v.Lock()
+
+	v = NewWithStores(vpath, blobs, metas)
+	if err := v.Unlock(ctx, master); err != nil {
+		t.Fatalf("unlock: %v", err)
+	}
+	rep := v.LastUnlock()
+	if len(rep.SkippedItems) != 1 || rep.SkippedItems[0] != badLegacy {
+		t.Fatalf("SkippedItems = %v, want [%s]", rep.SkippedItems, badLegacy)
+	}
+	if h, _ := readHeader(vpath); h.Version != formatVersionTimestampIDs {
+		t.Fatalf("header version %d after a partial migration", h.Version)
+	}
+	vv = v.(*vault)
+	if _, ok := vv.kd.Items[badLegacy]; !ok {
+		t.Fatalf("skipped item %s dropped from key directory", badLegacy)
+	}
+	migrated := 0
+	for id := range vv.kd.Items {
+		if !isLegacyID(id) {
+			migrated++
+			if it, err := v.GetItem(ctx, id); err != nil || it.Fields["notes"] != "good" {
+				t.Fatalf("get migrated item: %+v, %v", it, err)
+			}
+		}
+	}
+	if migrated != 1 {
+		t.Fatalf("migrated %d items, want 1", migrated)
+	}
+
+	// A crash after the key directory moved on but before the old blobs
+	// were deleted leaves them listed as stale.
+	if err := blobs.Put(ctx, "leftover", []byte("x")); err != nil {
+		t.Fatal(err)
+	}
+	vv.kd.Stale = &StaleState{Blobs: []string{"leftover"}}
+	if err := vv.flushKD(); err != nil {
+		t.Fatal(err)
+	}
+	v.Lock()
+
+	v = NewWithStores(vpath, blobs, metas)
+	if err := v.Unlock(ctx, master); err != nil {
+		t.Fatalf("second unlock: %v", err)
+	}
+	if got := v.LastUnlock().SkippedItems; len(got) != 1 || got[0] != badLegacy {
+		t.Fatalf("retry SkippedItems = %v", got)
+	}
+	if _, err := blobs.Get(ctx, "leftover"); err == nil {
+		t.Fatal("stale blob not deleted on resume")
+	}
+	if st := v.(*vault).kd.Stale; st != nil {
+		t.Fatalf("stale list kept: %+v", st)
+	}
+}
+
+func TestFailedUnlockLeavesVaultLocked(t *testing.T) {
+	useFastKDF(t)
+	ctx := context.Background()
+	dir := t.TempDir()
+	vpath := filepath.Join(dir, "vault.vlt")
+	blobs := storage.NewFileBlobStore(filepath.Join(dir, "blobs"))
+	master := randomBytes(t, 32)
+
+	v := NewWithStores(vpath, blobs, nil)
+	if err := v.Create(ctx, master); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	id, err := v.AddItem(ctx, Item{Type: "note", Fields: map[string]string{"notes": "hello"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// No migration starts from version 1, so Unlock fails after the key
+	// directory has been decrypted.
+	vv := v.(*vault)
+	vv.header.Version = 1
+	if err := vv.flushKD(); err != nil {
+		t.Fatal(err)
+	}
+	v.Lock()
+
+	v = NewWithStores(vpath, blobs, nil)
+	if err := v.Unlock(ctx, master); err == nil {
+		t.Fatal("unlock without a migration path succeeded")
+	}
+	if _, err := v.GetItem(ctx, id); !errors.Is(err, ErrNotUnlocked) {
+		t.Fatalf("vault usable after a failed unlock: %v", err)
+	}
+}
@@ -0,0 +1,83 @@
+package vault
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"project-crypto/internal/storage"
+	"project-crypto/internal/totp"
+)
+
+func TestOTP(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	blobs := storage.NewFileBlobStore(filepath.Join(dir, "blobs"))
+	v := createFastVault(t, filepath.Join(dir, "vault.vlt"), blobs, randomBytes(t, 32))
+
+	uri := "otpauth://totp/Example:alice?secret=JBSWY3DPEHPK3PXP&algorithm=SHA512&digits=8&period=60"
+	id, err := v.AddItem(ctx, Item{Type: "login", Fields: map[string]string{"password": "pw", "totp": uri}})
+	if err != nil {
+		t.Fatalf("add item: %v", err)
+	}
+	key, _ := totp.ParseURI(uri)
+	before, _ := key.Code(time.Now())
+	got, err := v.OTP(ctx, id, "", false)
+	if err != nil {
+		t.Fatalf("otp: %v", err)
+	}
+	after, _ := key.Code(time.Now())
+	if got.Code != before && got.Code != after {
+		t.Fatalf("code %s, want %s or %s", got.Code, before, after)
+	}
+	if got.Type != totp.TypeTOTP || got.Digits != 8 || got.Period != 60 || got.Remaining < 1 || got.Remaining > 60 {
+		t.Fatalf("unexpected code: %+v", got)
+	}
+
+	hotp := []CustomField{{Name: "bank", Kind: KindTOTP, Value: "otpauth://hotp/Bank?secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ&counter=0"}}
+	id2, err := v.AddItem(ctx, Item{Type: "login", Fields: map[string]string{"password": "pw"}, Custom: hotp})
+	if err != nil {
+		t.Fatalf("add item: %v", err)
+	}
+	if _, err := v.OTP(ctx, id2, "bank", false); !errors.Is(err, ErrOTPAdvance) {
+		t.Fatalf("expected ErrOTPAdvance without advance, got %v", err)
+	}
+	for i, want := range []string{"755224", "287082"} {
+		got, err := v.OTP(ctx, id2, "bank", true)
+		if err != nil {
+			t.Fatalf("hotp %d: %v", i, err)
+		}
+		if got.Code != want || got.Counter != uint64(i) {
+			t.Fatalf("hotp %d: got %+v, want %s", i, got, want)
+		}
+	}
+	it, _ := v.GetItem(ctx, id2)
+	if k, _ := totp.ParseKey(it.Custom[0].Value); k.Counter != 2 {
+		t.Fatalf("counter not advanced: %s", it.Custom[0].Value)
+	}
+	if it.Version != 1 {
+		t.Fatalf("advancing the counter bumped the version to %d", it.Version)
+	}
+	if hist, err := v.History(ctx, id2); err != nil || len(hist) != 1 {
+		t.Fatalf("advancing the counter recorded revisions: %+v, %v", hist, err)
+	}
+
+	plain, _ := v.AddItem(ctx, Item{Type: "login", Fields: map[string]string{"password": "pw"}})
+	if _, err := v.OTP(ctx, plain, "", true); !errors.Is(err, ErrNoOTP) {
+		t.Fatalf("expected ErrNoOTP, got %v", err)
+	}
+	if _, err := v.OTP(ctx, id, "password", false); !errors.Is(err, ErrNoOTP) {
+		t.Fatalf("expected ErrNoOTP for a non-seed field, got %v", err)
+	}
+	if err := v.DeleteItem(ctx, id, 0); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if _, err := v.OTP(ctx, id, "", false); !errors.Is(err, ErrInTrash) {
+		t.Fatalf("expected ErrInTrash, got %v", err)
+	}
+	if _, err := v.AddItem(ctx, Item{Type: "login", Fields: map[string]string{"password": "pw", "totp": "otpauth://totp/x?secret=JBSWY3DPEHPK3PXP&digits=3"}}); !errors.Is(err, ErrInvalidItem) {
+		t.Fatalf("expected ErrInvalidItem, got %v", err)
+	}
+}
@@ -0,0 +1,97 @@
+package vault
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"project-crypto/internal/storage"
+)
+
+func TestPadRoundTrip(t *testing.T) {
+	for _, n := range []int{0, 1, 250, 251, 252, 1000} {
+		pt := bytes.Repeat([]byte{'x'}, n)
+		padded := pad(pt, 256)
+		if len(padded)%256 != 0 {
+			t.Fatalf("len %d: padded to %d", n, len(padded))
+		}
+		got, err := unpad(padded)
+		if err != nil || !bytes.Equal(got, pt) {
+			t.Fatalf("len %d: unpad = %q, %v", n, got, err)
+		}
+	}
+	legacy := []byte(`{"type":"login"}`)
+	if got, err := unpad(legacy); err != nil || !bytes.Equal(got, legacy) {
+		t.Fatalf("legacy payload changed: %q, %v", got, err)
+	}
+	if _, err := unpad([]byte{padMarker, 0, 0, 1, 0, 'x'}); err == nil {
+		t.Fatal("expected error for overlong length")
+	}
+}
+
+func TestItemCiphertextsArePadded(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	blobs := storage.NewFileBlobStore(filepath.Join(dir, "blobs"))
+	vpath := filepath.Join(dir, "vault.vlt")
+	master := randomBytes(t, 32)
+	v := createFastVault(t, vpath, blobs, master)
+
+	short, err := v.AddItem(ctx, Item{Type: "login", Fields: map[string]string{"password": "p"}})
+	if err != nil {
+		t.Fatalf("add item: %v", err)
+	}
+	long, err := v.AddItem(ctx, Item{Type: "note", Fields: map[string]string{"notes": strings.Repeat("n", 120)}})
+	if err != nil {
+		t.Fatalf("add item: %v", err)
+	}
+	a, _ := blobs.Get(ctx, short)
+	b, _ := blobs.Get(ctx, long)
+	if len(a) != len(b) {
+		t.Fatalf("ciphertext lengths differ: %d vs %d", len(a), len(b))
+	}
+
+	fi, err := os.Stat(vpath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Size()%int64(v.Policy().PadBucket) != 0 {
+		t.Fatalf("header size %d is not a multiple of the bucket", fi.Size())
+	}
+}
+
+func TestUnpaddedBlobsStillOpen(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	blobs := storage.NewFileBlobStore(filepath.Join(dir, "blobs"))
+	vpath := filepath.Join(dir, "vault.vlt")
+	master := randomBytes(t, 32)
+	v := createFastVault(t, vpath, blobs, master)
+
+	p := v.Policy()
+	p.PadBucket = -1
+	if err := v.SetPolicy(ctx, p); err != nil {
+		t.Fatalf("set policy: %v", err)
+	}
+	id, err := v.AddItem(ctx, Item{Type: "login", Fields: map[string]string{"password": "legacy"}})
+	if err != nil {
+		t.Fatalf("add item: %v", err)
+	}
+	p.PadBucket = 0
+	if err := v.SetPolicy(ctx, p); err != nil {
+		t.Fatalf("set policy: %v", err)
+	}
+	v.Lock()
+
+	v = NewWithStores(vpath, blobs, nil)
+	if err := v.Unlock(ctx, master); err != nil {
+		t.Fatalf("unlock: %v", err)
+	}
+	it, err := v.GetItem(ctx, id)
+	if err != nil || it.Fields["password"] != "legacy" {
+		t.Fatalf("get unpadded item = %+v, %v", it, err)
+	}
+}
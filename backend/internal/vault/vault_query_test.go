@@ -0,0 +1,103 @@
+package vault
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"project-crypto/internal/storage"
+)
+
+func TestListPagination(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		metas storage.MetaStore
+	}{
+		{"index", nil},
+		{"metastore", memMetaStore{}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			dir := t.TempDir()
+			blobs := storage.NewFileBlobStore(filepath.Join(dir, "blobs"))
+			useFastKDF(t)
+			v := NewWithStores(filepath.Join(dir, "vault.vlt"), blobs, tc.metas)
+			if err := v.Create(ctx, randomBytes(t, 32)); err != nil {
+				t.Fatalf("create: %v", err)
+			}
+
+			titles := []string{"delta", "Alpha", "echo", "charlie", "bravo"}
+			for _, title := range titles {
+				if _, err := v.AddItem(ctx, Item{Type: "note", Fields: map[string]string{"title": title, "notes": "n"}}); err != nil {
+					t.Fatalf("add item: %v", err)
+				}
+			}
+			if _, err := v.AddItem(ctx, Item{Type: "login", Fields: map[string]string{"site": "zulu", "password": "p"}}); err != nil {
+				t.Fatalf("add item: %v", err)
+			}
+
+			walk := func(q Query) ([]ItemMeta, int) {
+				t.Helper()
+				var all []ItemMeta
+				pages := 0
+				for {
+					page, err := v.ListPage(ctx, q)
+					if err != nil {
+						t.Fatalf("list page: %v", err)
+					}
+					if page.Total != 5 {
+						t.Fatalf("total = %d, want 5", page.Total)
+					}
+					if len(page.Items) > q.Limit {
+						t.Fatalf("page has %d items, limit %d", len(page.Items), q.Limit)
+					}
+					all = append(all, page.Items...)
+					pages++
+					if page.Next == "" {
+						return all, pages
+					}
+					q.Cursor = page.Next
+				}
+			}
+
+			got, pages := walk(Query{Type: "note", Sort: SortTitle, Limit: 2})
+			want := []string{"Alpha", "bravo", "charlie", "delta", "echo"}
+			if pages != 3 || len(got) != len(want) {
+				t.Fatalf("got %d items in %d pages", len(got), pages)
+			}
+			for i, m := range got {
+				if m.Title != want[i] {
+					t.Fatalf("item %d: title %q, want %q", i, m.Title, want[i])
+				}
+			}
+
+			got, _ = walk(Query{Type: "note", Desc: true, Limit: 2})
+			if len(got) != 5 {
+				t.Fatalf("desc walk returned %d items", len(got))
+			}
+			for i := 1; i < len(got); i++ {
+				if !follows(Query{Sort: SortUpdated, Desc: true}, got[i], got[i-1]) {
+					t.Fatalf("items out of order: %+v before %+v", got[i-1], got[i])
+				}
+			}
+
+			future := time.Now().Unix() + 3600
+			if page, _ := v.ListPage(ctx, Query{UpdatedSince: future}); page.Total != 0 || len(page.Items) != 0 {
+				t.Fatalf("UpdatedSince in the future matched %d items", page.Total)
+			}
+			if page, _ := v.ListPage(ctx, Query{CreatedBefore: future}); page.Total != 6 || len(page.Items) != 6 {
+				t.Fatalf("CreatedBefore in the future matched %d items", page.Total)
+			}
+
+			first, _ := v.ListPage(ctx, Query{Limit: 1})
+			if _, err := v.ListPage(ctx, Query{Limit: 1, Sort: SortCreated, Cursor: first.Next}); !errors.Is(err, ErrBadCursor) {
+				t.Fatalf("cursor reused with another order: expected ErrBadCursor, got %v", err)
+			}
+			if _, err := v.ListPage(ctx, Query{Cursor: "!!"}); !errors.Is(err, ErrBadCursor) {
+				t.Fatalf("garbage cursor: expected ErrBadCursor, got %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,117 @@
+package vault
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"project-crypto/internal/storage"
+)
+
+type flakyStore struct {
+	storage.BlobStore
+	putsLeft int
+}
+
+func (f *flakyStore) Put(ctx context.Context, id string, data []byte) error {
+	if f.putsLeft == 0 {
+		return errors.New("flaky store: put failed")
+	}
+	f.putsLeft--
+	return f.BlobStore.Put(ctx, id, data)
+}
+
+func TestRekeyReencryptsItemsAndRevisions(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	blobs := storage.NewFileBlobStore(filepath.Join(dir, "blobs"))
+	vpath := filepath.Join(dir, "vault.vlt")
+	master := randomBytes(t, 32)
+	v := NewWithStores(vpath, blobs, nil)
+	if err := v.Create(ctx, master); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	id, err := v.AddItem(ctx, Item{Type: "login", Fields: map[string]string{"password": "one"}})
+	if err != nil {
+		t.Fatalf("add item: %v", err)
+	}
+	if err := v.UpdateItem(ctx, id, Item{Type: "login", Fields: map[string]string{"password": "two"}}); err != nil {
+		t.Fatalf("update item: %v", err)
+	}
+
+	typed := v.(*vault)
+	vrkBefore := typed.vrk
+	wrapBefore := append([]byte(nil), typed.kd.Items[id].DekWrap...)
+	blobBefore, _ := blobs.Get(ctx, id)
+	revBefore, _ := blobs.Get(ctx, revisionBlobID(id, 1))
+
+	if err := v.Rekey(ctx); err != nil {
+		t.Fatalf("rekey: %v", err)
+	}
+	if typed.vrk == vrkBefore {
+		t.Fatal("expected VRK to change")
+	}
+	if bytes.Equal(wrapBefore, typed.kd.Items[id].DekWrap) {
+		t.Fatal("expected DEK wrap to change")
+	}
+	blobAfter, _ := blobs.Get(ctx, id)
+	revAfter, _ := blobs.Get(ctx, revisionBlobID(id, 1))
+	if bytes.Equal(blobBefore, blobAfter) || bytes.Equal(revBefore, revAfter) {
+		t.Fatal("expected blobs to be re-encrypted")
+	}
+
+	v2 := NewWithStores(vpath, blobs, nil)
+	if err := v2.Unlock(ctx, master); err != nil {
+		t.Fatalf("unlock after rekey: %v", err)
+	}
+	got, err := v2.GetItem(ctx, id)
+	if err != nil || got.Fields["password"] != "two" {
+		t.Fatalf("get item after rekey: %+v %v", got, err)
+	}
+	old, err := v2.GetRevision(ctx, id, 1)
+	if err != nil || old.Fields["password"] != "one" {
+		t.Fatalf("get revision after rekey: %+v %v", old, err)
+	}
+}
+
+func TestRekeyResumesOnUnlock(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	blobs := storage.NewFileBlobStore(filepath.Join(dir, "blobs"))
+	vpath := filepath.Join(dir, "vault.vlt")
+	master := randomBytes(t, 32)
+	flaky := &flakyStore{BlobStore: blobs, putsLeft: -1}
+	v := NewWithStores(vpath, flaky, nil)
+	if err := v.Create(ctx, master); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	want := map[string]string{}
+	for _, pw := range []string{"alpha", "beta", "gamma"} {
+		id, err := v.AddItem(ctx, Item{Type: "login", Fields: map[string]string{"password": pw}})
+		if err != nil {
+			t.Fatalf("add item: %v", err)
+		}
+		want[id] = pw
+	}
+
+	flaky.putsLeft = 1
+	if err := v.Rekey(ctx); err == nil {
+		t.Fatal("expected interrupted rekey to fail")
+	}
+
+	v2 := NewWithStores(vpath, blobs, nil)
+	if err := v2.Unlock(ctx, master); err != nil {
+		t.Fatalf("unlock resumes rekey: %v", err)
+	}
+	if v2.(*vault).kd.Rekey != nil {
+		t.Fatal("expected rekey state to be cleared after resume")
+	}
+	for id, pw := range want {
+		got, err := v2.GetItem(ctx, id)
+		if err != nil || got.Fields["password"] != pw {
+			t.Fatalf("item %s after resumed rekey: %+v %v", id, got, err)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package vault
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"project-crypto/internal/storage"
+)
+
+func TestTrashRestoreAndPurge(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	blobs := storage.NewFileBlobStore(filepath.Join(dir, "blobs"))
+	v := NewWithStores(filepath.Join(dir, "vault.vlt"), blobs, nil)
+	if err := v.Create(ctx, randomBytes(t, 32)); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	item := Item{Type: "login", Fields: map[string]string{"password": "secret"}}
+	id, err := v.AddItem(ctx, item)
+	if err != nil {
+		t.Fatalf("add item: %v", err)
+	}
+	expired, err := v.AddItem(ctx, item)
+	if err != nil {
+		t.Fatalf("add item: %v", err)
+	}
+
+	for _, x := range []string{id, expired} {
+		if err := v.DeleteItem(ctx, x, 0); err != nil {
+			t.Fatalf("delete: %v", err)
+		}
+	}
+	if metas, _ := v.List(ctx, Query{}); len(metas) != 0 {
+		t.Fatalf("expected trashed items to be hidden from List, got %+v", metas)
+	}
+	if trash, _ := v.ListTrash(ctx); len(trash) != 2 {
+		t.Fatalf("expected 2 items in trash, got %+v", trash)
+	}
+	if err := v.UpdateItem(ctx, id, item); !errors.Is(err, ErrInTrash) {
+		t.Fatalf("expected ErrInTrash on update, got %v", err)
+	}
+
+	if err := v.Restore(ctx, id); err != nil {
+		t.Fatalf("restore: %v", err)
+	}
+	if metas, _ := v.List(ctx, Query{}); len(metas) != 1 || metas[0].ID != id {
+		t.Fatalf("expected restored item in List, got %+v", metas)
+	}
+
+	typed := v.(*vault)
+	m := typed.meta[expired]
+	m.Deleted = 1
+	typed.meta[expired] = m
+	n, err := v.PurgeExpired(ctx)
+	if err != nil || n != 1 {
+		t.Fatalf("purge expired: n=%d err=%v", n, err)
+	}
+	if _, err := blobs.Get(ctx, expired); err != storage.ErrNotFound {
+		t.Fatalf("expected purged blob to be deleted, got %v", err)
+	}
+	if _, err := v.GetItem(ctx, expired); !errors.Is(err, ErrItemNotFound) {
+		t.Fatalf("expected purged item to be gone, got %v", err)
+	}
+
+	if err := v.Purge(ctx, id); !errors.Is(err, ErrItemNotFound) {
+		t.Fatalf("expected purge of a live item to fail, got %v", err)
+	}
+	if err := v.DeleteItem(ctx, id, 0); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if err := v.Purge(ctx, id); err != nil {
+		t.Fatalf("purge: %v", err)
+	}
+	if _, ok := typed.kd.Items[id]; ok {
+		t.Fatal("expected DEK wrap to be dropped on purge")
+	}
+}
@@ -0,0 +1,15 @@
+// Package wordlist holds the English word list shared by the passphrase
+// generator and the strength estimator's dictionary.
+package wordlist
+
+import (
+	_ "embed"
+	"strings"
+)
+
+//go:embed english.txt
+var englishData string
+
+// English is the word list in file order, one lowercase word per entry.
+// It must not be modified.
+var English = strings.Fields(englishData)
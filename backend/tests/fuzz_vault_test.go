@@ -3,14 +3,18 @@ package tests
 import (
 	"context"
 	"os"
+	"path/filepath"
 	"testing"
 
+	"project-crypto/internal/storage"
 	"project-crypto/internal/vault"
 )
 
 func TestVaultCreateUnlock(t *testing.T) {
-	path := t.TempDir() + "/test.vlt"
-	v := vault.New(path)
+	dir := t.TempDir()
+	path := filepath.Join(dir, "test.vlt")
+	blobs := storage.NewFileBlobStore(filepath.Join(dir, "blobs"))
+	v := vault.NewWithStores(path, blobs, nil)
 	master := []byte("passw0rd!")
 
 	if err := v.Create(context.Background(), master); err != nil {
@@ -18,7 +22,7 @@ func TestVaultCreateUnlock(t *testing.T) {
 	}
 	v.Lock()
 
-	v2 := vault.New(path)
+	v2 := vault.NewWithStores(path, blobs, nil)
 	if err := v2.Unlock(context.Background(), master); err != nil {
 		t.Fatal(err)
 	}